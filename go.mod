@@ -5,10 +5,14 @@ go 1.13
 require (
 	github.com/Azure/go-autorest/logger v0.1.0 // indirect
 	github.com/apache/thrift v0.0.0-20161221203622-b2a4d4ae21c7
+	github.com/golang/protobuf v1.3.2
 	github.com/opentracing/opentracing-go v1.1.0 // indirect
 	github.com/prometheus/client_golang v1.4.1
+	github.com/prometheus/client_model v0.2.0
 	github.com/sirupsen/logrus v1.4.2
 	github.com/uber/jaeger v1.16.0
 	github.com/uber/tchannel-go v1.16.0 // indirect
 	go.uber.org/atomic v1.5.1 // indirect
+	golang.org/x/net v0.0.0-20190620200207-3b0461eec859
+	gopkg.in/yaml.v2 v2.2.5
 )
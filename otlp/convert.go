@@ -0,0 +1,321 @@
+package otlp
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/willthames/opentracing-processor/span"
+)
+
+// scopeName is the instrumentation scope reported for converted spans
+const scopeName = "opentracing-processor"
+
+var kinds = map[string]SpanKind{
+	span.KindClient:   SpanKindClient,
+	span.KindServer:   SpanKindServer,
+	span.KindProducer: SpanKindProducer,
+	span.KindConsumer: SpanKindConsumer,
+}
+
+// DefaultLinkPrefix starts the binary annotation keys that record span
+// links, unless Options gives another
+const DefaultLinkPrefix = "otlp.link"
+
+// Options control how ToSpans represents OTLP data that has no
+// equivalent in Zipkin
+type Options struct {
+	// LinkPrefix starts the keys of the binary annotations recording
+	// span links, defaulting to DefaultLinkPrefix. Link i is recorded
+	// as <prefix>.<i>.trace_id and <prefix>.<i>.span_id, with its
+	// attributes as <prefix>.<i>.<key>
+	LinkPrefix string
+	// ResourceAttributes are the keys of the resource attributes to
+	// copy onto each of the resource's spans as binary annotations.
+	// If nil, every attribute but service.name, which already names
+	// the spans' service, is copied
+	ResourceAttributes []string
+	// ResourcePrefix is prepended to the keys of copied resource
+	// attributes. Span attributes take precedence over resource
+	// attributes that end up with the same key
+	ResourcePrefix string
+}
+
+// resourceTags returns the attributes of resource to copy onto its
+// spans, keyed as they will be tagged
+func (o Options) resourceTags(resource *Resource) []*KeyValue {
+	if resource == nil {
+		return nil
+	}
+	var tags []*KeyValue
+	for _, kv := range resource.Attributes {
+		if o.ResourceAttributes == nil && kv.Key == "service.name" {
+			continue
+		}
+		if o.ResourceAttributes != nil && !contains(o.ResourceAttributes, kv.Key) {
+			continue
+		}
+		tags = append(tags, &KeyValue{Key: o.ResourcePrefix + kv.Key, Value: kv.Value})
+	}
+	return tags
+}
+
+func contains(keys []string, key string) bool {
+	for _, k := range keys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+// localComponentKey is the binary annotation given to spans with
+// nothing else to carry their service name, as when decoding Zipkin v2
+const localComponentKey = "lc"
+
+// FromSpans converts Zipkin spans into an export request, with a
+// resource per service name. Binary annotations become attributes,
+// annotations become events and an error tag sets the span status
+func FromSpans(spans []*span.Span) *ExportTraceServiceRequest {
+	request := new(ExportTraceServiceRequest)
+	scopes := make(map[string]*ScopeSpans)
+	for _, s := range spans {
+		service := s.ServiceName()
+		scope, ok := scopes[service]
+		if !ok {
+			scope = &ScopeSpans{Scope: &InstrumentationScope{Name: scopeName}}
+			scopes[service] = scope
+			resource := new(Resource)
+			if service != "" {
+				resource.Attributes = []*KeyValue{{Key: "service.name", Value: service}}
+			}
+			request.ResourceSpans = append(request.ResourceSpans, &ResourceSpans{
+				Resource:   resource,
+				ScopeSpans: []*ScopeSpans{scope},
+			})
+		}
+		scope.Spans = append(scope.Spans, fromSpan(s))
+	}
+	return request
+}
+
+func fromSpan(s *span.Span) *Span {
+	result := &Span{
+		TraceID:      traceID(s),
+		SpanID:       hexID(s.ID, 8),
+		ParentSpanID: hexID(s.ParentID, 8),
+		Name:         s.Name,
+		Kind:         SpanKindInternal,
+	}
+	if kind, ok := kinds[s.Kind]; ok {
+		result.Kind = kind
+	}
+	if !s.Timestamp.IsZero() {
+		result.StartTimeUnixNano = uint64(s.Timestamp.UnixNano())
+		result.EndTimeUnixNano = uint64(s.Timestamp.Add(s.Duration).UnixNano())
+	}
+	for _, ba := range s.BinaryAnnotations {
+		result.Attributes = append(result.Attributes, &KeyValue{Key: ba.Key, Value: attributeValue(ba.Value)})
+		if ba.Key == "error" {
+			result.Status = &Status{Code: StatusCodeError, Message: fmt.Sprint(ba.Value)}
+		}
+	}
+	// OTLP has no debug flag, so debug spans are given a sampling
+	// priority instead
+	if s.Debug && !hasAttribute(result.Attributes, span.SamplingPriorityTag) {
+		result.Attributes = append(result.Attributes, &KeyValue{Key: span.SamplingPriorityTag, Value: int64(1)})
+	}
+	for _, annotation := range s.Annotations {
+		result.Events = append(result.Events, &Event{
+			TimeUnixNano: uint64(annotation.Timestamp) * 1e3,
+			Name:         annotation.Value,
+		})
+	}
+	return result
+}
+
+func hasAttribute(attributes []*KeyValue, key string) bool {
+	for _, kv := range attributes {
+		if kv.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+// attributeValue converts a binary annotation value to a type that
+// KeyValue supports
+func attributeValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case string, bool, int64, float64, []byte:
+		return v
+	case int:
+		return int64(v)
+	case int16:
+		return int64(v)
+	case int32:
+		return int64(v)
+	case float32:
+		return float64(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// traceID converts a Zipkin trace ID, including any high 64 bits
+// decoded separately from thrift, to the 16 bytes required by OTLP
+func traceID(s *span.Span) []byte {
+	id := s.TraceID
+	if len(id) <= 16 {
+		high := strings.Repeat("0", 16)
+		if s.TraceIDHigh != nil {
+			high = fmt.Sprintf("%016x", uint64(*s.TraceIDHigh))
+		}
+		id = high + leftPad(id, 16)
+	}
+	return hexID(id, 16)
+}
+
+// hexID decodes a hex ID into size bytes, returning nil for empty or
+// invalid IDs
+func hexID(id string, size int) []byte {
+	if id == "" || len(id) > size*2 {
+		return nil
+	}
+	b, err := hex.DecodeString(leftPad(id, size*2))
+	if err != nil {
+		return nil
+	}
+	return b
+}
+
+func leftPad(id string, length int) string {
+	if len(id) >= length {
+		return id
+	}
+	return strings.Repeat("0", length-len(id)) + id
+}
+
+// ToSpans converts an export request into Zipkin spans, with the
+// service name from each resource's service.name hosting the
+// annotations. Attributes become binary annotations, events become
+// annotations, and resource attributes and links become binary
+// annotations as described by Options. An error status adds an error
+// tag. Spans with missing or all zero trace or span IDs are rejected
+func ToSpans(request *ExportTraceServiceRequest, options Options) ([]*span.Span, error) {
+	if options.LinkPrefix == "" {
+		options.LinkPrefix = DefaultLinkPrefix
+	}
+	var spans []*span.Span
+	for _, rs := range request.ResourceSpans {
+		var local *span.Endpoint
+		if rs.Resource != nil {
+			for _, kv := range rs.Resource.Attributes {
+				if name, ok := kv.Value.(string); ok && kv.Key == "service.name" {
+					local = &span.Endpoint{ServiceName: name}
+				}
+			}
+		}
+		resourceTags := options.resourceTags(rs.Resource)
+		for _, ss := range rs.ScopeSpans {
+			for _, s := range ss.Spans {
+				converted, err := toSpan(s, local, resourceTags, options)
+				if err != nil {
+					return nil, err
+				}
+				spans = append(spans, converted)
+			}
+		}
+	}
+	return spans, nil
+}
+
+func toSpan(s *Span, local *span.Endpoint, resourceTags []*KeyValue, options Options) (*span.Span, error) {
+	if !validID(s.TraceID, 16) {
+		return nil, fmt.Errorf("invalid trace ID %x", s.TraceID)
+	}
+	if !validID(s.SpanID, 8) {
+		return nil, fmt.Errorf("invalid span ID %x", s.SpanID)
+	}
+	if len(s.ParentSpanID) != 0 && len(s.ParentSpanID) != 8 {
+		return nil, fmt.Errorf("invalid parent span ID %x", s.ParentSpanID)
+	}
+	result := &span.Span{
+		TraceID:  fromTraceID(s.TraceID),
+		ID:       hex.EncodeToString(s.SpanID),
+		ParentID: hex.EncodeToString(s.ParentSpanID),
+		Name:     s.Name,
+	}
+	for kind, otlpKind := range kinds {
+		if s.Kind == otlpKind {
+			result.Kind = kind
+		}
+	}
+	if s.StartTimeUnixNano != 0 {
+		result.Timestamp = time.Unix(0, int64(s.StartTimeUnixNano))
+		if s.EndTimeUnixNano > s.StartTimeUnixNano {
+			result.Duration = time.Duration(s.EndTimeUnixNano - s.StartTimeUnixNano)
+		}
+	}
+	for _, event := range s.Events {
+		result.Annotations = append(result.Annotations, &span.Annotation{
+			Timestamp: int64(event.TimeUnixNano / 1e3),
+			Value:     event.Name,
+			Host:      local,
+		})
+	}
+	result.AddCoreAnnotations(local)
+	for _, kv := range s.Attributes {
+		result.AddTag(kv.Key, kv.Value)
+	}
+	for _, kv := range resourceTags {
+		if !hasAttribute(s.Attributes, kv.Key) {
+			result.AddTag(kv.Key, kv.Value)
+		}
+	}
+	if s.Status != nil && s.Status.Code == StatusCodeError && !hasAttribute(s.Attributes, "error") {
+		result.AddTag("error", s.Status.Message)
+	}
+	for i, link := range s.Links {
+		addLink(result, fmt.Sprintf("%s.%d.", options.LinkPrefix, i), link)
+	}
+	if local != nil && len(result.Annotations) == 0 && len(result.BinaryAnnotations) == 0 {
+		result.AddTag(localComponentKey, "")
+	}
+	for i := range result.BinaryAnnotations {
+		result.BinaryAnnotations[i].Host = local
+	}
+	return result, nil
+}
+
+// addLink records link as binary annotations on s, with keys starting
+// with prefix. Links to spans with invalid IDs are recorded without
+// them, so that their attributes aren't lost
+func addLink(s *span.Span, prefix string, link *Link) {
+	if validID(link.TraceID, 16) {
+		s.AddTag(prefix+"trace_id", fromTraceID(link.TraceID))
+	}
+	if validID(link.SpanID, 8) {
+		s.AddTag(prefix+"span_id", hex.EncodeToString(link.SpanID))
+	}
+	for _, kv := range link.Attributes {
+		s.AddTag(prefix+kv.Key, kv.Value)
+	}
+}
+
+// validID reports whether id is size bytes and not all zero, as OTLP
+// requires
+func validID(id []byte, size int) bool {
+	return len(id) == size && !bytes.Equal(id, make([]byte, size))
+}
+
+// fromTraceID encodes an OTLP trace ID as hex, dropping the high 64
+// bits if they are zero as FromSpans adds them
+func fromTraceID(id []byte) string {
+	if bytes.Equal(id[:8], make([]byte, 8)) {
+		return hex.EncodeToString(id[8:])
+	}
+	return hex.EncodeToString(id)
+}
@@ -0,0 +1,588 @@
+// Package otlp implements the subset of the OpenTelemetry protocol
+// (OTLP) trace messages needed to exchange spans with OTLP collectors.
+// Messages are encoded and decoded by hand against the field numbers in
+// opentelemetry/proto/collector/trace/v1/trace_service.proto
+package otlp
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/golang/protobuf/proto"
+)
+
+// SpanKind is the OTLP Span.SpanKind enum
+type SpanKind int32
+
+// OTLP span kinds
+const (
+	SpanKindUnspecified SpanKind = 0
+	SpanKindInternal    SpanKind = 1
+	SpanKindServer      SpanKind = 2
+	SpanKindClient      SpanKind = 3
+	SpanKindProducer    SpanKind = 4
+	SpanKindConsumer    SpanKind = 5
+)
+
+// StatusCode is the OTLP Status.StatusCode enum
+type StatusCode int32
+
+// OTLP status codes
+const (
+	StatusCodeUnset StatusCode = 0
+	StatusCodeOk    StatusCode = 1
+	StatusCodeError StatusCode = 2
+)
+
+// ExportTraceServiceRequest is the body of an OTLP trace export
+type ExportTraceServiceRequest struct {
+	ResourceSpans []*ResourceSpans
+}
+
+// ExportTraceServiceResponse is the reply to an OTLP trace export
+type ExportTraceServiceResponse struct {
+	// PartialSuccess, if set, reports spans that were not accepted
+	PartialSuccess *ExportTracePartialSuccess
+}
+
+// ExportTracePartialSuccess counts the spans of an export that were
+// rejected, and why
+type ExportTracePartialSuccess struct {
+	RejectedSpans int64
+	ErrorMessage  string
+}
+
+// RPCStatus is a google.rpc.Status, the body of OTLP/HTTP error
+// responses. Code is a gRPC status code
+type RPCStatus struct {
+	Code    int32
+	Message string
+}
+
+// ResourceSpans groups the spans reported by a single resource
+type ResourceSpans struct {
+	Resource   *Resource
+	ScopeSpans []*ScopeSpans
+}
+
+// Resource describes the entity (e.g. service) producing spans
+type Resource struct {
+	Attributes []*KeyValue
+}
+
+// ScopeSpans groups spans by the instrumentation scope that produced them
+type ScopeSpans struct {
+	Scope *InstrumentationScope
+	Spans []*Span
+}
+
+// InstrumentationScope identifies an instrumentation library
+type InstrumentationScope struct {
+	Name    string
+	Version string
+}
+
+// Span is a single OTLP span
+type Span struct {
+	TraceID           []byte
+	SpanID            []byte
+	ParentSpanID      []byte
+	Name              string
+	Kind              SpanKind
+	StartTimeUnixNano uint64
+	EndTimeUnixNano   uint64
+	Attributes        []*KeyValue
+	Events            []*Event
+	Links             []*Link
+	Status            *Status
+}
+
+// Link relates a span to a span in another trace, e.g. the messages
+// a batch job consumed
+type Link struct {
+	TraceID    []byte
+	SpanID     []byte
+	Attributes []*KeyValue
+}
+
+// Event is a timestamped annotation on a span
+type Event struct {
+	TimeUnixNano uint64
+	Name         string
+	Attributes   []*KeyValue
+}
+
+// Status is the outcome of the operation a span represents
+type Status struct {
+	Message string
+	Code    StatusCode
+}
+
+// KeyValue is an attribute. Value is one of string, bool, int64,
+// float64 or []byte
+type KeyValue struct {
+	Key   string
+	Value interface{}
+}
+
+// protobuf wire types
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+// encoder writes protobuf fields, omitting those with default values
+// as proto3 does
+type encoder struct {
+	proto.Buffer
+}
+
+type marshaler interface {
+	marshal(e *encoder)
+}
+
+func (e *encoder) tag(field int, wireType int) {
+	e.EncodeVarint(uint64(field<<3 | wireType))
+}
+
+func (e *encoder) bytes(field int, b []byte) {
+	if len(b) == 0 {
+		return
+	}
+	e.tag(field, wireBytes)
+	e.EncodeRawBytes(b)
+}
+
+func (e *encoder) string(field int, s string) {
+	if s == "" {
+		return
+	}
+	e.tag(field, wireBytes)
+	e.EncodeStringBytes(s)
+}
+
+func (e *encoder) varint(field int, v uint64) {
+	if v == 0 {
+		return
+	}
+	e.tag(field, wireVarint)
+	e.EncodeVarint(v)
+}
+
+func (e *encoder) fixed64(field int, v uint64) {
+	if v == 0 {
+		return
+	}
+	e.tag(field, wireFixed64)
+	e.EncodeFixed64(v)
+}
+
+// message writes m as an embedded message, even if it is empty
+func (e *encoder) message(field int, m marshaler) {
+	child := new(encoder)
+	m.marshal(child)
+	e.tag(field, wireBytes)
+	e.EncodeRawBytes(child.Bytes())
+}
+
+// Marshal encodes the request as protobuf
+func (r *ExportTraceServiceRequest) Marshal() ([]byte, error) {
+	e := new(encoder)
+	r.marshal(e)
+	return e.Bytes(), nil
+}
+
+// Marshal encodes the response as protobuf
+func (r *ExportTraceServiceResponse) Marshal() ([]byte, error) {
+	e := new(encoder)
+	if r.PartialSuccess != nil {
+		e.message(1, r.PartialSuccess)
+	}
+	return e.Bytes(), nil
+}
+
+// Marshal encodes the status as protobuf
+func (st *RPCStatus) Marshal() ([]byte, error) {
+	e := new(encoder)
+	e.varint(1, uint64(int64(st.Code)))
+	e.string(2, st.Message)
+	return e.Bytes(), nil
+}
+
+func (ps *ExportTracePartialSuccess) marshal(e *encoder) {
+	e.varint(1, uint64(ps.RejectedSpans))
+	e.string(2, ps.ErrorMessage)
+}
+
+func (r *ExportTraceServiceRequest) marshal(e *encoder) {
+	for _, rs := range r.ResourceSpans {
+		e.message(1, rs)
+	}
+}
+
+func (rs *ResourceSpans) marshal(e *encoder) {
+	if rs.Resource != nil {
+		e.message(1, rs.Resource)
+	}
+	for _, ss := range rs.ScopeSpans {
+		e.message(2, ss)
+	}
+}
+
+func (r *Resource) marshal(e *encoder) {
+	for _, kv := range r.Attributes {
+		e.message(1, kv)
+	}
+}
+
+func (ss *ScopeSpans) marshal(e *encoder) {
+	if ss.Scope != nil {
+		e.message(1, ss.Scope)
+	}
+	for _, s := range ss.Spans {
+		e.message(2, s)
+	}
+}
+
+func (is *InstrumentationScope) marshal(e *encoder) {
+	e.string(1, is.Name)
+	e.string(2, is.Version)
+}
+
+func (s *Span) marshal(e *encoder) {
+	e.bytes(1, s.TraceID)
+	e.bytes(2, s.SpanID)
+	e.bytes(4, s.ParentSpanID)
+	e.string(5, s.Name)
+	e.varint(6, uint64(s.Kind))
+	e.fixed64(7, s.StartTimeUnixNano)
+	e.fixed64(8, s.EndTimeUnixNano)
+	for _, kv := range s.Attributes {
+		e.message(9, kv)
+	}
+	for _, event := range s.Events {
+		e.message(11, event)
+	}
+	for _, link := range s.Links {
+		e.message(13, link)
+	}
+	if s.Status != nil {
+		e.message(15, s.Status)
+	}
+}
+
+func (ev *Event) marshal(e *encoder) {
+	e.fixed64(1, ev.TimeUnixNano)
+	e.string(2, ev.Name)
+	for _, kv := range ev.Attributes {
+		e.message(3, kv)
+	}
+}
+
+func (l *Link) marshal(e *encoder) {
+	e.bytes(1, l.TraceID)
+	e.bytes(2, l.SpanID)
+	for _, kv := range l.Attributes {
+		e.message(4, kv)
+	}
+}
+
+func (st *Status) marshal(e *encoder) {
+	e.string(2, st.Message)
+	e.varint(3, uint64(st.Code))
+}
+
+func (kv *KeyValue) marshal(e *encoder) {
+	e.string(1, kv.Key)
+	e.message(2, anyValue{kv.Value})
+}
+
+// anyValue encodes an OTLP AnyValue. Every member of the oneof is
+// written even when it has its default value, so that e.g. false
+// is distinguishable from unset
+type anyValue struct {
+	value interface{}
+}
+
+func (av anyValue) marshal(e *encoder) {
+	switch v := av.value.(type) {
+	case string:
+		e.tag(1, wireBytes)
+		e.EncodeStringBytes(v)
+	case bool:
+		e.tag(2, wireVarint)
+		if v {
+			e.EncodeVarint(1)
+		} else {
+			e.EncodeVarint(0)
+		}
+	case int64:
+		e.tag(3, wireVarint)
+		e.EncodeVarint(uint64(v))
+	case float64:
+		e.tag(4, wireFixed64)
+		e.EncodeFixed64(math.Float64bits(v))
+	case []byte:
+		e.tag(7, wireBytes)
+		e.EncodeRawBytes(v)
+	}
+}
+
+var errTruncated = errors.New("truncated protobuf message")
+
+// field is a decoded protobuf field. value holds the contents of a
+// length delimited field and number the value of any other
+type field struct {
+	tag    int
+	value  []byte
+	number uint64
+}
+
+// tag returns the key identifying field with wireType, to match a
+// decoded field against. Fields with unexpected wire types don't
+// match, so are skipped like unknown fields
+func tag(field int, wireType int) int {
+	return field<<3 | wireType
+}
+
+// decode calls fn with each field of the message in data, stopping
+// at the first error
+func decode(data []byte, fn func(f field) error) error {
+	for len(data) > 0 {
+		key, n := proto.DecodeVarint(data)
+		if n == 0 {
+			return errTruncated
+		}
+		data = data[n:]
+		f := field{tag: int(key)}
+		switch int(key & 7) {
+		case wireVarint:
+			if f.number, n = proto.DecodeVarint(data); n == 0 {
+				return errTruncated
+			}
+			data = data[n:]
+		case wireFixed64:
+			if len(data) < 8 {
+				return errTruncated
+			}
+			f.number = binary.LittleEndian.Uint64(data)
+			data = data[8:]
+		case wireFixed32:
+			if len(data) < 4 {
+				return errTruncated
+			}
+			f.number = uint64(binary.LittleEndian.Uint32(data))
+			data = data[4:]
+		case wireBytes:
+			length, n := proto.DecodeVarint(data)
+			if n == 0 || length > uint64(len(data)-n) {
+				return errTruncated
+			}
+			f.value = data[n : n+int(length)]
+			data = data[n+int(length):]
+		default:
+			return fmt.Errorf("unsupported protobuf wire type %d", key&7)
+		}
+		if err := fn(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Unmarshal decodes a protobuf encoded export request. Strings and
+// bytes are copied, so the request doesn't refer to data
+func Unmarshal(data []byte) (*ExportTraceServiceRequest, error) {
+	r := new(ExportTraceServiceRequest)
+	err := decode(data, func(f field) error {
+		if f.tag == tag(1, wireBytes) {
+			rs := new(ResourceSpans)
+			r.ResourceSpans = append(r.ResourceSpans, rs)
+			return rs.unmarshal(f.value)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (rs *ResourceSpans) unmarshal(data []byte) error {
+	return decode(data, func(f field) error {
+		switch f.tag {
+		case tag(1, wireBytes):
+			rs.Resource = new(Resource)
+			return rs.Resource.unmarshal(f.value)
+		case tag(2, wireBytes):
+			ss := new(ScopeSpans)
+			rs.ScopeSpans = append(rs.ScopeSpans, ss)
+			return ss.unmarshal(f.value)
+		}
+		return nil
+	})
+}
+
+func (r *Resource) unmarshal(data []byte) error {
+	return decode(data, func(f field) error {
+		if f.tag == tag(1, wireBytes) {
+			return unmarshalAttribute(&r.Attributes, f.value)
+		}
+		return nil
+	})
+}
+
+func (ss *ScopeSpans) unmarshal(data []byte) error {
+	return decode(data, func(f field) error {
+		switch f.tag {
+		case tag(1, wireBytes):
+			ss.Scope = new(InstrumentationScope)
+			return ss.Scope.unmarshal(f.value)
+		case tag(2, wireBytes):
+			s := new(Span)
+			ss.Spans = append(ss.Spans, s)
+			return s.unmarshal(f.value)
+		}
+		return nil
+	})
+}
+
+func (is *InstrumentationScope) unmarshal(data []byte) error {
+	return decode(data, func(f field) error {
+		switch f.tag {
+		case tag(1, wireBytes):
+			is.Name = string(f.value)
+		case tag(2, wireBytes):
+			is.Version = string(f.value)
+		}
+		return nil
+	})
+}
+
+func (s *Span) unmarshal(data []byte) error {
+	return decode(data, func(f field) error {
+		switch f.tag {
+		case tag(1, wireBytes):
+			s.TraceID = copyBytes(f.value)
+		case tag(2, wireBytes):
+			s.SpanID = copyBytes(f.value)
+		case tag(4, wireBytes):
+			s.ParentSpanID = copyBytes(f.value)
+		case tag(5, wireBytes):
+			s.Name = string(f.value)
+		case tag(6, wireVarint):
+			s.Kind = SpanKind(f.number)
+		case tag(7, wireFixed64):
+			s.StartTimeUnixNano = f.number
+		case tag(8, wireFixed64):
+			s.EndTimeUnixNano = f.number
+		case tag(9, wireBytes):
+			return unmarshalAttribute(&s.Attributes, f.value)
+		case tag(11, wireBytes):
+			event := new(Event)
+			s.Events = append(s.Events, event)
+			return event.unmarshal(f.value)
+		case tag(13, wireBytes):
+			link := new(Link)
+			s.Links = append(s.Links, link)
+			return link.unmarshal(f.value)
+		case tag(15, wireBytes):
+			s.Status = new(Status)
+			return s.Status.unmarshal(f.value)
+		}
+		return nil
+	})
+}
+
+func (ev *Event) unmarshal(data []byte) error {
+	return decode(data, func(f field) error {
+		switch f.tag {
+		case tag(1, wireFixed64):
+			ev.TimeUnixNano = f.number
+		case tag(2, wireBytes):
+			ev.Name = string(f.value)
+		case tag(3, wireBytes):
+			return unmarshalAttribute(&ev.Attributes, f.value)
+		}
+		return nil
+	})
+}
+
+func (l *Link) unmarshal(data []byte) error {
+	return decode(data, func(f field) error {
+		switch f.tag {
+		case tag(1, wireBytes):
+			l.TraceID = copyBytes(f.value)
+		case tag(2, wireBytes):
+			l.SpanID = copyBytes(f.value)
+		case tag(4, wireBytes):
+			return unmarshalAttribute(&l.Attributes, f.value)
+		}
+		return nil
+	})
+}
+
+func (st *Status) unmarshal(data []byte) error {
+	return decode(data, func(f field) error {
+		switch f.tag {
+		case tag(2, wireBytes):
+			st.Message = string(f.value)
+		case tag(3, wireVarint):
+			st.Code = StatusCode(f.number)
+		}
+		return nil
+	})
+}
+
+// unmarshalAttribute appends the KeyValue in data to attributes.
+// Attributes whose values aren't one of the types KeyValue supports,
+// such as arrays, are skipped
+func unmarshalAttribute(attributes *[]*KeyValue, data []byte) error {
+	kv := new(KeyValue)
+	err := decode(data, func(f field) error {
+		switch f.tag {
+		case tag(1, wireBytes):
+			kv.Key = string(f.value)
+		case tag(2, wireBytes):
+			av := new(anyValue)
+			if err := av.unmarshal(f.value); err != nil {
+				return err
+			}
+			kv.Value = av.value
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if kv.Value != nil {
+		*attributes = append(*attributes, kv)
+	}
+	return nil
+}
+
+func (av *anyValue) unmarshal(data []byte) error {
+	return decode(data, func(f field) error {
+		switch f.tag {
+		case tag(1, wireBytes):
+			av.value = string(f.value)
+		case tag(2, wireVarint):
+			av.value = f.number != 0
+		case tag(3, wireVarint):
+			av.value = int64(f.number)
+		case tag(4, wireFixed64):
+			av.value = math.Float64frombits(f.number)
+		case tag(7, wireBytes):
+			av.value = copyBytes(f.value)
+		}
+		return nil
+	})
+}
+
+func copyBytes(b []byte) []byte {
+	return append([]byte(nil), b...)
+}
@@ -0,0 +1,258 @@
+package otlp
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/willthames/opentracing-processor/span"
+)
+
+func TestKeyValueMarshal(t *testing.T) {
+	e := new(encoder)
+	(&KeyValue{Key: "a", Value: "b"}).marshal(e)
+	expected := []byte{0x0a, 0x01, 'a', 0x12, 0x03, 0x0a, 0x01, 'b'}
+	if !bytes.Equal(e.Bytes(), expected) {
+		t.Errorf("expected %x, got %x", expected, e.Bytes())
+	}
+}
+
+func TestRPCStatusMarshal(t *testing.T) {
+	body, _ := (&RPCStatus{Code: 3, Message: "bad"}).Marshal()
+	expected := []byte{0x08, 0x03, 0x12, 0x03, 'b', 'a', 'd'}
+	if !bytes.Equal(body, expected) {
+		t.Errorf("expected %x, got %x", expected, body)
+	}
+}
+
+func TestFromSpans(t *testing.T) {
+	high := int64(1)
+	s := &span.Span{
+		TraceID:     "00000000000000ab",
+		TraceIDHigh: &high,
+		ID:          "00000000000000cd",
+		ParentID:    "ef",
+		Name:        "get",
+		Kind:        span.KindServer,
+		Timestamp:   time.Unix(1, 0),
+		Duration:    time.Second,
+		Annotations: []*span.Annotation{{Timestamp: 1500000, Value: "sr"}},
+		BinaryAnnotations: []span.BinaryAnnotation{
+			{Key: "http.path", Value: "/", Host: &span.Endpoint{ServiceName: "frontend"}},
+			{Key: "error", Value: "timeout"},
+		},
+	}
+	request := FromSpans([]*span.Span{s, {TraceID: "1", ID: "2", Name: "other"}})
+	if len(request.ResourceSpans) != 2 {
+		t.Fatalf("expected a resource per service, got %d", len(request.ResourceSpans))
+	}
+	resource := request.ResourceSpans[0]
+	if resource.Resource.Attributes[0].Key != "service.name" || resource.Resource.Attributes[0].Value != "frontend" {
+		t.Errorf("service name not on resource: %#v", resource.Resource.Attributes)
+	}
+	converted := resource.ScopeSpans[0].Spans[0]
+	expectedTraceID := []byte{0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0, 0xab}
+	if !bytes.Equal(converted.TraceID, expectedTraceID) {
+		t.Errorf("expected trace ID %x, got %x", expectedTraceID, converted.TraceID)
+	}
+	if !bytes.Equal(converted.ParentSpanID, []byte{0, 0, 0, 0, 0, 0, 0, 0xef}) {
+		t.Errorf("unexpected parent span ID %x", converted.ParentSpanID)
+	}
+	if converted.Kind != SpanKindServer {
+		t.Errorf("expected server kind, got %v", converted.Kind)
+	}
+	if converted.EndTimeUnixNano-converted.StartTimeUnixNano != uint64(time.Second) {
+		t.Errorf("duration not preserved")
+	}
+	if len(converted.Attributes) != 2 || len(converted.Events) != 1 || converted.Events[0].TimeUnixNano != 1500000000 {
+		t.Errorf("annotations not converted: %#v %#v", converted.Attributes, converted.Events)
+	}
+	if converted.Status == nil || converted.Status.Code != StatusCodeError || converted.Status.Message != "timeout" {
+		t.Errorf("error tag not converted to status: %#v", converted.Status)
+	}
+	if _, err := request.Marshal(); err != nil {
+		t.Errorf("error marshalling request: %v", err)
+	}
+}
+
+func TestDebugSamplingPriority(t *testing.T) {
+	request := FromSpans([]*span.Span{{TraceID: "1", ID: "1", Debug: true}})
+	attributes := request.ResourceSpans[0].ScopeSpans[0].Spans[0].Attributes
+	if len(attributes) != 1 || attributes[0].Key != span.SamplingPriorityTag || attributes[0].Value != int64(1) {
+		t.Errorf("expected debug span to be given a sampling priority, got %v", attributes)
+	}
+}
+
+func TestUnmarshalRoundTrip(t *testing.T) {
+	request := &ExportTraceServiceRequest{ResourceSpans: []*ResourceSpans{{
+		Resource: &Resource{Attributes: []*KeyValue{{Key: "service.name", Value: "frontend"}}},
+		ScopeSpans: []*ScopeSpans{{
+			Scope: &InstrumentationScope{Name: "test", Version: "1"},
+			Spans: []*Span{{
+				TraceID:           []byte{0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0, 2},
+				SpanID:            []byte{0, 0, 0, 0, 0, 0, 0, 3},
+				Name:              "get",
+				Kind:              SpanKindServer,
+				StartTimeUnixNano: 1e9,
+				EndTimeUnixNano:   2e9,
+				Attributes: []*KeyValue{
+					{Key: "s", Value: "v"}, {Key: "b", Value: false}, {Key: "i", Value: int64(-1)},
+					{Key: "f", Value: 1.5}, {Key: "raw", Value: []byte{1}},
+				},
+				Events: []*Event{{TimeUnixNano: 1.5e9, Name: "cache miss"}},
+				Status: &Status{Code: StatusCodeError, Message: "timeout"},
+			}},
+		}},
+	}}}
+	data, err := request.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := Unmarshal(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, _ := decoded.Marshal()
+	if !bytes.Equal(data, again) {
+		t.Errorf("expected decoding to preserve the request, got %#v", decoded)
+	}
+	if _, err := Unmarshal(data[:len(data)-1]); err == nil {
+		t.Error("expected an error decoding a truncated request")
+	}
+}
+
+func TestToSpans(t *testing.T) {
+	s := &span.Span{
+		TraceID:     "00000000000000ab",
+		ID:          "00000000000000cd",
+		ParentID:    "00000000000000ef",
+		Name:        "get",
+		Kind:        span.KindServer,
+		Timestamp:   time.Unix(1, 0),
+		Duration:    time.Second,
+		Annotations: []*span.Annotation{{Timestamp: 1500000, Value: "cache miss"}},
+		BinaryAnnotations: []span.BinaryAnnotation{
+			{Key: "http.path", Value: "/", Host: &span.Endpoint{ServiceName: "frontend"}},
+		},
+	}
+	spans, err := ToSpans(FromSpans([]*span.Span{s, {TraceID: "1", ID: "2", Name: "other"}}), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 spans, got %d", len(spans))
+	}
+	converted := spans[0]
+	if converted.TraceID != s.TraceID || converted.ID != s.ID || converted.ParentID != s.ParentID || converted.Kind != s.Kind {
+		t.Errorf("IDs and kind not preserved: %v", converted)
+	}
+	if !converted.Timestamp.Equal(s.Timestamp) || converted.Duration != s.Duration {
+		t.Errorf("timing not preserved: %v", converted)
+	}
+	if converted.ServiceName() != "frontend" || len(converted.BinaryAnnotations) != 1 {
+		t.Errorf("expected tags hosted on the resource service, got %v", converted.BinaryAnnotations)
+	}
+	// the event plus sr and ss
+	if len(converted.Annotations) != 3 {
+		t.Errorf("expected an annotation and core annotations, got %v", converted.Annotations)
+	}
+	if spans[1].ServiceName() != "" || spans[1].Kind != "" {
+		t.Errorf("expected an internal span without a service, got %v", spans[1])
+	}
+}
+
+func TestToSpansInvalidIDs(t *testing.T) {
+	for _, s := range []*Span{
+		{SpanID: []byte{0, 0, 0, 0, 0, 0, 0, 1}},
+		{TraceID: make([]byte, 16), SpanID: []byte{0, 0, 0, 0, 0, 0, 0, 1}},
+		{TraceID: []byte{1}, SpanID: []byte{0, 0, 0, 0, 0, 0, 0, 1}},
+		{TraceID: []byte{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1}},
+	} {
+		request := &ExportTraceServiceRequest{ResourceSpans: []*ResourceSpans{{ScopeSpans: []*ScopeSpans{{Spans: []*Span{s}}}}}}
+		if _, err := ToSpans(request, Options{}); err == nil {
+			t.Errorf("expected span with trace ID %x and span ID %x to be rejected", s.TraceID, s.SpanID)
+		}
+	}
+}
+
+func TestToSpansLinks(t *testing.T) {
+	linked := &Span{
+		TraceID: []byte{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1},
+		SpanID:  []byte{0, 0, 0, 0, 0, 0, 0, 2},
+		Links: []*Link{
+			{TraceID: []byte{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 3}, SpanID: []byte{0, 0, 0, 0, 0, 0, 0, 4}},
+			{TraceID: []byte{0, 0, 0, 0, 0, 0, 0, 5, 0, 0, 0, 0, 0, 0, 0, 6}, SpanID: []byte{0, 0, 0, 0, 0, 0, 0, 7},
+				Attributes: []*KeyValue{{Key: "kind", Value: "input"}}},
+		},
+	}
+	request := &ExportTraceServiceRequest{ResourceSpans: []*ResourceSpans{{ScopeSpans: []*ScopeSpans{{Spans: []*Span{linked}}}}}}
+	data, _ := request.Marshal()
+	decoded, err := Unmarshal(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tags := func(options Options) map[string]interface{} {
+		spans, err := ToSpans(decoded, options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		result := make(map[string]interface{})
+		for _, ba := range spans[0].BinaryAnnotations {
+			result[ba.Key] = ba.Value
+		}
+		return result
+	}
+
+	expected := map[string]interface{}{
+		"otlp.link.0.trace_id": "0000000000000003",
+		"otlp.link.0.span_id":  "0000000000000004",
+		"otlp.link.1.trace_id": "00000000000000050000000000000006",
+		"otlp.link.1.span_id":  "0000000000000007",
+		"otlp.link.1.kind":     "input",
+	}
+	if got := tags(Options{}); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected links as tags %v, got %v", expected, got)
+	}
+	if got := tags(Options{LinkPrefix: "link"}); got["link.1.kind"] != "input" || len(got) != 5 {
+		t.Errorf("expected links tagged with the configured prefix, got %v", got)
+	}
+}
+
+func TestToSpansResourceAttributes(t *testing.T) {
+	request := &ExportTraceServiceRequest{ResourceSpans: []*ResourceSpans{{
+		Resource: &Resource{Attributes: []*KeyValue{
+			{Key: "service.name", Value: "frontend"},
+			{Key: "service.version", Value: "1.2"},
+			{Key: "k8s.pod.name", Value: "frontend-abc"},
+		}},
+		ScopeSpans: []*ScopeSpans{{Spans: []*Span{{
+			TraceID:    []byte{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1},
+			SpanID:     []byte{0, 0, 0, 0, 0, 0, 0, 2},
+			Attributes: []*KeyValue{{Key: "k8s.pod.name", Value: "override"}},
+		}}}},
+	}}}
+	tags := func(options Options) map[string]interface{} {
+		spans, err := ToSpans(request, options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		result := make(map[string]interface{})
+		for _, ba := range spans[0].BinaryAnnotations {
+			if ba.Host == nil || ba.Host.ServiceName != "frontend" {
+				t.Errorf("expected %s to be hosted on the resource's service", ba.Key)
+			}
+			result[ba.Key] = ba.Value
+		}
+		return result
+	}
+
+	expected := map[string]interface{}{"k8s.pod.name": "override", "service.version": "1.2"}
+	if got := tags(Options{}); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected all resource attributes but service.name, with span attributes winning, got %v", got)
+	}
+	expected = map[string]interface{}{"k8s.pod.name": "override", "resource.k8s.pod.name": "frontend-abc"}
+	if got := tags(Options{ResourceAttributes: []string{"k8s.pod.name"}, ResourcePrefix: "resource."}); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected only the chosen resource attributes, prefixed, got %v", got)
+	}
+}
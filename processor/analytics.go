@@ -0,0 +1,102 @@
+package processor
+
+import (
+	"sync"
+	"time"
+
+	"github.com/willthames/opentracing-processor/span"
+)
+
+// analyticsTap is a SpanReceiver that passes spans on to Next and
+// sends a best effort copy of them, in batches, to Forwarder. The
+// copy never holds up Next: spans that can't be queued or sent are
+// dropped and counted
+type analyticsTap struct {
+	Next      SpanReceiver
+	Forwarder SpanForwarder
+	BatchSize int
+	Interval  time.Duration
+
+	spans chan *span.Span
+	done  chan struct{}
+	wg    sync.WaitGroup
+}
+
+func (t *analyticsTap) Start() error {
+	if t.BatchSize == 0 {
+		t.BatchSize = 100
+	}
+	if t.Interval == 0 {
+		t.Interval = time.Second
+	}
+	t.spans = make(chan *span.Span, 10*t.BatchSize)
+	t.done = make(chan struct{})
+	t.wg.Add(1)
+	go t.run()
+	return nil
+}
+
+// Stop sends any spans still queued. It doesn't stop Forwarder, which
+// may be shared between taps
+func (t *analyticsTap) Stop() error {
+	close(t.done)
+	t.wg.Wait()
+	return nil
+}
+
+func (t *analyticsTap) ReceiveSpan(s *span.Span) {
+	t.Next.ReceiveSpan(s)
+	select {
+	case t.spans <- s:
+	default:
+		spansDropped.WithLabelValues("analytics_full").Inc()
+	}
+}
+
+func (t *analyticsTap) run() {
+	defer t.wg.Done()
+	ticker := time.NewTicker(t.Interval)
+	defer ticker.Stop()
+	var batch []*span.Span
+	for {
+		select {
+		case s := <-t.spans:
+			batch = t.add(batch, s)
+		case <-ticker.C:
+			batch = t.send(batch)
+		case <-t.done:
+			for {
+				select {
+				case s := <-t.spans:
+					batch = t.add(batch, s)
+				default:
+					t.send(batch)
+					return
+				}
+			}
+		}
+	}
+}
+
+// add appends s to batch, sending the batch once it is full
+func (t *analyticsTap) add(batch []*span.Span, s *span.Span) []*span.Span {
+	batch = append(batch, s)
+	if len(batch) >= t.BatchSize {
+		return t.send(batch)
+	}
+	return batch
+}
+
+// send forwards batch, returning an empty batch to fill next. It runs
+// on the tap's goroutine, so a panic in Forwarder is recovered rather
+// than crashing the process
+func (t *analyticsTap) send(batch []*span.Span) []*span.Span {
+	if len(batch) == 0 {
+		return batch
+	}
+	defer recoverBackground("analytics", batch[0].TraceID)
+	if err := t.Forwarder.SendSpans(batch); err != nil {
+		spansDropped.WithLabelValues("analytics_unavailable").Add(float64(len(batch)))
+	}
+	return nil
+}
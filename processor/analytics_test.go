@@ -0,0 +1,39 @@
+package processor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/willthames/opentracing-processor/span"
+)
+
+// batchCountingForwarder counts calls to SendSpans
+type batchCountingForwarder struct {
+	MemoryForwarder
+	batches int
+}
+
+func (f *batchCountingForwarder) SendSpans(spans []*span.Span) error {
+	f.batches++
+	return f.MemoryForwarder.SendSpans(spans)
+}
+
+func TestAnalyticsTap(t *testing.T) {
+	next := new(recordingReceiver)
+	forwarder := new(batchCountingForwarder)
+	tap := &analyticsTap{Next: next, Forwarder: forwarder, BatchSize: 2, Interval: time.Hour}
+	tap.Start()
+	for i := 0; i < 3; i++ {
+		tap.ReceiveSpan(&span.Span{TraceID: "1"})
+	}
+	if len(next.spans) != 3 {
+		t.Errorf("expected every span to be passed straight on, got %d", len(next.spans))
+	}
+	tap.Stop()
+	if spans := forwarder.Spans(); len(spans) != 3 {
+		t.Errorf("expected every span to be copied by the time the tap stops, got %d", len(spans))
+	}
+	if forwarder.batches != 2 {
+		t.Errorf("expected spans to be sent in two batches, got %d", forwarder.batches)
+	}
+}
@@ -0,0 +1,33 @@
+package processor
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"net/http"
+)
+
+// basicAuthWrap wraps a handler so that requests must carry basic auth
+// credentials matching metricsAuthUser and metricsAuthPass. If neither
+// is configured the handler is returned unchanged
+func (a *App) basicAuthWrap(h http.Handler) http.Handler {
+	if a.metricsAuthUser == "" && a.metricsAuthPass == "" {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, ok := r.BasicAuth()
+		if !ok || !secureEqual(user, a.metricsAuthUser) || !secureEqual(pass, a.metricsAuthPass) {
+			w.Header().Set("WWW-Authenticate", `Basic realm="metrics"`)
+			a.writeError(w, r, http.StatusUnauthorized, "unauthorized", "unauthorized")
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// secureEqual compares strings in constant time. They are hashed first
+// so that the time taken doesn't reveal the expected length either
+func secureEqual(given, expected string) bool {
+	g := sha256.Sum256([]byte(given))
+	e := sha256.Sum256([]byte(expected))
+	return subtle.ConstantTimeCompare(g[:], e[:]) == 1
+}
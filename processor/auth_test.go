@@ -0,0 +1,38 @@
+package processor
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestBasicAuthWrap(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	app := &App{}
+	w := httptest.NewRecorder()
+	app.basicAuthWrap(ok).ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("expected no auth to be required without credentials configured, got %d", w.Code)
+	}
+
+	app = &App{metricsAuthUser: "prometheus", metricsAuthPass: "hunter2"}
+	h := app.basicAuthWrap(ok)
+	for _, c := range []struct {
+		user, pass string
+		status     int
+	}{
+		{"prometheus", "hunter2", http.StatusOK},
+		{"prometheus", "hunter3", http.StatusUnauthorized},
+		{"", "", http.StatusUnauthorized},
+	} {
+		r := httptest.NewRequest("GET", "/metrics", nil)
+		if c.user != "" {
+			r.SetBasicAuth(c.user, c.pass)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != c.status {
+			t.Errorf("expected %d for %s:%s, got %d", c.status, c.user, c.pass, w.Code)
+		}
+	}
+}
@@ -0,0 +1,18 @@
+package processor
+
+// queueMonitor is implemented by forwarders that can report how full
+// their queue is
+type queueMonitor interface {
+	// QueueFill returns the fraction of the queue in use, from 0 to 1
+	QueueFill() float64
+}
+
+// overHighWater returns whether the forwarder queue is at least as
+// full as the configured high-water mark, so spans should be refused
+func (a *App) overHighWater() bool {
+	if a.queueHighWater <= 0 {
+		return false
+	}
+	monitor, ok := a.Forwarder.(queueMonitor)
+	return ok && monitor.QueueFill() >= a.queueHighWater
+}
@@ -0,0 +1,36 @@
+package processor
+
+import (
+	"bytes"
+	"sync"
+)
+
+// maxPooledGrowth limits how much larger than its initial size a
+// buffer may grow and still be reused, so that one huge request
+// doesn't keep its memory pinned in the pool
+const maxPooledGrowth = 64
+
+// bufferPool reuses buffers for reading request bodies
+type bufferPool struct {
+	// Size is the initial capacity of new buffers
+	Size int
+	pool sync.Pool
+}
+
+// get returns an empty buffer
+func (p *bufferPool) get() *bytes.Buffer {
+	if buf, ok := p.pool.Get().(*bytes.Buffer); ok {
+		return buf
+	}
+	return bytes.NewBuffer(make([]byte, 0, p.Size))
+}
+
+// put returns buf to the pool. Nothing may use buf, or slices of its
+// contents, afterwards
+func (p *bufferPool) put(buf *bytes.Buffer) {
+	if p.Size > 0 && buf.Cap() > maxPooledGrowth*p.Size {
+		return
+	}
+	buf.Reset()
+	p.pool.Put(buf)
+}
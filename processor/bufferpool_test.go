@@ -0,0 +1,45 @@
+package processor
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/willthames/opentracing-processor/span"
+)
+
+func TestBufferPool(t *testing.T) {
+	p := &bufferPool{Size: 8}
+	buf := p.get()
+	if buf.Cap() != 8 {
+		t.Errorf("expected new buffer with capacity 8, got %d", buf.Cap())
+	}
+	buf.WriteString("hello")
+	p.put(buf)
+	if buf := p.get(); buf.Len() != 0 {
+		t.Errorf("expected reused buffer to be empty, got %q", buf.String())
+	}
+	big := p.get()
+	big.Write(make([]byte, 1024))
+	p.put(big)
+	if buf := p.get(); buf == big {
+		t.Errorf("expected buffer grown well beyond its initial size not to be reused")
+	}
+}
+
+type discardReceiver struct{}
+
+func (discardReceiver) ReceiveSpan(s *span.Span) {}
+
+func BenchmarkHandleSpans(b *testing.B) {
+	body, _ := json.Marshal(benchmarkSpans(100))
+	app := &App{Receiver: discardReceiver{}, buffers: bufferPool{Size: 64 * 1024}}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		r := httptest.NewRequest("POST", "/api/v1/spans", bytes.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+		app.handleSpans(httptest.NewRecorder(), r)
+	}
+}
@@ -0,0 +1,36 @@
+package processor
+
+import (
+	"math/rand"
+
+	"github.com/sirupsen/logrus"
+	"github.com/willthames/opentracing-processor/span"
+)
+
+// chaosDropper randomly drops a fraction Rate of spans, to test how
+// downstream copes with loss
+type chaosDropper struct {
+	Rate float64
+}
+
+func (c *chaosDropper) TransformSpans(spans []*span.Span) []*span.Span {
+	kept := spans[:0]
+	for _, s := range spans {
+		if rand.Float64() < c.Rate {
+			spansDropped.WithLabelValues("chaos").Inc()
+			continue
+		}
+		kept = append(kept, s)
+	}
+	return kept
+}
+
+// warnChaos logs loudly if fault injection is enabled, so that it is
+// never left on by accident
+func (a *App) warnChaos() {
+	if a.chaosDropRate > 0 || a.chaosDelay > 0 {
+		logrus.WithField("dropRate", a.chaosDropRate).
+			WithField("delay", a.chaosDelay).
+			Warn("CHAOS TESTING ENABLED: spans will be deliberately dropped or delayed")
+	}
+}
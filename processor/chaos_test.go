@@ -0,0 +1,16 @@
+package processor
+
+import "testing"
+
+func TestChaosDropper(t *testing.T) {
+	if kept := (&chaosDropper{Rate: 0}).TransformSpans(benchmarkSpans(1000)); len(kept) != 1000 {
+		t.Errorf("expected no spans dropped at rate 0, got %d kept", len(kept))
+	}
+	if kept := (&chaosDropper{Rate: 1}).TransformSpans(benchmarkSpans(1000)); len(kept) != 0 {
+		t.Errorf("expected every span dropped at rate 1, got %d kept", len(kept))
+	}
+	kept := (&chaosDropper{Rate: 0.5}).TransformSpans(benchmarkSpans(1000))
+	if len(kept) < 400 || len(kept) > 600 {
+		t.Errorf("expected about half the spans dropped at rate 0.5, got %d kept", len(kept))
+	}
+}
@@ -0,0 +1,31 @@
+package processor
+
+import "time"
+
+// Clock tells the time. Time based behaviour reads the time from a
+// Clock rather than calling time.Now so that tests can control it. A
+// nil Clock is the real clock
+type Clock interface {
+	Now() time.Time
+}
+
+// now returns the time according to c, or the real time if c is nil
+func now(c Clock) time.Time {
+	if c == nil {
+		return time.Now()
+	}
+	return c.Now()
+}
+
+// minExpiryTick is the most often windows are checked for expiry, so
+// that very short windows don't busy loop
+const minExpiryTick = time.Millisecond
+
+// expiryTick returns how often to check for windows of length window
+// having expired: twice a window, but no more often than minExpiryTick
+func expiryTick(window time.Duration) time.Duration {
+	if tick := window / 2; tick > minExpiryTick {
+		return tick
+	}
+	return minExpiryTick
+}
@@ -0,0 +1,92 @@
+package processor
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"time"
+)
+
+// errDecompressedTooLarge is returned reading a gzipBody that
+// decompresses to more than its limit
+var errDecompressedTooLarge = errors.New("decompressed request body too large")
+
+// errBodyTooLarge is returned reading a limitedBody longer than its
+// limit
+var errBodyTooLarge = errors.New("request body too large")
+
+// tooLarge reports whether err is from a request body, compressed or
+// not, exceeding its limit
+func tooLarge(err error) bool {
+	return err == errDecompressedTooLarge || err == errBodyTooLarge
+}
+
+// limitedBody is a request body read through http.MaxBytesReader,
+// which also closes the connection of clients sending too much, that
+// fails with errBodyTooLarge once more than limit bytes have been read
+type limitedBody struct {
+	io.ReadCloser
+	limit int
+	read  int
+}
+
+func newLimitedBody(w http.ResponseWriter, body io.ReadCloser, limit int) *limitedBody {
+	return &limitedBody{ReadCloser: http.MaxBytesReader(w, body, int64(limit)), limit: limit}
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.read += n
+	if err != nil && err != io.EOF && b.read >= b.limit {
+		err = errBodyTooLarge
+	}
+	return n, err
+}
+
+// gzipBody is a decompressing request body that records, once read to
+// the end, how well the body compressed and how long decompressing it
+// took. If limit is set, reads fail with errDecompressedTooLarge once
+// more than limit bytes have been decompressed, so that a small gzip
+// bomb can't exhaust memory
+type gzipBody struct {
+	io.ReadCloser
+	compressed   int
+	limit        int
+	decompressed int
+	elapsed      time.Duration
+	observed     bool
+}
+
+func (b *gzipBody) Read(p []byte) (int, error) {
+	if b.limit > 0 {
+		if b.decompressed > b.limit {
+			return 0, errDecompressedTooLarge
+		}
+		// read at most one byte past the limit, to tell that it has
+		// been exceeded
+		if remaining := b.limit - b.decompressed + 1; len(p) > remaining {
+			p = p[:remaining]
+		}
+	}
+	start := time.Now()
+	n, err := b.ReadCloser.Read(p)
+	b.elapsed += time.Since(start)
+	b.decompressed += n
+	if b.limit > 0 && b.decompressed > b.limit {
+		return n, errDecompressedTooLarge
+	}
+	if err == io.EOF {
+		b.observe()
+	}
+	return n, err
+}
+
+// observe records the ratio and time metrics, once
+func (b *gzipBody) observe() {
+	if b.observed || b.compressed == 0 {
+		return
+	}
+	b.observed = true
+	ingestCompressionRatio.Observe(float64(b.decompressed) / float64(b.compressed))
+	ingestDecompressDuration.Observe(b.elapsed.Seconds())
+}
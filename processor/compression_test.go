@@ -0,0 +1,94 @@
+package processor
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGzipBody(t *testing.T) {
+	var compressed bytes.Buffer
+	zw := gzip.NewWriter(&compressed)
+	zw.Write(bytes.Repeat([]byte("span"), 1000))
+	zw.Close()
+	size := compressed.Len()
+	zr, err := gzip.NewReader(&compressed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	before := metricTotal(ingestCompressionRatio)
+	body := &gzipBody{ReadCloser: zr, compressed: size}
+	data, err := ioutil.ReadAll(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// further reads at EOF mustn't observe again
+	body.Read(make([]byte, 1))
+	expected := float64(len(data)) / float64(size)
+	if ratio := metricTotal(ingestCompressionRatio) - before; math.Abs(ratio-expected) > 1e-9 {
+		t.Errorf("expected a compression ratio of %v to be observed, got %v", expected, ratio)
+	}
+}
+
+func TestDecompressedSizeLimit(t *testing.T) {
+	var body bytes.Buffer
+	zw := gzip.NewWriter(&body)
+	zw.Write(bytes.Repeat([]byte{' '}, 10*1024*1024))
+	zw.Close()
+
+	receiver := new(recordingReceiver)
+	app := &App{Receiver: receiver, decompressLimit: 1024 * 1024}
+	r := httptest.NewRequest("POST", "/api/v1/spans", &body)
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("Content-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	app.ungzipWrap(app.handleSpans)(w, r)
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected a gzip bomb to get a 413, got %d", w.Code)
+	}
+}
+
+func TestBodySizeLimit(t *testing.T) {
+	// random data doesn't compress, so is still too large gzipped
+	random := make([]byte, 4096)
+	rand.Read(random)
+	var gzipped bytes.Buffer
+	zw := gzip.NewWriter(&gzipped)
+	zw.Write(random)
+	zw.Close()
+
+	post := func(body []byte, encoding string) int {
+		receiver := new(recordingReceiver)
+		app := &App{Receiver: receiver, maxBodyBytes: 1024}
+		r := httptest.NewRequest("POST", "/api/v1/spans", bytes.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+		r.Header.Set("Content-Encoding", encoding)
+		w := httptest.NewRecorder()
+		app.ungzipWrap(app.handleSpans)(w, r)
+		return w.Code
+	}
+	if code := post(benchmarkJSON(t, 1000), ""); code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected a large plain body to get a 413, got %d", code)
+	}
+	if code := post(gzipped.Bytes(), "gzip"); code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected a large gzipped body to get a 413, got %d", code)
+	}
+	if code := post(benchmarkJSON(t, 1), ""); code != http.StatusAccepted {
+		t.Errorf("expected a small body to be accepted, got %d", code)
+	}
+}
+
+func benchmarkJSON(t *testing.T, n int) []byte {
+	data, err := json.Marshal(benchmarkSpans(n))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
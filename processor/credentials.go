@@ -0,0 +1,97 @@
+package processor
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Credentials authenticate requests to the collector. Token, if set,
+// is sent as a bearer token, otherwise Username and Password, if set,
+// as basic auth. URL, if set, replaces the scheme and host of the
+// collector that spans are forwarded to
+type Credentials struct {
+	URL      *url.URL
+	Username string
+	Password string
+	Token    string
+}
+
+// authorize adds the credentials to r
+func (c Credentials) authorize(r *http.Request) {
+	if c.Token != "" {
+		r.Header.Set("Authorization", "Bearer "+c.Token)
+	} else if c.Username != "" || c.Password != "" {
+		r.SetBasicAuth(c.Username, c.Password)
+	}
+}
+
+// credentialsSetter is implemented by forwarders whose credentials can
+// be changed while they run
+type credentialsSetter interface {
+	SetCredentials(c Credentials)
+}
+
+// readCredentials reads credentials from a file of key=value lines.
+// The keys are url, username, password and token. Blank lines and
+// lines starting with # are ignored
+func readCredentials(path string) (Credentials, error) {
+	var c Credentials
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return c, fmt.Errorf("error reading collector credentials: %v", err)
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		parts := strings.SplitN(text, "=", 2)
+		if len(parts) != 2 {
+			return c, fmt.Errorf("invalid collector credentials line %d. Must be key=value", line)
+		}
+		key, value := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+		switch key {
+		case "url":
+			if c.URL, err = parseHTTPURL(value); err != nil {
+				return c, err
+			}
+		case "username":
+			c.Username = value
+		case "password":
+			c.Password = value
+		case "token":
+			c.Token = value
+		default:
+			return c, fmt.Errorf("unknown collector credentials key %s on line %d", key, line)
+		}
+	}
+	return c, nil
+}
+
+// reloadCredentials rereads the collector credentials file and applies
+// it to the running forwarder. Queued spans are kept, and sent with
+// the new credentials
+func (a *App) reloadCredentials() {
+	if a.credentialsFile == "" {
+		return
+	}
+	setter, ok := a.Forwarder.(credentialsSetter)
+	if !ok {
+		return
+	}
+	credentials, err := readCredentials(a.credentialsFile)
+	if err != nil {
+		logrus.WithError(err).Error("Error reloading collector credentials - keeping the current ones")
+		return
+	}
+	setter.SetCredentials(credentials)
+	logrus.WithField("credentialsFile", a.credentialsFile).Info("Reloaded collector credentials")
+}
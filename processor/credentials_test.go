@@ -0,0 +1,62 @@
+package processor
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadCredentials(t *testing.T) {
+	dir, err := ioutil.TempDir("", "credentials")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "credentials")
+
+	ioutil.WriteFile(path, []byte("# rotated hourly\nurl = https://collector:9411\nusername=mario\npassword=it's=me\n"), 0600)
+	c, err := readCredentials(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.URL.Host != "collector:9411" || c.Username != "mario" || c.Password != "it's=me" {
+		t.Errorf("unexpected credentials %+v", c)
+	}
+
+	ioutil.WriteFile(path, []byte("user=mario\n"), 0600)
+	if _, err := readCredentials(path); err == nil {
+		t.Error("expected an unknown key to fail")
+	}
+}
+
+func TestForwarderCredentials(t *testing.T) {
+	received := make(chan *http.Request, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- r
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	// the configured collector is unreachable, the credentials redirect
+	// spans to the test server
+	f, err := NewForwarder("http://127.0.0.1:1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	target, _ := parseHTTPURL(server.URL)
+	f.SetCredentials(Credentials{URL: target, Token: "secret"})
+	f.Start()
+	defer f.Stop()
+	f.SendSpans(benchmarkSpans(1))
+
+	r := <-received
+	if auth := r.Header.Get("Authorization"); auth != "Bearer secret" {
+		t.Errorf("expected a bearer token, got %q", auth)
+	}
+	if r.URL.Path != "/api/v1/spans" {
+		t.Errorf("expected the collector path to be kept, got %s", r.URL.Path)
+	}
+}
@@ -0,0 +1,133 @@
+package processor
+
+import (
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/willthames/opentracing-processor/span"
+)
+
+// secretFlagWords mark flags whose values must never be shown
+var secretFlagWords = []string{"secret", "password", "pass", "token", "auth"}
+
+// configSetting is the effective value of a single setting and
+// where that value came from
+type configSetting struct {
+	Value  string `json:"value"`
+	Source string `json:"source"`
+}
+
+// configSettings resolves every flag registered with fs. Flags that
+// were set on the command line have source "flag", the rest "default".
+// Secret flags are masked, as are credentials in URL values
+func configSettings(fs *flag.FlagSet) map[string]configSetting {
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+	settings := make(map[string]configSetting)
+	fs.VisitAll(func(f *flag.Flag) {
+		setting := configSetting{Value: f.Value.String(), Source: "default"}
+		if set[f.Name] {
+			setting.Source = "flag"
+		}
+		if isSecretFlag(f.Name) && setting.Value != "" {
+			setting.Value = "********"
+		}
+		setting.Value = redactURLs(setting.Value)
+		settings[f.Name] = setting
+	})
+	return settings
+}
+
+// redactURLs masks the password of each URL in a comma separated
+// value, as url.URL.Redacted does in later Go versions. A user name
+// without a password may be a token, so is masked instead
+func redactURLs(value string) string {
+	parts := strings.Split(value, ",")
+	for i, part := range parts {
+		u, err := url.Parse(part)
+		if err != nil || u.User == nil {
+			continue
+		}
+		if _, ok := u.User.Password(); ok {
+			u.User = url.UserPassword(u.User.Username(), "xxxxx")
+		} else {
+			u.User = url.User("xxxxx")
+		}
+		parts[i] = u.String()
+	}
+	return strings.Join(parts, ",")
+}
+
+func isSecretFlag(name string) bool {
+	name = strings.ToLower(name)
+	for _, word := range secretFlagWords {
+		if strings.Contains(name, word) {
+			return true
+		}
+	}
+	return false
+}
+
+// handleDebugConfig handles the /debug/config endpoint, returning the
+// effective value of all command line settings as JSON
+func handleDebugConfig(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(configSettings(flag.CommandLine))
+}
+
+// decodeResult is the /debug/decode response
+type decodeResult struct {
+	ContentType string       `json:"contentType"`
+	Spans       []*span.Span `json:"spans"`
+	Warnings    []string     `json:"warnings"`
+}
+
+// handleDebugDecode handles the /debug/decode endpoint. It decodes a
+// posted payload as ingest at ?path= (default /api/v1/spans) would,
+// and returns the spans as JSON, with warnings for anything that
+// stricter settings would reject. Nothing is forwarded
+func (a *App) handleDebugDecode(w http.ResponseWriter, r *http.Request) {
+	data, err := ioutil.ReadAll(r.Body)
+	if tooLarge(err) {
+		a.writeError(w, r, http.StatusRequestEntityTooLarge, "too_large", err.Error())
+		return
+	}
+	if err != nil {
+		a.writeError(w, r, http.StatusInternalServerError, "read_error", "error reading request")
+		return
+	}
+	path := r.URL.Query().Get("path")
+	if path == "" {
+		path = "/api/v1/spans"
+	}
+	spans, contentType, decodeErr := a.decodeSpans(path, r.Header.Get("Content-Type"), data)
+	if decodeErr != nil {
+		a.writeError(w, r, decodeErr.status, decodeErr.code, decodeErr.message)
+		return
+	}
+	result := decodeResult{ContentType: contentType, Spans: spans, Warnings: []string{}}
+	for _, s := range spans {
+		if err := s.ValidateIDs(); err != nil {
+			result.Warnings = append(result.Warnings, err.Error())
+		}
+	}
+	// multipart uploads aren't checked, as data is the whole upload
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "application/json" && !a.strictJSON {
+		decodeStrict := span.DecodeJSONStrict
+		if path == "/api/v2/spans" {
+			decodeStrict = span.DecodeJSONV2Strict
+		}
+		if _, err := decodeStrict(data); err != nil {
+			result.Warnings = append(result.Warnings, "strict-json: "+err.Error())
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
@@ -0,0 +1,53 @@
+package processor
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// queueInspector is implemented by forwarders that can report what
+// they have queued but not yet sent
+type queueInspector interface {
+	Queued() []Payload
+}
+
+// dumpedPayload is a queued payload as written by dumpQueue. JSON
+// payloads are included as they are, others base64 encoded
+type dumpedPayload struct {
+	ContentType string          `json:"contentType"`
+	TraceID     string          `json:"traceId,omitempty"`
+	Spans       json.RawMessage `json:"spans,omitempty"`
+	Body        []byte          `json:"body,omitempty"`
+}
+
+// dumpQueue writes the payloads the forwarder has queued to
+// queueDumpPath, as JSON
+func (a *App) dumpQueue() {
+	inspector, ok := a.Forwarder.(queueInspector)
+	if !ok {
+		logrus.Warn("Forwarder queue can't be dumped")
+		return
+	}
+	queued := inspector.Queued()
+	dumped := make([]dumpedPayload, len(queued))
+	for i, p := range queued {
+		dumped[i] = dumpedPayload{ContentType: p.ContentType, TraceID: p.TraceID}
+		if strings.HasPrefix(p.ContentType, "application/json") && json.Valid(p.Body) {
+			dumped[i].Spans = p.Body
+		} else {
+			dumped[i].Body = p.Body
+		}
+	}
+	data, err := json.MarshalIndent(dumped, "", "  ")
+	if err == nil {
+		err = ioutil.WriteFile(a.queueDumpPath, data, 0600)
+	}
+	if err != nil {
+		logrus.WithError(err).WithField("path", a.queueDumpPath).Error("Error dumping forwarder queue")
+		return
+	}
+	logrus.WithField("path", a.queueDumpPath).WithField("payloads", len(queued)).Info("Dumped forwarder queue")
+}
@@ -0,0 +1,40 @@
+package processor
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDumpQueue(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dump")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// a forwarder without workers keeps everything queued
+	f := &Forwarder{payloads: []chan Payload{make(chan Payload, 2)}}
+	f.SendSpans(benchmarkSpans(2))
+	f.Send(Payload{ContentType: "application/x-thrift", Body: []byte{1, 2}})
+	app := &App{Forwarder: f, queueDumpPath: filepath.Join(dir, "queue.json")}
+	app.dumpQueue()
+
+	data, err := ioutil.ReadFile(app.queueDumpPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var dumped []dumpedPayload
+	if err := json.Unmarshal(data, &dumped); err != nil {
+		t.Fatalf("dump is not valid json: %v", err)
+	}
+	if len(dumped) != 2 || dumped[0].Spans == nil || dumped[1].Body == nil {
+		t.Errorf("expected json spans then thrift bytes in the dump, got %s", data)
+	}
+	f.dequeued(<-f.payloads[0])
+	if queued := f.Queued(); len(queued) != 1 || queued[0].ContentType != "application/x-thrift" {
+		t.Errorf("expected only the thrift payload to still be queued, got %v", queued)
+	}
+}
@@ -0,0 +1,12 @@
+//go:build !windows
+// +build !windows
+
+package processor
+
+import (
+	"os"
+	"syscall"
+)
+
+// dumpSignals make the processor dump its forward queue
+var dumpSignals = []os.Signal{syscall.SIGUSR1}
@@ -0,0 +1,7 @@
+package processor
+
+import "os"
+
+// dumpSignals make the processor dump its forward queue. Windows has
+// no SIGUSR1, so dumping isn't available there
+var dumpSignals []os.Signal
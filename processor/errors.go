@@ -0,0 +1,60 @@
+package processor
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// snippetContext is how many bytes either side of a decode error's
+// offset are included in verbose errors
+const snippetContext = 32
+
+// errorResponse is the JSON error envelope. Code is stable and
+// suitable for matching on programmatically, Error is human readable
+type errorResponse struct {
+	Error string `json:"error"`
+	Code  string `json:"code"`
+}
+
+// writeError sends an error response to the client. The body is plain
+// text unless json errors are configured or requested by the client,
+// or a google.rpc.Status for protobuf OTLP exports
+func (a *App) writeError(w http.ResponseWriter, r *http.Request, status int, code string, message string) {
+	if isOTLPProtobuf(r) {
+		writeOTLPError(w, status, message)
+		return
+	}
+	if a.errorFormat == "json" || strings.Contains(r.Header.Get("Accept"), "application/json") {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(errorResponse{Error: message, Code: code})
+		return
+	}
+	w.WriteHeader(status)
+	w.Write([]byte(message))
+}
+
+// decodeErrorDetail describes err, a failure decoding data, including
+// the byte offset and the data around it when the error has one
+func decodeErrorDetail(err error, data []byte) string {
+	var offset int64
+	switch e := err.(type) {
+	case *json.SyntaxError:
+		offset = e.Offset
+	case *json.UnmarshalTypeError:
+		offset = e.Offset
+	default:
+		return fmt.Sprintf("error unmarshaling span data: %v", err)
+	}
+	start := offset - snippetContext
+	if start < 0 {
+		start = 0
+	}
+	end := offset + snippetContext
+	if end > int64(len(data)) {
+		end = int64(len(data))
+	}
+	return fmt.Sprintf("error unmarshaling span data at byte %d: %v, near %q", offset, err, data[start:end])
+}
@@ -0,0 +1,152 @@
+package processor
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/willthames/opentracing-processor/span"
+)
+
+// stdoutPath is the FileForwarder Path that writes to stdout
+const stdoutPath = "-"
+
+// FileForwarder is a SpanForwarder that writes spans as newline
+// delimited JSON to Path, or to stdout if Path is "-". Writes are
+// buffered and flushed every FlushInterval and on Stop
+type FileForwarder struct {
+	Path string
+	// FlushInterval defaults to one second
+	FlushInterval time.Duration
+
+	mu   sync.Mutex
+	file *os.File
+	w    *bufio.Writer
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+func (f *FileForwarder) Start() error {
+	if f.FlushInterval == 0 {
+		f.FlushInterval = time.Second
+	}
+	if err := f.Reopen(); err != nil {
+		return err
+	}
+	f.done = make(chan struct{})
+	f.wg.Add(1)
+	go f.run()
+	return nil
+}
+
+func (f *FileForwarder) Stop() error {
+	if f.done != nil {
+		close(f.done)
+		f.wg.Wait()
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.close()
+}
+
+func (f *FileForwarder) run() {
+	defer f.wg.Done()
+	ticker := time.NewTicker(f.FlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-f.done:
+			return
+		case <-ticker.C:
+			if err := f.Flush(); err != nil {
+				logrus.WithError(err).WithField("path", f.Path).Error("Error writing spans")
+			}
+		}
+	}
+}
+
+// Flush writes any buffered spans
+func (f *FileForwarder) Flush() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.w == nil {
+		return nil
+	}
+	return f.w.Flush()
+}
+
+// Reopen flushes and closes the file and opens Path again, so that
+// files moved away by log rotation are replaced
+func (f *FileForwarder) Reopen() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.close(); err != nil {
+		logrus.WithError(err).WithField("path", f.Path).Error("Error closing span file")
+	}
+	var w io.Writer = os.Stdout
+	if f.Path != stdoutPath {
+		file, err := os.OpenFile(f.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+		if err != nil {
+			return err
+		}
+		f.file = file
+		w = file
+	}
+	f.w = bufio.NewWriter(w)
+	return nil
+}
+
+// close flushes and closes the current file. f.mu must be held
+func (f *FileForwarder) close() error {
+	if f.w == nil {
+		return nil
+	}
+	err := f.w.Flush()
+	if f.file != nil {
+		if closeErr := f.file.Close(); err == nil {
+			err = closeErr
+		}
+		f.file = nil
+	}
+	f.w = nil
+	return err
+}
+
+// Send writes the spans in a JSON payload. Other payloads can't be
+// written as JSON lines, so are rejected
+func (f *FileForwarder) Send(p Payload) error {
+	if !strings.HasPrefix(p.ContentType, "application/json") {
+		return errors.New("file sink can only write json payloads")
+	}
+	spans, err := span.DecodeJSON(p.Body)
+	if err != nil {
+		return err
+	}
+	return f.SendSpans(spans)
+}
+
+// SendSpans writes each span as a line of JSON
+func (f *FileForwarder) SendSpans(spans []*span.Span) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.w == nil {
+		return errors.New("file sink is not open")
+	}
+	for _, s := range spans {
+		line, err := json.Marshal(s)
+		if err != nil {
+			return err
+		}
+		f.w.Write(line)
+		if err := f.w.WriteByte('\n'); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package processor
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/willthames/opentracing-processor/span"
+)
+
+func TestFileForwarder(t *testing.T) {
+	dir, err := ioutil.TempDir("", "file-sink")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "spans.ndjson")
+
+	f := &FileForwarder{Path: path, FlushInterval: time.Hour}
+	if err := f.Start(); err != nil {
+		t.Fatal(err)
+	}
+	f.SendSpans([]*span.Span{{TraceID: "0000000000000001", ID: "0000000000000001"}})
+	// rotate the file away, as logrotate would
+	rotated := path + ".1"
+	os.Rename(path, rotated)
+	if err := f.Reopen(); err != nil {
+		t.Fatal(err)
+	}
+	f.Send(Payload{ContentType: "application/json", Body: []byte(`[{"traceId":"0000000000000001","id":"0000000000000002"},{"traceId":"0000000000000001","id":"0000000000000003"}]`)})
+	if err := f.Send(Payload{ContentType: "application/x-thrift", Body: []byte{1}}); err == nil {
+		t.Errorf("expected a thrift payload to be rejected")
+	}
+	f.Stop()
+
+	before, _ := ioutil.ReadFile(rotated)
+	after, _ := ioutil.ReadFile(path)
+	if lines := strings.Count(string(before), "\n"); lines != 1 {
+		t.Errorf("expected one span written before reopening, got %q", before)
+	}
+	if lines := strings.Split(strings.TrimSpace(string(after)), "\n"); len(lines) != 2 || !strings.Contains(lines[1], `"id":"0000000000000003"`) {
+		t.Errorf("expected two spans written after reopening, got %q", after)
+	}
+}
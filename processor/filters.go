@@ -0,0 +1,292 @@
+package processor
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+	"unicode/utf8"
+
+	"github.com/willthames/opentracing-processor/span"
+)
+
+// ageFilter drops spans that started more than MaxAge ago, or more
+// than MaxSkew in the future. Spans without a timestamp are kept
+type ageFilter struct {
+	MaxAge  time.Duration
+	MaxSkew time.Duration
+	Clock   Clock
+}
+
+func (f *ageFilter) TransformSpans(spans []*span.Span) []*span.Span {
+	current := now(f.Clock)
+	oldest := current.Add(-f.MaxAge)
+	newest := current.Add(f.MaxSkew)
+	kept := spans[:0]
+	for _, s := range spans {
+		if s.Timestamp.IsZero() {
+			kept = append(kept, s)
+			continue
+		}
+		if s.Timestamp.Before(oldest) {
+			spansDropped.WithLabelValues("stale").Inc()
+			continue
+		}
+		if s.Timestamp.After(newest) {
+			spansDropped.WithLabelValues("future").Inc()
+			continue
+		}
+		kept = append(kept, s)
+	}
+	return kept
+}
+
+// durationLimiter drops spans lasting longer than Max, or with Zero,
+// clears their duration instead, as such durations are usually the
+// result of broken timestamp arithmetic
+type durationLimiter struct {
+	Max  time.Duration
+	Zero bool
+}
+
+func (f *durationLimiter) TransformSpans(spans []*span.Span) []*span.Span {
+	kept := spans[:0]
+	for _, s := range spans {
+		if s.Duration > f.Max {
+			if !f.Zero {
+				spansDropped.WithLabelValues("duration_too_long").Inc()
+				continue
+			}
+			s.Duration = 0
+			spansTruncated.WithLabelValues("duration_too_long").Inc()
+		}
+		kept = append(kept, s)
+	}
+	return kept
+}
+
+// orphanFilter drops spans whose parent isn't in the same batch,
+// keeping roots and complete subtrees. It only sees one batch at a
+// time, so a span whose parent arrived in an earlier or later request
+// is dropped even though its trace may be complete
+type orphanFilter struct{}
+
+func (f *orphanFilter) TransformSpans(spans []*span.Span) []*span.Span {
+	type spanKey struct{ traceID, id string }
+	ids := make(map[spanKey]bool, len(spans))
+	for _, s := range spans {
+		ids[spanKey{s.TraceID, s.ID}] = true
+	}
+	kept := spans[:0]
+	for _, s := range spans {
+		if s.ParentID != "" && !ids[spanKey{s.TraceID, s.ParentID}] {
+			spansDropped.WithLabelValues("orphan").Inc()
+			continue
+		}
+		kept = append(kept, s)
+	}
+	return kept
+}
+
+// Policies for spans missing a timestamp or duration
+const (
+	missingKeep     = "keep"
+	missingDrop     = "drop"
+	missingBackfill = "backfill"
+)
+
+// missingTimingFilter applies Policy to spans without a timestamp or
+// duration: keep passes them on unchanged, drop drops them and
+// backfill sets a missing timestamp to the time they were received.
+// Thrift decoding already backfills missing timestamps
+type missingTimingFilter struct {
+	Policy string
+	Clock  Clock
+}
+
+func (f *missingTimingFilter) TransformSpans(spans []*span.Span) []*span.Span {
+	received := now(f.Clock)
+	kept := spans[:0]
+	for _, s := range spans {
+		if !s.Timestamp.IsZero() && s.Duration != 0 {
+			kept = append(kept, s)
+			continue
+		}
+		spansMissingTiming.WithLabelValues(f.Policy).Inc()
+		switch f.Policy {
+		case missingDrop:
+			spansDropped.WithLabelValues("missing_timing").Inc()
+			continue
+		case missingBackfill:
+			if s.Timestamp.IsZero() {
+				s.Timestamp = received
+			}
+		}
+		kept = append(kept, s)
+	}
+	return kept
+}
+
+// annotationDeduper removes binary annotations whose key appears more
+// than once in a span, keeping the last value or, if KeepFirst is set,
+// the first. The annotations left keep their relative order
+type annotationDeduper struct {
+	KeepFirst bool
+}
+
+func (f *annotationDeduper) TransformSpans(spans []*span.Span) []*span.Span {
+	for _, s := range spans {
+		chosen := make(map[string]int, len(s.BinaryAnnotations))
+		for i, ba := range s.BinaryAnnotations {
+			if _, seen := chosen[ba.Key]; seen && f.KeepFirst {
+				continue
+			}
+			chosen[ba.Key] = i
+		}
+		if len(chosen) == len(s.BinaryAnnotations) {
+			continue
+		}
+		deduped := s.BinaryAnnotations[:0]
+		for i, ba := range s.BinaryAnnotations {
+			if chosen[ba.Key] == i {
+				deduped = append(deduped, ba)
+			}
+		}
+		s.BinaryAnnotations = deduped
+	}
+	return spans
+}
+
+// annotationsTruncatedTag marks spans that lost binary annotations to
+// an annotationLimiter
+const annotationsTruncatedTag = "processor.annotations_truncated"
+
+// annotationLimiter limits spans to Max binary annotations. Spans with
+// more either have the excess removed (keeping the first Max) or, if
+// Drop is set, are dropped entirely
+type annotationLimiter struct {
+	Max  int
+	Drop bool
+}
+
+func (f *annotationLimiter) TransformSpans(spans []*span.Span) []*span.Span {
+	kept := spans[:0]
+	for _, s := range spans {
+		if len(s.BinaryAnnotations) <= f.Max {
+			kept = append(kept, s)
+			continue
+		}
+		if f.Drop {
+			spansDropped.WithLabelValues("too_many_annotations").Inc()
+			continue
+		}
+		spansTruncated.WithLabelValues("too_many_annotations").Inc()
+		s.BinaryAnnotations = s.BinaryAnnotations[:f.Max]
+		s.AddTag(annotationsTruncatedTag, "true")
+		kept = append(kept, s)
+	}
+	return kept
+}
+
+// truncatedMarker is appended to annotation values shortened by a
+// valueTruncator
+const truncatedMarker = "…"
+
+// truncatedTagPrefix, followed by the annotation key, tags spans that
+// had the value of that annotation shortened
+const truncatedTagPrefix = "processor.truncated."
+
+// valueTruncator shortens string binary annotation values longer than
+// MaxBytes to at most MaxBytes, on a rune boundary, followed by
+// truncatedMarker. If Tag is set, a processor.truncated.<key> tag is
+// added for each shortened annotation
+type valueTruncator struct {
+	MaxBytes int
+	Tag      bool
+}
+
+func (f *valueTruncator) TransformSpans(spans []*span.Span) []*span.Span {
+	for _, s := range spans {
+		var truncated []string
+		for i, ba := range s.BinaryAnnotations {
+			value, ok := ba.Value.(string)
+			if !ok || len(value) <= f.MaxBytes {
+				continue
+			}
+			end := f.MaxBytes
+			for end > 0 && !utf8.RuneStart(value[end]) {
+				end--
+			}
+			s.BinaryAnnotations[i].Value = value[:end] + truncatedMarker
+			truncated = append(truncated, ba.Key)
+		}
+		if len(truncated) == 0 {
+			continue
+		}
+		spansTruncated.WithLabelValues("annotation_value_too_long").Inc()
+		if f.Tag {
+			for _, key := range truncated {
+				s.AddTag(truncatedTagPrefix+key, "true")
+			}
+		}
+	}
+	return spans
+}
+
+// idRewriter replaces trace, span and parent IDs with a keyed hash of
+// their original value, so that traces from processors with different
+// salts can't collide. The same function is applied to every ID, so
+// parent/child relationships survive, including across batches.
+// TraceIDHigh is left alone
+type idRewriter struct {
+	Salt []byte
+}
+
+func (f *idRewriter) TransformSpans(spans []*span.Span) []*span.Span {
+	for _, s := range spans {
+		s.TraceID = f.rewrite(s.TraceID)
+		s.ID = f.rewrite(s.ID)
+		s.ParentID = f.rewrite(s.ParentID)
+	}
+	return spans
+}
+
+// rewrite returns a hex ID the same length as id
+func (f *idRewriter) rewrite(id string) string {
+	if id == "" {
+		return id
+	}
+	mac := hmac.New(sha256.New, f.Salt)
+	mac.Write([]byte(id))
+	rewritten := hex.EncodeToString(mac.Sum(nil))
+	if len(id) < len(rewritten) {
+		rewritten = rewritten[:len(id)]
+	}
+	return rewritten
+}
+
+// hopsTag lists the processors a span has passed through, in order,
+// separated by commas
+const hopsTag = "processor.hops"
+
+// hopRecorder appends Name to each span's processor.hops tag
+type hopRecorder struct {
+	Name string
+}
+
+func (f *hopRecorder) TransformSpans(spans []*span.Span) []*span.Span {
+	for _, s := range spans {
+		recorded := false
+		for i, ba := range s.BinaryAnnotations {
+			if hops, ok := ba.Value.(string); ok && ba.Key == hopsTag {
+				s.BinaryAnnotations[i].Value = hops + "," + f.Name
+				recorded = true
+				break
+			}
+		}
+		if !recorded {
+			s.AddTag(hopsTag, f.Name)
+		}
+	}
+	return spans
+}
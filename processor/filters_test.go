@@ -0,0 +1,194 @@
+package processor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/willthames/opentracing-processor/span"
+)
+
+func TestAgeFilter(t *testing.T) {
+	now := time.Unix(1480979203, 0)
+	spans := []*span.Span{
+		{ID: "recent", Timestamp: now.Add(-time.Minute)},
+		{ID: "stale", Timestamp: now.Add(-2 * time.Hour)},
+		{ID: "skewed", Timestamp: now.Add(10 * time.Second)},
+		{ID: "future", Timestamp: now.Add(time.Hour)},
+		{ID: "untimed"},
+	}
+	f := &ageFilter{MaxAge: time.Hour, MaxSkew: time.Minute, Clock: &fakeClock{t: now}}
+	kept := f.TransformSpans(spans)
+	var ids []string
+	for _, s := range kept {
+		ids = append(ids, s.ID)
+	}
+	if len(ids) != 3 || ids[0] != "recent" || ids[1] != "skewed" || ids[2] != "untimed" {
+		t.Errorf("unexpected spans kept by age filter: %v", ids)
+	}
+}
+
+func TestDurationLimiter(t *testing.T) {
+	spans := []*span.Span{
+		{ID: "quick", Duration: time.Second},
+		{ID: "broken", Duration: 24 * 365 * time.Hour},
+	}
+	if kept := (&durationLimiter{Max: time.Hour}).TransformSpans(spans); len(kept) != 1 || kept[0].ID != "quick" {
+		t.Errorf("expected the broken span to be dropped, got %v", kept)
+	}
+
+	spans = []*span.Span{
+		{ID: "quick", Duration: time.Second},
+		{ID: "broken", Duration: 24 * 365 * time.Hour},
+	}
+	kept := (&durationLimiter{Max: time.Hour, Zero: true}).TransformSpans(spans)
+	if len(kept) != 2 || kept[0].Duration != time.Second || kept[1].Duration != 0 {
+		t.Errorf("expected the broken span's duration to be zeroed, got %v", kept)
+	}
+}
+
+func TestOrphanFilter(t *testing.T) {
+	spans := []*span.Span{
+		{TraceID: "1", ID: "root"},
+		{TraceID: "1", ID: "child", ParentID: "root"},
+		{TraceID: "1", ID: "grandchild", ParentID: "child"},
+		{TraceID: "1", ID: "orphan", ParentID: "elsewhere"},
+		{TraceID: "2", ID: "cousin", ParentID: "root"},
+	}
+	kept := (&orphanFilter{}).TransformSpans(spans)
+	var ids []string
+	for _, s := range kept {
+		ids = append(ids, s.ID)
+	}
+	if len(ids) != 3 || ids[0] != "root" || ids[1] != "child" || ids[2] != "grandchild" {
+		t.Errorf("unexpected spans kept by orphan filter: %v", ids)
+	}
+}
+
+func TestMissingTimingFilter(t *testing.T) {
+	received := time.Unix(1480979203, 0)
+	makeSpans := func() []*span.Span {
+		return []*span.Span{
+			{ID: "complete", Timestamp: received.Add(-time.Second), Duration: time.Millisecond},
+			{ID: "untimed", Duration: time.Millisecond},
+			{ID: "unfinished", Timestamp: received.Add(-time.Second)},
+		}
+	}
+
+	kept := (&missingTimingFilter{Policy: missingKeep}).TransformSpans(makeSpans())
+	if len(kept) != 3 || !kept[1].Timestamp.IsZero() {
+		t.Errorf("keep policy should leave spans unchanged, got %v", kept)
+	}
+	dropped := (&missingTimingFilter{Policy: missingDrop}).TransformSpans(makeSpans())
+	if len(dropped) != 1 || dropped[0].ID != "complete" {
+		t.Errorf("drop policy should only keep the complete span, got %v", dropped)
+	}
+	backfilled := (&missingTimingFilter{Policy: missingBackfill, Clock: &fakeClock{t: received}}).TransformSpans(makeSpans())
+	if len(backfilled) != 3 || !backfilled[1].Timestamp.Equal(received) || backfilled[2].Timestamp.Equal(received) {
+		t.Errorf("backfill policy should only set missing timestamps, got %v", backfilled)
+	}
+}
+
+func TestAnnotationDeduper(t *testing.T) {
+	makeSpan := func() *span.Span {
+		s := &span.Span{ID: "dupes"}
+		s.AddTag("http.method", "GET")
+		s.AddTag("component", "net/http")
+		s.AddTag("http.method", "POST")
+		return s
+	}
+	values := func(s *span.Span) []interface{} {
+		var values []interface{}
+		for _, ba := range s.BinaryAnnotations {
+			values = append(values, ba.Value)
+		}
+		return values
+	}
+
+	last := makeSpan()
+	(&annotationDeduper{}).TransformSpans([]*span.Span{last})
+	if v := values(last); len(v) != 2 || v[0] != "net/http" || v[1] != "POST" {
+		t.Errorf("expected the last http.method to be kept, got %v", v)
+	}
+	first := makeSpan()
+	(&annotationDeduper{KeepFirst: true}).TransformSpans([]*span.Span{first})
+	if v := values(first); len(v) != 2 || v[0] != "GET" || v[1] != "net/http" {
+		t.Errorf("expected the first http.method to be kept, got %v", v)
+	}
+}
+
+func TestAnnotationLimiter(t *testing.T) {
+	makeSpans := func() []*span.Span {
+		small := &span.Span{ID: "small"}
+		small.AddTag("a", "1")
+		big := &span.Span{ID: "big"}
+		for i := 0; i < 5; i++ {
+			big.AddTag("key", "value")
+		}
+		return []*span.Span{small, big}
+	}
+
+	truncated := (&annotationLimiter{Max: 2}).TransformSpans(makeSpans())
+	if len(truncated) != 2 {
+		t.Fatalf("truncate policy should keep all spans, got %d", len(truncated))
+	}
+	big := truncated[1]
+	if len(big.BinaryAnnotations) != 3 || big.BinaryAnnotations[2].Key != annotationsTruncatedTag {
+		t.Errorf("expected two annotations plus truncation marker, got %v", big.BinaryAnnotations)
+	}
+
+	dropped := (&annotationLimiter{Max: 2, Drop: true}).TransformSpans(makeSpans())
+	if len(dropped) != 1 || dropped[0].ID != "small" {
+		t.Errorf("drop policy should only keep the small span, got %v", dropped)
+	}
+}
+
+func TestValueTruncator(t *testing.T) {
+	s := &span.Span{ID: "long"}
+	s.AddTag("db.statement", "SELECT héllo")
+	s.AddTag("short", "ok")
+	s.AddTag("http.status_code", 200)
+	(&valueTruncator{MaxBytes: 9, Tag: true}).TransformSpans([]*span.Span{s})
+	if value := s.BinaryAnnotations[0].Value; value != "SELECT h"+truncatedMarker {
+		t.Errorf("expected value truncated on a rune boundary, got %q", value)
+	}
+	if value := s.BinaryAnnotations[1].Value; value != "ok" {
+		t.Errorf("expected short value to be kept, got %q", value)
+	}
+	if len(s.BinaryAnnotations) != 4 || s.BinaryAnnotations[3].Key != truncatedTagPrefix+"db.statement" {
+		t.Errorf("expected a truncation tag for db.statement, got %v", s.BinaryAnnotations)
+	}
+}
+
+func TestIDRewriter(t *testing.T) {
+	f := &idRewriter{Salt: []byte("tenant-a")}
+	parent := &span.Span{TraceID: "0000000000000001", ID: "0000000000000001"}
+	f.TransformSpans([]*span.Span{parent})
+	// the child arrives in a later batch
+	child := &span.Span{TraceID: "0000000000000001", ID: "0000000000000002", ParentID: "0000000000000001"}
+	f.TransformSpans([]*span.Span{child})
+
+	if parent.TraceID == "0000000000000001" || len(parent.TraceID) != 16 {
+		t.Errorf("trace ID not rewritten to the same length: %s", parent.TraceID)
+	}
+	if child.TraceID != parent.TraceID || child.ParentID != parent.ID {
+		t.Errorf("relationships not preserved: parent %#v child %#v", parent, child)
+	}
+	other := &span.Span{TraceID: "0000000000000001"}
+	(&idRewriter{Salt: []byte("tenant-b")}).TransformSpans([]*span.Span{other})
+	if other.TraceID == parent.TraceID {
+		t.Errorf("different salts should give different trace IDs")
+	}
+}
+
+func TestHopRecorder(t *testing.T) {
+	fresh := &span.Span{ID: "fresh"}
+	chained := &span.Span{ID: "chained"}
+	chained.AddTag(hopsTag, "edge")
+	(&hopRecorder{Name: "central"}).TransformSpans([]*span.Span{fresh, chained})
+	if len(fresh.BinaryAnnotations) != 1 || fresh.BinaryAnnotations[0].Value != "central" {
+		t.Errorf("expected a new hops tag, got %v", fresh.BinaryAnnotations)
+	}
+	if len(chained.BinaryAnnotations) != 1 || chained.BinaryAnnotations[0].Value != "edge,central" {
+		t.Errorf("expected the hop to be appended, got %v", chained.BinaryAnnotations)
+	}
+}
@@ -5,32 +5,184 @@ package processor
 
 import (
 	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"hash/fnv"
 	"io"
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"sort"
 	"sync"
+	"time"
 
 	"github.com/sirupsen/logrus"
+	"github.com/willthames/opentracing-processor/otlp"
+	"github.com/willthames/opentracing-processor/span"
 )
 
 // Payload is the content to forward to the collector
 type Payload struct {
 	ContentType string
 	Body        []byte
+	// TraceID, if set, is used to keep payloads from the same trace
+	// in order when PreserveTraceOrder is enabled
+	TraceID string
+
+	// seq identifies the payload while it is queued
+	seq uint64
+}
+
+// Formats that SendSpans can encode spans in
+const (
+	FormatZipkin = "zipkin"
+	FormatOTLP   = "otlp"
+)
+
+// formatPaths are the collector API paths for each format
+var formatPaths = map[string]string{
+	FormatZipkin: "/api/v1/spans",
+	FormatOTLP:   "/v1/traces",
+}
+
+// SpanForwarder is implemented by destinations for processed spans.
+// App.Forwarder is a SpanForwarder so that processors can be tested
+// against a MemoryForwarder
+type SpanForwarder interface {
+	Start() error
+	Stop() error
+	Send(p Payload) error
+	SendSpans(spans []*span.Span) error
+}
+
+// RetryPolicy controls resending payloads that the collector failed
+// to accept because of a network error or a 5xx response. Payloads
+// refused with any other response are never retried
+type RetryPolicy struct {
+	// MaxAttempts is the most times each payload is sent, including
+	// the first. Zero or one means payloads are never retried
+	MaxAttempts int
+	// BaseBackoff is the wait before the first retry, which doubles
+	// for each retry after, up to MaxBackoff. They default to 100ms
+	// and 10s
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+}
+
+// backoff returns the wait before retrying a payload that has been
+// sent attempts times
+func (r RetryPolicy) backoff(attempts int) time.Duration {
+	backoff := r.BaseBackoff
+	for i := 1; i < attempts && backoff < r.MaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > r.MaxBackoff {
+		backoff = r.MaxBackoff
+	}
+	return backoff
 }
 
 // Forwarder sends traffic to a DownstreamURL
 type Forwarder struct {
-	DownstreamURL  *url.URL
+	DownstreamURL *url.URL
+	// Name labels the forwarder's metrics, so that forwarders to
+	// different destinations can be told apart. Defaults to collector
+	Name string
+	// Format is how SendSpans encodes spans. Defaults to FormatZipkin.
+	// Payloads passed to Send are always forwarded verbatim
+	Format         string
 	BufSize        int
 	MaxConcurrency int
+	// ErrorLogInterval is the minimum time between repeats of the
+	// same forwarding error in the logs
+	ErrorLogInterval time.Duration
+	// PreserveTraceOrder gives each worker its own queue and always
+	// sends payloads for a trace through the same one, so they arrive
+	// in order. A slow trace then holds up every other trace sharing
+	// its worker, so throughput is lower than with a shared queue
+	PreserveTraceOrder bool
+	// SigningSecret, if set, is used to sign each request body with
+	// HMAC-SHA256, sent in the X-Signature header
+	SigningSecret []byte
+	// SortBatch sorts the spans in each batch by timestamp before
+	// encoding them, which helps some backends write them efficiently
+	SortBatch bool
+	// JSON controls the shape of FormatZipkin payloads
+	JSON span.JSONEncoding
+	// MaxBatchBytes, if set, splits batches whose encoded size is over
+	// this many bytes into smaller payloads. A single span over the
+	// limit is dropped, and the rest of its batch sent with an error
+	MaxBatchBytes int
+	// DeadLetterURL, if set, is sent payloads that DownstreamURL
+	// failed to accept. Failures sending there are only logged
+	DeadLetterURL *url.URL
+	// Delay holds each payload for this long before sending it, for
+	// fault injection testing
+	Delay time.Duration
+	// UserAgent is sent with each request. Defaults to
+	// opentracing-processor/<Version>
+	UserAgent string
+	// TLSConfig, if set, is used for HTTPS connections, e.g. to present
+	// a client certificate to the collector
+	TLSConfig *tls.Config
+	// Clock is used to rate limit error logs. Defaults to the real clock
+	Clock Clock
+	// BatchSize, if set, makes SendSpans buffer spans and send them in
+	// batches of this many. Batches smaller than BatchSize are sent
+	// every FlushInterval, which defaults to a second if BatchSize is
+	// set. Setting only FlushInterval sends whatever has been buffered
+	// every FlushInterval. Stop and Flush send the buffered spans
+	// at once. With neither set, each SendSpans call is sent straight
+	// away
+	BatchSize     int
+	FlushInterval time.Duration
+	// MaxFlushInterval, if set along with BatchSize, adapts the flush
+	// interval to the volume of spans. Each timed flush of less than
+	// half a batch doubles the interval, up to MaxFlushInterval, and
+	// each timed flush following a full batch halves it, down to
+	// MinFlushInterval, which defaults to 10ms. The interval starts at
+	// FlushInterval
+	MinFlushInterval time.Duration
+	MaxFlushInterval time.Duration
+	// Retry, if set, resends payloads after transient failures. Stop
+	// interrupts the wait between attempts
+	Retry RetryPolicy
+	// RequestDecorator, if set, is called with each request to
+	// DownstreamURL just before it is sent, after every other header is
+	// set, e.g. to add a short lived token. It is called from the send
+	// workers, so must be fast and safe for concurrent use, and must not
+	// read or replace the request body
+	RequestDecorator func(*http.Request)
 
-	payloads chan Payload
-	stopped  bool
+	payloads  []chan Payload
+	transport http.RoundTripper
+	// done is closed by Stop, to cut short waits between retries
+	done chan struct{}
+	// batch holds spans buffered by SendSpans until they are flushed
+	batchMu   sync.Mutex
+	batch     []*span.Span
+	flushDone chan struct{}
+	flushWG   sync.WaitGroup
+	// fullBatches counts the batches sent for being full since the
+	// last timed flush
+	fullBatches int
+	// credentials can be replaced while workers are sending
+	credentialsMu sync.RWMutex
+	credentials   Credentials
+	// stopMu guards stopped and sends to the queues, so that Stop
+	// can't close a queue while Send is using it
+	stopMu  sync.RWMutex
+	stopped bool
+	// pending holds queued payloads by seq, so they can be inspected
+	mu       sync.Mutex
+	seq      uint64
+	pending  map[uint64]Payload
 	wg       sync.WaitGroup
+	errorLog *rateLimitedLog
 }
 
 func (f *Forwarder) Start() error {
@@ -40,76 +192,533 @@ func (f *Forwarder) Start() error {
 	if f.BufSize == 0 {
 		f.BufSize = 4096
 	}
-	f.payloads = make(chan Payload, f.BufSize)
+	if f.ErrorLogInterval == 0 {
+		f.ErrorLogInterval = 10 * time.Second
+	}
+	if f.UserAgent == "" {
+		f.UserAgent = defaultUserAgent()
+	}
+	if f.Name == "" {
+		f.Name = "collector"
+	}
+	if f.Retry.BaseBackoff == 0 {
+		f.Retry.BaseBackoff = 100 * time.Millisecond
+	}
+	if f.Retry.MaxBackoff == 0 {
+		f.Retry.MaxBackoff = 10 * time.Second
+	}
+	f.done = make(chan struct{})
+	f.errorLog = newRateLimitedLog(f.ErrorLogInterval)
+	f.errorLog.clock = f.Clock
+	if f.TLSConfig != nil {
+		f.transport = &http.Transport{Proxy: http.ProxyFromEnvironment, TLSClientConfig: f.TLSConfig}
+	}
+	if f.BatchSize > 0 && f.FlushInterval == 0 {
+		f.FlushInterval = time.Second
+	}
+	if f.adaptiveFlush() {
+		if f.MinFlushInterval == 0 {
+			f.MinFlushInterval = 10 * time.Millisecond
+		}
+		f.FlushInterval = clampDuration(f.FlushInterval, f.MinFlushInterval, f.MaxFlushInterval)
+	}
+	if f.FlushInterval > 0 {
+		f.flushDone = make(chan struct{})
+		f.flushWG.Add(1)
+		go f.runFlusher()
+	}
+	if f.PreserveTraceOrder {
+		size := f.BufSize / f.MaxConcurrency
+		if size == 0 {
+			size = 1
+		}
+		f.payloads = make([]chan Payload, f.MaxConcurrency)
+		for i := range f.payloads {
+			f.payloads[i] = make(chan Payload, size)
+			f.wg.Add(1)
+			go f.runWorker(f.payloads[i])
+		}
+		return nil
+	}
+	f.payloads = []chan Payload{make(chan Payload, f.BufSize)}
 	for i := 0; i < f.MaxConcurrency; i++ {
 		f.wg.Add(1)
-		go f.runWorker()
+		go f.runWorker(f.payloads[0])
 	}
 	return nil
 }
 
+// Stop sends any buffered spans, then waits for every queued payload
+// to be sent. It returns any error queueing the buffered spans
 func (f *Forwarder) Stop() error {
+	if f.flushDone != nil {
+		close(f.flushDone)
+		f.flushWG.Wait()
+	}
+	// the last batch is sent and SendSpans refused under the same
+	// lock, so that no spans can be buffered after the last flush
+	f.batchMu.Lock()
+	err := f.send(f.batch, "stop")
+	f.batch = nil
+	f.stopMu.Lock()
 	f.stopped = true
+	f.stopMu.Unlock()
+	f.batchMu.Unlock()
+	if f.errorLog != nil {
+		defer f.errorLog.Flush()
+	}
+	if f.done != nil {
+		close(f.done)
+	}
 	if f.payloads == nil {
-		return nil
+		return err
+	}
+	for _, queue := range f.payloads {
+		close(queue)
 	}
-	close(f.payloads)
 	f.wg.Wait()
-	return nil
+	return err
 }
 
-func (f *Forwarder) runWorker() {
-	for p := range f.payloads {
-		r, err := http.NewRequest("POST", f.DownstreamURL.String(), bytes.NewReader(p.Body))
-		r.Header.Set("Content-Type", p.ContentType)
-		if err != nil {
-			logrus.WithError(err).Info("Error building downstream request")
+// runFlusher sends the buffered spans every flush interval
+func (f *Forwarder) runFlusher() {
+	defer f.flushWG.Done()
+	interval := f.FlushInterval
+	forwardFlushInterval.WithLabelValues(f.Name).Set(interval.Seconds())
+	timer := time.NewTimer(interval)
+	defer timer.Stop()
+	for {
+		select {
+		case <-f.flushDone:
 			return
+		case <-timer.C:
+			f.batchMu.Lock()
+			flushed, full := len(f.batch), f.fullBatches
+			f.fullBatches = 0
+			f.send(f.batch, "timer")
+			f.batch = nil
+			f.batchMu.Unlock()
+			if next := f.nextFlushInterval(interval, flushed, full); next != interval {
+				interval = next
+				forwardFlushInterval.WithLabelValues(f.Name).Set(interval.Seconds())
+			}
+			timer.Reset(interval)
 		}
-		client := &http.Client{}
-		resp, err := client.Do(r)
-		if err != nil {
-			logrus.WithError(err).Info("Error sending payload downstream")
+	}
+}
+
+func (f *Forwarder) adaptiveFlush() bool {
+	return f.MaxFlushInterval > 0 && f.BatchSize > 0
+}
+
+// nextFlushInterval returns the interval to wait after a timed flush
+// of flushed spans, when full batches were sent since the last one
+func (f *Forwarder) nextFlushInterval(interval time.Duration, flushed int, full int) time.Duration {
+	switch {
+	case !f.adaptiveFlush():
+		return interval
+	case full > 0:
+		return clampDuration(interval/2, f.MinFlushInterval, f.MaxFlushInterval)
+	case flushed < f.BatchSize/2:
+		return clampDuration(interval*2, f.MinFlushInterval, f.MaxFlushInterval)
+	default:
+		return interval
+	}
+}
+
+func clampDuration(d time.Duration, min time.Duration, max time.Duration) time.Duration {
+	if d < min {
+		return min
+	}
+	if d > max {
+		return max
+	}
+	return d
+}
+
+// Flush sends any spans buffered by SendSpans
+func (f *Forwarder) Flush() error {
+	return f.flush("flush")
+}
+
+// flush sends the buffered spans, observing trigger as what caused it
+func (f *Forwarder) flush(trigger string) error {
+	f.batchMu.Lock()
+	defer f.batchMu.Unlock()
+	spans := f.batch
+	f.batch = nil
+	return f.send(spans, trigger)
+}
+
+func (f *Forwarder) runWorker(queue chan Payload) {
+	for p := range queue {
+		f.dequeued(p)
+		if f.Delay > 0 {
+			time.Sleep(f.Delay)
+		}
+		if f.sendDownstream(p) {
 			continue
 		}
-		defer resp.Body.Close()
-		if resp.StatusCode != http.StatusAccepted {
-			responseBody, _ := ioutil.ReadAll(&io.LimitedReader{R: resp.Body, N: 1024})
-			logrus.WithField("status", resp.Status).
-				WithField("response", string(responseBody)).
-				Info("Error response sending payload downstream")
-			logrus.WithField("payload", string(p.Body)).Debug("Error response sending payload downstream")
+		if f.DeadLetterURL == nil {
+			continue
+		}
+		if sent, _ := f.post(f.DeadLetterURL, "to dead letter url", p, nil); sent {
+			deadLetterPayloads.WithLabelValues(f.Name, "sent").Inc()
+		} else {
+			deadLetterPayloads.WithLabelValues(f.Name, "failed").Inc()
 		}
 	}
 	f.wg.Done()
 }
 
+// SetCredentials sets the credentials sent to DownstreamURL, and its
+// replacement scheme and host if c.URL is set. Payloads already queued
+// are sent with the new credentials
+func (f *Forwarder) SetCredentials(c Credentials) {
+	f.credentialsMu.Lock()
+	defer f.credentialsMu.Unlock()
+	f.credentials = c
+}
+
+// downstream returns where to send payloads, and the credentials to
+// send them with
+func (f *Forwarder) downstream() (*url.URL, Credentials) {
+	f.credentialsMu.RLock()
+	defer f.credentialsMu.RUnlock()
+	if f.credentials.URL == nil {
+		return f.DownstreamURL, f.credentials
+	}
+	target := *f.DownstreamURL
+	target.Scheme = f.credentials.URL.Scheme
+	target.Host = f.credentials.URL.Host
+	return &target, f.credentials
+}
+
+// sendDownstream posts p to the collector, retrying transient failures
+// as Retry allows, and returns whether it was accepted
+func (f *Forwarder) sendDownstream(p Payload) bool {
+	for attempts := 1; ; attempts++ {
+		started := time.Now()
+		target, credentials := f.downstream()
+		sent, transient := f.post(target, "downstream", p, func(r *http.Request) {
+			credentials.authorize(r)
+			if f.RequestDecorator != nil {
+				f.RequestDecorator(r)
+			}
+		})
+		forwardDuration.WithLabelValues(f.Name).Observe(time.Since(started).Seconds())
+		if sent {
+			forwardRequests.WithLabelValues(f.Name, "success").Inc()
+			return true
+		}
+		if !transient || attempts >= f.Retry.MaxAttempts {
+			forwardRequests.WithLabelValues(f.Name, "error").Inc()
+			return false
+		}
+		forwardRequests.WithLabelValues(f.Name, "retry").Inc()
+		select {
+		case <-time.After(f.Retry.backoff(attempts)):
+		case <-f.done:
+			forwardRequests.WithLabelValues(f.Name, "error").Inc()
+			return false
+		}
+	}
+}
+
+// post sends p to target, logging any failure, and returns whether it
+// was accepted, and if not, whether the failure was transient: a
+// network error or 5xx response. decorate, if set, is applied to the
+// request last
+func (f *Forwarder) post(target *url.URL, destination string, p Payload, decorate func(*http.Request)) (sent bool, transient bool) {
+	r, err := http.NewRequest("POST", target.String(), bytes.NewReader(p.Body))
+	if err != nil {
+		f.errorLog.Info(logrus.WithError(err), "Error building request "+destination)
+		return false, false
+	}
+	r.Header.Set("Content-Type", p.ContentType)
+	r.Header.Set("User-Agent", f.UserAgent)
+	if len(f.SigningSecret) > 0 {
+		r.Header.Set("X-Signature", signature(f.SigningSecret, p.Body))
+	}
+	if decorate != nil {
+		decorate(r)
+	}
+	client := &http.Client{Transport: f.transport}
+	resp, err := client.Do(r)
+	if err != nil {
+		f.errorLog.Info(logrus.WithError(err), "Error sending payload "+destination)
+		return false, true
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		responseBody, _ := ioutil.ReadAll(&io.LimitedReader{R: resp.Body, N: 1024})
+		f.errorLog.Info(logrus.WithField("status", resp.Status).
+			WithField("response", string(responseBody)),
+			"Error response sending payload "+destination)
+		logrus.WithField("payload", string(p.Body)).Debug("Error response sending payload " + destination)
+		return false, resp.StatusCode >= 500
+	}
+	return true, false
+}
+
 func (f *Forwarder) Send(p Payload) error {
+	f.stopMu.RLock()
+	defer f.stopMu.RUnlock()
 	if f.stopped {
 		return errors.New("sink stopped")
 	}
+	f.mu.Lock()
+	if f.pending == nil {
+		f.pending = make(map[uint64]Payload)
+	}
+	f.seq++
+	p.seq = f.seq
+	f.pending[p.seq] = p
+	f.mu.Unlock()
 	select {
-	case f.payloads <- p:
+	case f.queueFor(p.TraceID) <- p:
 		return nil
 	default:
+		f.dequeued(p)
 		return errors.New("sink full")
 	}
 }
 
-func NewForwarder(collector string) (*Forwarder, error) {
-	downstreamURL, err := url.Parse(collector)
+// dequeued records that p has left the queue
+func (f *Forwarder) dequeued(p Payload) {
+	f.mu.Lock()
+	delete(f.pending, p.seq)
+	f.mu.Unlock()
+}
+
+// Queued returns the payloads waiting to be sent, oldest first
+func (f *Forwarder) Queued() []Payload {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	queued := make([]Payload, 0, len(f.pending))
+	for _, p := range f.pending {
+		queued = append(queued, p)
+	}
+	sort.Slice(queued, func(i, j int) bool {
+		return queued[i].seq < queued[j].seq
+	})
+	return queued
+}
+
+// QueueFill returns the fraction of the queue's capacity in use
+func (f *Forwarder) QueueFill() float64 {
+	capacity := 0
+	for _, queue := range f.payloads {
+		capacity += cap(queue)
+	}
+	if capacity == 0 {
+		return 0
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return float64(len(f.pending)) / float64(capacity)
+}
+
+// signature returns the X-Signature header value for body
+func signature(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return "hmac-sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// queueFor returns the queue that payloads for traceID are sent to
+func (f *Forwarder) queueFor(traceID string) chan Payload {
+	if len(f.payloads) == 1 {
+		return f.payloads[0]
+	}
+	h := fnv.New32a()
+	h.Write([]byte(traceID))
+	return f.payloads[h.Sum32()%uint32(len(f.payloads))]
+}
+
+// SendSpans serializes a batch of spans into a single Payload and
+// queues it, or with BatchSize or FlushInterval set, buffers them to
+// be sent with other spans. The queue only ever holds wire bytes, so
+// without batching callers should prefer sending whole batches over
+// calling SendSpans once per span. With PreserveTraceOrder, each
+// batch is split into a payload per trace
+func (f *Forwarder) SendSpans(spans []*span.Span) error {
+	if f.flushDone == nil {
+		return f.send(spans, "send")
+	}
+	// full batches are sent under batchMu, so that Stop can't refuse
+	// spans that have already been accepted into the batch
+	f.batchMu.Lock()
+	defer f.batchMu.Unlock()
+	if f.stopped {
+		return errors.New("sink stopped")
+	}
+	f.batch = append(f.batch, spans...)
+	for f.BatchSize > 0 && len(f.batch) >= f.BatchSize {
+		full := f.batch[:f.BatchSize:f.BatchSize]
+		f.batch = f.batch[f.BatchSize:]
+		f.fullBatches++
+		if err := f.send(full, "size"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// send queues spans, observing trigger as what caused them to be sent
+func (f *Forwarder) send(spans []*span.Span, trigger string) error {
+	if !f.PreserveTraceOrder {
+		return f.sendBatch(spans, "", trigger)
+	}
+	var traceIDs []string
+	traces := make(map[string][]*span.Span)
+	for _, s := range spans {
+		if _, ok := traces[s.TraceID]; !ok {
+			traceIDs = append(traceIDs, s.TraceID)
+		}
+		traces[s.TraceID] = append(traces[s.TraceID], s)
+	}
+	for _, traceID := range traceIDs {
+		if err := f.sendBatch(traces[traceID], traceID, trigger); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *Forwarder) sendBatch(spans []*span.Span, traceID string, trigger string) error {
+	if len(spans) == 0 {
+		return nil
+	}
+	if f.SortBatch {
+		spans = sortedByTimestamp(spans)
+	}
+	return f.sendEncoded(spans, traceID, trigger)
+}
+
+// sendEncoded splits spans into payloads that fit within MaxBatchBytes
+// and queues them. Each span is measured by encoding it alone, which
+// is never less than it adds to a batch. trigger labels the
+// forward_batch_spans observation, or is "bytes" if spans were split
+func (f *Forwarder) sendEncoded(spans []*span.Span, traceID string, trigger string) error {
+	if f.MaxBatchBytes <= 0 {
+		return f.queueEncoded(spans, traceID, trigger)
+	}
+	var chunks [][]*span.Span
+	var chunk []*span.Span
+	size := 0
+	var tooLarge error
+	for _, s := range spans {
+		p, err := f.encode([]*span.Span{s})
+		if err != nil {
+			return err
+		}
+		if len(p.Body) > f.MaxBatchBytes {
+			spansDropped.WithLabelValues("too_large").Inc()
+			tooLarge = fmt.Errorf("span %s of trace %s is %d bytes encoded, over the %d byte batch limit", s.ID, s.TraceID, len(p.Body), f.MaxBatchBytes)
+			continue
+		}
+		if len(chunk) > 0 && size+len(p.Body) > f.MaxBatchBytes {
+			chunks = append(chunks, chunk)
+			chunk, size = nil, 0
+		}
+		chunk = append(chunk, s)
+		size += len(p.Body)
+	}
+	if len(chunk) > 0 {
+		chunks = append(chunks, chunk)
+	}
+	if len(chunks) > 1 {
+		trigger = "bytes"
+	}
+	for _, chunk := range chunks {
+		if err := f.queueEncoded(chunk, traceID, trigger); err != nil {
+			return err
+		}
+	}
+	return tooLarge
+}
+
+// queueEncoded encodes spans as a single payload and queues it
+func (f *Forwarder) queueEncoded(spans []*span.Span, traceID string, trigger string) error {
+	p, err := f.encode(spans)
 	if err != nil {
-		return nil, fmt.Errorf("invalid downstream url %s", collector)
+		return err
 	}
+	p.TraceID = traceID
+	if err := f.Send(p); err != nil {
+		return err
+	}
+	forwardBatchSpans.WithLabelValues(f.Name, trigger).Observe(float64(len(spans)))
+	return nil
+}
+
+// sortedByTimestamp returns a copy of spans in timestamp order
+func sortedByTimestamp(spans []*span.Span) []*span.Span {
+	sorted := append([]*span.Span(nil), spans...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Timestamp.Before(sorted[j].Timestamp)
+	})
+	return sorted
+}
 
-	scheme := downstreamURL.Scheme
-	isHTTP := scheme == "http" || scheme == "https"
-	if !isHTTP {
-		return nil, fmt.Errorf("invalid downstream url %s. Must be prefixed with http:// or https://", collector)
+// encode serializes spans in the Forwarder's Format
+func (f *Forwarder) encode(spans []*span.Span) (Payload, error) {
+	if f.Format == FormatOTLP {
+		body, err := otlp.FromSpans(spans).Marshal()
+		return Payload{ContentType: "application/x-protobuf", Body: body}, err
 	}
+	body, err := f.JSON.Marshal(spans)
+	return Payload{ContentType: "application/json", Body: body}, err
+}
 
-	downstreamURL.Path = "/api/v1/spans"
+// SetFormat sets the format used by SendSpans and changes the
+// DownstreamURL path to match
+func (f *Forwarder) SetFormat(format string) error {
+	path, ok := formatPaths[format]
+	if !ok {
+		return fmt.Errorf("invalid forward format %s. Must be %s or %s", format, FormatZipkin, FormatOTLP)
+	}
+	f.Format = format
+	f.DownstreamURL.Path = path
+	return nil
+}
+
+// SetJSONSchema sets the schema FormatZipkin payloads are encoded in,
+// and the collector API path to match
+func (f *Forwarder) SetJSONSchema(schema string) error {
+	switch schema {
+	case span.SchemaV1:
+	case span.SchemaV2:
+		if f.Format == FormatZipkin || f.Format == "" {
+			f.DownstreamURL.Path = "/api/v2/spans"
+		}
+	default:
+		return fmt.Errorf("invalid forward json schema %s. Must be %s or %s", schema, span.SchemaV1, span.SchemaV2)
+	}
+	f.JSON.Schema = schema
+	return nil
+}
+
+func NewForwarder(collector string) (*Forwarder, error) {
+	downstreamURL, err := parseHTTPURL(collector)
+	if err != nil {
+		return nil, err
+	}
+	downstreamURL.Path = formatPaths[FormatZipkin]
 	forwarder := new(Forwarder)
 	forwarder.DownstreamURL = downstreamURL
 	return forwarder, nil
 }
+
+// parseHTTPURL parses an http or https URL to send payloads to
+func parseHTTPURL(raw string) (*url.URL, error) {
+	parsed, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid url %s", raw)
+	}
+	if parsed.Scheme != "http" && parsed.Scheme != "https" {
+		return nil, fmt.Errorf("invalid url %s. Must be prefixed with http:// or https://", raw)
+	}
+	return parsed, nil
+}
@@ -0,0 +1,656 @@
+package processor
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/willthames/opentracing-processor/span"
+)
+
+func benchmarkSpans(n int) []*span.Span {
+	spans := make([]*span.Span, n)
+	for i := range spans {
+		spans[i] = &span.Span{
+			TraceID:   "0000000000000001",
+			ID:        fmt.Sprintf("%016x", i+1),
+			Name:      "benchmark",
+			Timestamp: time.Unix(1480979203, 0),
+			Duration:  time.Millisecond,
+		}
+		spans[i].AddTag("http.status_code", "200")
+	}
+	return spans
+}
+
+func drainingForwarder() *Forwarder {
+	f := &Forwarder{payloads: []chan Payload{make(chan Payload, 4096)}}
+	go func() {
+		for p := range f.payloads[0] {
+			f.dequeued(p)
+		}
+	}()
+	return f
+}
+
+func BenchmarkSendPerSpan(b *testing.B) {
+	f := drainingForwarder()
+	defer close(f.payloads[0])
+	spans := benchmarkSpans(100)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, s := range spans {
+			body, _ := json.Marshal([]*span.Span{s})
+			f.Send(Payload{ContentType: "application/json", Body: body})
+		}
+	}
+}
+
+func BenchmarkSendSpans(b *testing.B) {
+	f := drainingForwarder()
+	defer close(f.payloads[0])
+	spans := benchmarkSpans(100)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		f.SendSpans(spans)
+	}
+}
+
+func TestPreserveTraceOrder(t *testing.T) {
+	var mu sync.Mutex
+	var received []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		mu.Lock()
+		received = append(received, string(body))
+		mu.Unlock()
+		if ua := r.Header.Get("User-Agent"); ua != "opentracing-processor/dev" {
+			t.Errorf("expected default user agent, got %q", ua)
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	f, err := NewForwarder(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.MaxConcurrency = 4
+	f.PreserveTraceOrder = true
+	f.Start()
+	for i := 0; i < 20; i++ {
+		if err := f.Send(Payload{ContentType: "application/json", Body: []byte(strconv.Itoa(i)), TraceID: "trace"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	f.Stop()
+
+	if len(received) != 20 {
+		t.Fatalf("expected 20 payloads, got %d", len(received))
+	}
+	for i, body := range received {
+		if body != strconv.Itoa(i) {
+			t.Errorf("payloads for a trace arrived out of order: %v", received)
+			break
+		}
+	}
+}
+
+func TestSignature(t *testing.T) {
+	// RFC 4231 test case 2
+	expected := "hmac-sha256=5bdcc146bf60754e6a042426089575c75a003f089d2739839dec58b964ec3843"
+	if sig := signature([]byte("Jefe"), []byte("what do ya want for nothing?")); sig != expected {
+		t.Errorf("expected signature %s, got %s", expected, sig)
+	}
+}
+
+func TestOTLPFormat(t *testing.T) {
+	received := make(chan *http.Request, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- r
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	f, err := NewForwarder(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.SetFormat("jaeger"); err == nil {
+		t.Errorf("expected an error for an unknown format")
+	}
+	if err := f.SetFormat(FormatOTLP); err != nil {
+		t.Fatal(err)
+	}
+	f.Start()
+	f.SendSpans(benchmarkSpans(2))
+	r := <-received
+	f.Stop()
+	if r.URL.Path != "/v1/traces" || r.Header.Get("Content-Type") != "application/x-protobuf" {
+		t.Errorf("unexpected otlp request %s %s", r.URL.Path, r.Header.Get("Content-Type"))
+	}
+}
+
+func TestDeadLetter(t *testing.T) {
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer collector.Close()
+	var mu sync.Mutex
+	var deadLetters []string
+	deadLetter := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		mu.Lock()
+		deadLetters = append(deadLetters, r.Header.Get("Content-Type")+" "+string(body))
+		mu.Unlock()
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer deadLetter.Close()
+
+	f, err := NewForwarder(collector.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.DeadLetterURL, err = parseHTTPURL(deadLetter.URL); err != nil {
+		t.Fatal(err)
+	}
+	f.Start()
+	f.Send(Payload{ContentType: "application/x-thrift", Body: []byte("spans")})
+	f.Stop()
+	if len(deadLetters) != 1 || deadLetters[0] != "application/x-thrift spans" {
+		t.Errorf("expected rejected payload to be sent to the dead letter url unchanged, got %v", deadLetters)
+	}
+}
+
+func TestSortedByTimestamp(t *testing.T) {
+	now := time.Now()
+	spans := []*span.Span{
+		{ID: "late", Timestamp: now.Add(time.Second)},
+		{ID: "early", Timestamp: now},
+		{ID: "middle", Timestamp: now.Add(time.Millisecond)},
+	}
+	sorted := sortedByTimestamp(spans)
+	if sorted[0].ID != "early" || sorted[1].ID != "middle" || sorted[2].ID != "late" {
+		t.Errorf("spans not sorted by timestamp: %s %s %s", sorted[0].ID, sorted[1].ID, sorted[2].ID)
+	}
+	if spans[0].ID != "late" {
+		t.Errorf("the caller's batch should be left in arrival order")
+	}
+}
+
+func TestMaxBatchBytes(t *testing.T) {
+	f := &Forwarder{payloads: []chan Payload{make(chan Payload, 16)}}
+	spans := benchmarkSpans(10)
+	whole, _ := json.Marshal(spans)
+	f.MaxBatchBytes = len(whole) / 3
+	if err := f.SendSpans(spans); err != nil {
+		t.Fatal(err)
+	}
+	close(f.payloads[0])
+	sent := 0
+	payloads := 0
+	for p := range f.payloads[0] {
+		if len(p.Body) > f.MaxBatchBytes {
+			t.Errorf("payload of %d bytes is over the %d byte limit", len(p.Body), f.MaxBatchBytes)
+		}
+		var batch []*span.Span
+		if err := json.Unmarshal(p.Body, &batch); err != nil {
+			t.Fatal(err)
+		}
+		sent += len(batch)
+		payloads++
+	}
+	if sent != len(spans) || payloads < 3 {
+		t.Errorf("expected all %d spans split over at least 3 payloads, got %d spans in %d", len(spans), sent, payloads)
+	}
+}
+
+func TestMaxBatchBytesDropsLargeSpan(t *testing.T) {
+	f := &Forwarder{payloads: []chan Payload{make(chan Payload, 16)}}
+	spans := benchmarkSpans(3)
+	small, _ := json.Marshal(spans[:1])
+	f.MaxBatchBytes = len(small) * 2
+	spans[1].Name = strings.Repeat("x", f.MaxBatchBytes)
+	before := metricTotal(spansDropped)
+	err := f.SendSpans(spans)
+	if err == nil || !strings.Contains(err.Error(), spans[1].ID) || !strings.Contains(err.Error(), "byte batch limit") {
+		t.Errorf("expected an error naming the span over the limit, got %v", err)
+	}
+	if dropped := metricTotal(spansDropped) - before; dropped != 1 {
+		t.Errorf("expected the large span to be counted as dropped, got %v", dropped)
+	}
+	close(f.payloads[0])
+	sent := 0
+	for p := range f.payloads[0] {
+		if len(p.Body) > f.MaxBatchBytes {
+			t.Errorf("payload of %d bytes is over the %d byte limit", len(p.Body), f.MaxBatchBytes)
+		}
+		var batch []*span.Span
+		if err := json.Unmarshal(p.Body, &batch); err != nil {
+			t.Fatal(err)
+		}
+		sent += len(batch)
+	}
+	if sent != 2 {
+		t.Errorf("expected the other 2 spans to be sent, got %d", sent)
+	}
+}
+
+func TestSetJSONSchema(t *testing.T) {
+	f, err := NewForwarder("http://collector:9411")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.SetJSONSchema("v3"); err == nil {
+		t.Errorf("expected an unknown schema to be rejected")
+	}
+	if err := f.SetJSONSchema(span.SchemaV2); err != nil {
+		t.Fatal(err)
+	}
+	if f.DownstreamURL.Path != "/api/v2/spans" || f.JSON.Schema != span.SchemaV2 {
+		t.Errorf("expected v2 spans to be sent to the v2 API, got %s", f.DownstreamURL)
+	}
+}
+
+func TestForwarderMetrics(t *testing.T) {
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer collector.Close()
+	f, err := NewForwarder(collector.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Name = "metrics-test"
+	f.MaxConcurrency = 1
+	f.Start()
+	f.Send(Payload{ContentType: "application/json", Body: []byte("[]")})
+	f.Stop()
+	if sent := metricTotal(forwardRequests.WithLabelValues("metrics-test", "success")); sent != 1 {
+		t.Errorf("expected one successful request labelled with the forwarder name, got %v", sent)
+	}
+}
+
+func TestRequestDecorator(t *testing.T) {
+	received := make(chan *http.Request, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- r
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	f, err := NewForwarder(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.SetCredentials(Credentials{Token: "static"})
+	f.RequestDecorator = func(r *http.Request) {
+		r.Header.Set("Authorization", "Bearer rotated")
+		r.Header.Set("X-Tenant", "mushroom-kingdom")
+	}
+	f.Start()
+	defer f.Stop()
+	f.SendSpans(benchmarkSpans(1))
+
+	r := <-received
+	if r.Header.Get("Authorization") != "Bearer rotated" || r.Header.Get("X-Tenant") != "mushroom-kingdom" {
+		t.Errorf("expected the decorator's headers to be sent last, got %v", r.Header)
+	}
+}
+
+func TestForwarderRetry(t *testing.T) {
+	var mu sync.Mutex
+	attempts := 0
+	received := make(chan struct{}, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		attempts++
+		n := attempts
+		mu.Unlock()
+		if n <= 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+		received <- struct{}{}
+	}))
+	defer server.Close()
+
+	f, err := NewForwarder(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Retry = RetryPolicy{MaxAttempts: 3, BaseBackoff: time.Millisecond}
+	f.Start()
+	defer f.Stop()
+	f.SendSpans(benchmarkSpans(1))
+	select {
+	case <-received:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the span to land after two failures")
+	}
+}
+
+func TestForwarderRetryClientError(t *testing.T) {
+	var mu sync.Mutex
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		attempts++
+		mu.Unlock()
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	f, err := NewForwarder(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Retry = RetryPolicy{MaxAttempts: 3, BaseBackoff: time.Millisecond}
+	f.Start()
+	f.SendSpans(benchmarkSpans(1))
+	f.Stop()
+	mu.Lock()
+	defer mu.Unlock()
+	if attempts != 1 {
+		t.Errorf("expected a 4xx not to be retried, got %d attempts", attempts)
+	}
+}
+
+func TestForwarderStopInterruptsBackoff(t *testing.T) {
+	attempted := make(chan struct{}, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+		attempted <- struct{}{}
+	}))
+	defer server.Close()
+
+	f, err := NewForwarder(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Retry = RetryPolicy{MaxAttempts: 5, BaseBackoff: time.Hour, MaxBackoff: time.Hour}
+	f.Start()
+	f.SendSpans(benchmarkSpans(1))
+	<-attempted
+	stopped := make(chan struct{})
+	go func() {
+		f.Stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected Stop to cut the retry backoff short")
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	r := RetryPolicy{BaseBackoff: 100 * time.Millisecond, MaxBackoff: time.Second}
+	for attempts, expected := range map[int]time.Duration{1: 100 * time.Millisecond, 2: 200 * time.Millisecond, 4: 800 * time.Millisecond, 10: time.Second} {
+		if backoff := r.backoff(attempts); backoff != expected {
+			t.Errorf("expected a backoff of %v after %d attempts, got %v", expected, attempts, backoff)
+		}
+	}
+}
+
+// batchRecorder is a collector that reports the number of spans in
+// each request it receives
+func batchRecorder(t *testing.T) (*httptest.Server, chan int) {
+	batches := make(chan int, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var spans []json.RawMessage
+		if err := json.NewDecoder(r.Body).Decode(&spans); err != nil {
+			t.Error(err)
+		}
+		w.WriteHeader(http.StatusAccepted)
+		batches <- len(spans)
+	}))
+	return server, batches
+}
+
+func TestForwardBatchSize(t *testing.T) {
+	server, batches := batchRecorder(t)
+	defer server.Close()
+
+	f, err := NewForwarder(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.BatchSize = 3
+	f.FlushInterval = time.Hour
+	f.Start()
+	defer f.Stop()
+	for i := 0; i < 2; i++ {
+		if err := f.SendSpans(benchmarkSpans(1)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	select {
+	case n := <-batches:
+		t.Fatalf("expected spans to wait for a full batch, got a batch of %d", n)
+	case <-time.After(50 * time.Millisecond):
+	}
+	if err := f.SendSpans(benchmarkSpans(4)); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		select {
+		case n := <-batches:
+			if n != 3 {
+				t.Errorf("expected a batch of 3 spans, got %d", n)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("expected full batches to be sent")
+		}
+	}
+	select {
+	case n := <-batches:
+		t.Fatalf("expected the last span to wait for its batch, got a batch of %d", n)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestForwardFlushInterval(t *testing.T) {
+	server, batches := batchRecorder(t)
+	defer server.Close()
+
+	f, err := NewForwarder(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.BatchSize = 100
+	f.FlushInterval = 20 * time.Millisecond
+	f.Start()
+	defer f.Stop()
+	if err := f.SendSpans(benchmarkSpans(2)); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case n := <-batches:
+		if n != 2 {
+			t.Errorf("expected a batch of 2 spans, got %d", n)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the flush interval to send a partial batch")
+	}
+}
+
+func TestForwardStopFlushesBatch(t *testing.T) {
+	server, batches := batchRecorder(t)
+	defer server.Close()
+
+	f, err := NewForwarder(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.BatchSize = 100
+	f.FlushInterval = time.Hour
+	f.Start()
+	if err := f.SendSpans(benchmarkSpans(5)); err != nil {
+		t.Fatal(err)
+	}
+	f.Stop()
+	select {
+	case n := <-batches:
+		if n != 5 {
+			t.Errorf("expected a batch of 5 spans, got %d", n)
+		}
+	default:
+		t.Fatal("expected Stop to send the partial batch")
+	}
+	if err := f.SendSpans(benchmarkSpans(1)); err == nil {
+		t.Error("expected spans sent after Stop to be refused")
+	}
+}
+
+func TestForwardStopLosesNoSpans(t *testing.T) {
+	var mu sync.Mutex
+	received := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var spans []json.RawMessage
+		json.NewDecoder(r.Body).Decode(&spans)
+		mu.Lock()
+		received += len(spans)
+		mu.Unlock()
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	f, err := NewForwarder(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.BatchSize = 7
+	f.FlushInterval = time.Hour
+	f.Start()
+	var wg sync.WaitGroup
+	accepted := make([]int, 4)
+	for i := range accepted {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for f.SendSpans(benchmarkSpans(1)) == nil {
+				accepted[i]++
+			}
+		}(i)
+	}
+	time.Sleep(20 * time.Millisecond)
+	f.Stop()
+	wg.Wait()
+	total := 0
+	for _, n := range accepted {
+		total += n
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if total == 0 || received != total {
+		t.Errorf("expected all %d accepted spans to be sent, got %d", total, received)
+	}
+}
+
+func TestForwardSendDuringStop(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	f, err := NewForwarder(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Start()
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				err := f.SendSpans(benchmarkSpans(1))
+				if err != nil && strings.Contains(err.Error(), "sink stopped") {
+					return
+				}
+			}
+		}()
+	}
+	time.Sleep(20 * time.Millisecond)
+	if err := f.Stop(); err != nil {
+		t.Errorf("expected Stop to succeed, got %v", err)
+	}
+	wg.Wait()
+}
+
+func TestForwardStopReturnsFlushError(t *testing.T) {
+	f, err := NewForwarder("http://localhost")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a queue nothing reads from can't take the last batch
+	f.payloads = []chan Payload{make(chan Payload)}
+	f.batch = benchmarkSpans(1)
+	if err := f.Stop(); err == nil || err.Error() != "sink full" {
+		t.Errorf("expected Stop to return the last batch's error, got %v", err)
+	}
+}
+
+func TestNextFlushInterval(t *testing.T) {
+	f := &Forwarder{BatchSize: 10, MinFlushInterval: 10 * time.Millisecond, MaxFlushInterval: time.Second}
+	for _, c := range []struct {
+		interval time.Duration
+		flushed  int
+		full     int
+		expected time.Duration
+	}{
+		{100 * time.Millisecond, 1, 0, 200 * time.Millisecond},
+		{800 * time.Millisecond, 0, 0, time.Second},
+		{100 * time.Millisecond, 5, 0, 100 * time.Millisecond},
+		{100 * time.Millisecond, 3, 2, 50 * time.Millisecond},
+		{15 * time.Millisecond, 0, 1, 10 * time.Millisecond},
+	} {
+		if got := f.nextFlushInterval(c.interval, c.flushed, c.full); got != c.expected {
+			t.Errorf("after flushing %d spans and %d full batches every %v, expected %v, got %v", c.flushed, c.full, c.interval, c.expected, got)
+		}
+	}
+	fixed := &Forwarder{BatchSize: 10}
+	if got := fixed.nextFlushInterval(time.Second, 0, 0); got != time.Second {
+		t.Errorf("expected a fixed interval without MaxFlushInterval, got %v", got)
+	}
+}
+
+func TestAdaptiveFlushInterval(t *testing.T) {
+	server, _ := batchRecorder(t)
+	defer server.Close()
+
+	f, err := NewForwarder(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Name = "adaptive"
+	f.BatchSize = 10
+	f.FlushInterval = time.Millisecond
+	f.MinFlushInterval = 5 * time.Millisecond
+	f.MaxFlushInterval = 40 * time.Millisecond
+	f.Start()
+	defer f.Stop()
+	interval := func() float64 {
+		var m dto.Metric
+		forwardFlushInterval.WithLabelValues("adaptive").Write(&m)
+		return m.GetGauge().GetValue()
+	}
+	for deadline := time.Now().Add(5 * time.Second); interval() != 0.04; {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected an idle forwarder's flush interval to grow to the maximum, got %vs", interval())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
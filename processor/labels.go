@@ -0,0 +1,45 @@
+package processor
+
+import "sync"
+
+const (
+	// otherLabel replaces label values beyond a labelLimiter's Max
+	otherLabel = "other"
+	// unknownService labels spans with no service name
+	unknownService = "unknown"
+)
+
+// labelLimiter bounds the number of distinct values used for a metric
+// label, such as service names sent by clients. The first Max values
+// seen are used as they are, and any others are collapsed into
+// otherLabel
+type labelLimiter struct {
+	Max  int
+	mu   sync.Mutex
+	seen map[string]bool
+}
+
+// value returns the label value to use for v
+func (l *labelLimiter) value(v string) string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.seen[v] {
+		return v
+	}
+	if len(l.seen) >= l.Max {
+		return otherLabel
+	}
+	if l.seen == nil {
+		l.seen = make(map[string]bool)
+	}
+	l.seen[v] = true
+	return v
+}
+
+// service returns the label value to use for a span's service name
+func (l *labelLimiter) service(name string) string {
+	if name == "" {
+		return unknownService
+	}
+	return l.value(name)
+}
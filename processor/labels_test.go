@@ -0,0 +1,21 @@
+package processor
+
+import "testing"
+
+func TestLabelLimiter(t *testing.T) {
+	l := &labelLimiter{Max: 2}
+	for _, v := range []string{"a", "b", "a"} {
+		if got := l.value(v); got != v {
+			t.Errorf("expected %q within the limit to be kept, got %q", v, got)
+		}
+	}
+	if got := l.value("c"); got != otherLabel {
+		t.Errorf("expected value beyond the limit to be %q, got %q", otherLabel, got)
+	}
+	if got := l.service(""); got != unknownService {
+		t.Errorf("expected empty service to be %q, got %q", unknownService, got)
+	}
+	if got := l.value("b"); got != "b" {
+		t.Errorf("expected value seen before the limit to still be kept, got %q", got)
+	}
+}
@@ -0,0 +1,123 @@
+package processor
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/willthames/opentracing-processor/span"
+)
+
+// lazyForwarder is a SpanForwarder that keeps trying to create its
+// real forwarder in the background. Anything sent before that
+// succeeds is dropped
+type lazyForwarder struct {
+	create   func() (SpanForwarder, error)
+	interval time.Duration
+
+	mu        sync.RWMutex
+	forwarder SpanForwarder
+	done      chan struct{}
+	wg        sync.WaitGroup
+	errorLog  *rateLimitedLog
+}
+
+func newLazyForwarder(create func() (SpanForwarder, error), interval time.Duration) *lazyForwarder {
+	return &lazyForwarder{create: create, interval: interval, errorLog: newRateLimitedLog(time.Minute)}
+}
+
+func (l *lazyForwarder) Start() error {
+	l.done = make(chan struct{})
+	l.wg.Add(1)
+	go l.run()
+	return nil
+}
+
+func (l *lazyForwarder) run() {
+	defer l.wg.Done()
+	for {
+		forwarder, err := l.create()
+		if err == nil {
+			forwarder.Start()
+			l.mu.Lock()
+			l.forwarder = forwarder
+			l.mu.Unlock()
+			logrus.Info("Forwarder is ready")
+			return
+		}
+		l.errorLog.Info(logrus.WithError(err), "Error creating forwarder, will retry")
+		select {
+		case <-l.done:
+			return
+		case <-time.After(l.interval):
+		}
+	}
+}
+
+func (l *lazyForwarder) Stop() error {
+	if l.done != nil {
+		close(l.done)
+		l.wg.Wait()
+	}
+	l.errorLog.Flush()
+	if forwarder := l.current(); forwarder != nil {
+		return forwarder.Stop()
+	}
+	return nil
+}
+
+func (l *lazyForwarder) current() SpanForwarder {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.forwarder
+}
+
+// Queued returns the real forwarder's queue, if it has been created
+func (l *lazyForwarder) Queued() []Payload {
+	if inspector, ok := l.current().(queueInspector); ok {
+		return inspector.Queued()
+	}
+	return nil
+}
+
+// QueueFill returns how full the real forwarder's queue is, if it has
+// been created
+func (l *lazyForwarder) QueueFill() float64 {
+	if monitor, ok := l.current().(queueMonitor); ok {
+		return monitor.QueueFill()
+	}
+	return 0
+}
+
+// Flush flushes the real forwarder, if it has been created and buffers
+// spans
+func (l *lazyForwarder) Flush() error {
+	if f, ok := l.current().(flusher); ok {
+		return f.Flush()
+	}
+	return nil
+}
+
+// SetCredentials sets the real forwarder's credentials, if it has been
+// created. A forwarder created later reads the credentials file itself
+func (l *lazyForwarder) SetCredentials(c Credentials) {
+	if f, ok := l.current().(credentialsSetter); ok {
+		f.SetCredentials(c)
+	}
+}
+
+func (l *lazyForwarder) Send(p Payload) error {
+	if forwarder := l.current(); forwarder != nil {
+		return forwarder.Send(p)
+	}
+	return errors.New("forwarder unavailable")
+}
+
+func (l *lazyForwarder) SendSpans(spans []*span.Span) error {
+	if forwarder := l.current(); forwarder != nil {
+		return forwarder.SendSpans(spans)
+	}
+	spansDropped.WithLabelValues("forwarder_unavailable").Add(float64(len(spans)))
+	return errors.New("forwarder unavailable")
+}
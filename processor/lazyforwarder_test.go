@@ -0,0 +1,39 @@
+package processor
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/willthames/opentracing-processor/span"
+)
+
+func TestLazyForwarder(t *testing.T) {
+	memory := new(MemoryForwarder)
+	var attempts int32
+	l := newLazyForwarder(func() (SpanForwarder, error) {
+		if atomic.AddInt32(&attempts, 1) < 3 {
+			return nil, errors.New("no such host")
+		}
+		return memory, nil
+	}, time.Millisecond)
+
+	if err := l.SendSpans([]*span.Span{{TraceID: "1"}}); err == nil {
+		t.Errorf("expected spans to be dropped before the forwarder is ready")
+	}
+	l.Start()
+	defer l.Stop()
+	for i := 0; l.current() == nil; i++ {
+		if i > 1000 {
+			t.Fatal("forwarder never became ready")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if err := l.SendSpans([]*span.Span{{TraceID: "2"}}); err != nil {
+		t.Errorf("unexpected error once forwarder is ready: %v", err)
+	}
+	if spans := memory.Spans(); len(spans) != 1 || spans[0].TraceID != "2" {
+		t.Errorf("expected only the span sent once ready to be forwarded, got %v", spans)
+	}
+}
@@ -0,0 +1,98 @@
+package processor
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+
+	"github.com/willthames/opentracing-processor/span"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// mappingNameTarget is the mapping rule target that sets the span name
+const mappingNameTarget = "name"
+
+// mappingRule copies the value of the first tag in From that a span
+// has to To, which is either a tag key or "name" for the span name.
+// Unless Overwrite is set, rules don't replace an existing value
+type mappingRule struct {
+	From      []string `json:"from" yaml:"from"`
+	To        string   `json:"to" yaml:"to"`
+	Overwrite bool     `json:"overwrite" yaml:"overwrite"`
+}
+
+// mappingTransformer applies mapping rules, in order, to every span
+type mappingTransformer struct {
+	Rules []mappingRule
+}
+
+// loadMapping reads mapping rules from a YAML or JSON file, chosen by
+// the file extension
+func loadMapping(path string) (*mappingTransformer, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading mapping file: %v", err)
+	}
+	var rules []mappingRule
+	switch filepath.Ext(path) {
+	case ".yaml", ".yml":
+		err = yaml.UnmarshalStrict(data, &rules)
+	default:
+		err = json.Unmarshal(data, &rules)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error parsing mapping file %s: %v", path, err)
+	}
+	for i, rule := range rules {
+		if len(rule.From) == 0 || rule.To == "" {
+			return nil, fmt.Errorf("mapping rule %d in %s needs both from and to", i+1, path)
+		}
+	}
+	return &mappingTransformer{Rules: rules}, nil
+}
+
+func (m *mappingTransformer) TransformSpans(spans []*span.Span) []*span.Span {
+	for _, s := range spans {
+		for _, rule := range m.Rules {
+			rule.apply(s)
+		}
+	}
+	return spans
+}
+
+func (rule mappingRule) apply(s *span.Span) {
+	source := findTag(s, rule.From)
+	if source == nil {
+		return
+	}
+	if rule.To == mappingNameTarget {
+		if s.Name == "" || rule.Overwrite {
+			s.Name = fmt.Sprint(source.Value)
+		}
+		return
+	}
+	if target := findTag(s, []string{rule.To}); target != nil {
+		if rule.Overwrite {
+			target.Value = source.Value
+			target.AnnotationType = source.AnnotationType
+		}
+		return
+	}
+	tag := *source
+	tag.Key = rule.To
+	s.BinaryAnnotations = append(s.BinaryAnnotations, tag)
+}
+
+// findTag returns the first binary annotation with any of keys, in
+// order of preference
+func findTag(s *span.Span, keys []string) *span.BinaryAnnotation {
+	for _, key := range keys {
+		for i := range s.BinaryAnnotations {
+			if s.BinaryAnnotations[i].Key == key {
+				return &s.BinaryAnnotations[i]
+			}
+		}
+	}
+	return nil
+}
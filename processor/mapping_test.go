@@ -0,0 +1,62 @@
+package processor
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/willthames/opentracing-processor/span"
+)
+
+func writeMapping(t *testing.T, dir, name, content string) string {
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestMapping(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mapping")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	yamlPath := writeMapping(t, dir, "mapping.yaml", `
+- from: [http.route, http.target]
+  to: name
+- from: [http.method]
+  to: method
+`)
+	jsonPath := writeMapping(t, dir, "mapping.json", `[{"from":["http.route","http.target"],"to":"name"},{"from":["http.method"],"to":"method"}]`)
+
+	for _, path := range []string{yamlPath, jsonPath} {
+		mapping, err := loadMapping(path)
+		if err != nil {
+			t.Fatalf("error loading %s: %v", path, err)
+		}
+		unnamed := &span.Span{}
+		unnamed.AddTag("http.target", "/users/1")
+		unnamed.AddTag("http.method", "GET")
+		named := &span.Span{Name: "get user"}
+		named.AddTag("http.route", "/users/:id")
+		mapping.TransformSpans([]*span.Span{unnamed, named})
+
+		if unnamed.Name != "/users/1" {
+			t.Errorf("%s: expected name from fallback tag, got %q", path, unnamed.Name)
+		}
+		if named.Name != "get user" {
+			t.Errorf("%s: existing name should not be overwritten, got %q", path, named.Name)
+		}
+		if tag := findTag(unnamed, []string{"method"}); tag == nil || tag.Value != "GET" {
+			t.Errorf("%s: expected tag to be copied, got %v", path, unnamed.BinaryAnnotations)
+		}
+	}
+
+	badPath := writeMapping(t, dir, "bad.yaml", "- to: name\n")
+	if _, err := loadMapping(badPath); err == nil {
+		t.Errorf("expected error for rule without from")
+	}
+}
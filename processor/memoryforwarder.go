@@ -0,0 +1,62 @@
+package processor
+
+import (
+	"sync"
+
+	"github.com/willthames/opentracing-processor/span"
+)
+
+// MemoryForwarder is a SpanForwarder that records everything it is
+// sent rather than forwarding it, for use in tests. It is safe for
+// concurrent use
+type MemoryForwarder struct {
+	mu       sync.Mutex
+	payloads []Payload
+	spans    []*span.Span
+}
+
+func (m *MemoryForwarder) Start() error {
+	return nil
+}
+
+func (m *MemoryForwarder) Stop() error {
+	return nil
+}
+
+// Send records a payload
+func (m *MemoryForwarder) Send(p Payload) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.payloads = append(m.payloads, p)
+	return nil
+}
+
+// SendSpans records spans
+func (m *MemoryForwarder) SendSpans(spans []*span.Span) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.spans = append(m.spans, spans...)
+	return nil
+}
+
+// Payloads returns the payloads passed to Send so far
+func (m *MemoryForwarder) Payloads() []Payload {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Payload(nil), m.payloads...)
+}
+
+// Spans returns the spans passed to SendSpans so far
+func (m *MemoryForwarder) Spans() []*span.Span {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]*span.Span(nil), m.spans...)
+}
+
+// Reset forgets everything sent so far
+func (m *MemoryForwarder) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.payloads = nil
+	m.spans = nil
+}
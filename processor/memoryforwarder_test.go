@@ -0,0 +1,43 @@
+package processor
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/willthames/opentracing-processor/span"
+)
+
+// forwardingReceiver forwards every span it receives, as a minimal
+// processor would
+type forwardingReceiver struct {
+	app *App
+}
+
+func (fr *forwardingReceiver) ReceiveSpan(s *span.Span) {
+	fr.app.Forwarder.SendSpans([]*span.Span{s})
+}
+
+func TestMemoryForwarder(t *testing.T) {
+	forwarder := new(MemoryForwarder)
+	app := &App{Forwarder: forwarder}
+	receiver := &forwardingReceiver{app: app}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			receiver.ReceiveSpan(&span.Span{TraceID: "1"})
+		}()
+	}
+	wg.Wait()
+	forwarder.Send(Payload{ContentType: "application/json", Body: []byte("[]")})
+
+	if len(forwarder.Spans()) != 10 || len(forwarder.Payloads()) != 1 {
+		t.Errorf("expected 10 spans and 1 payload, got %d and %d", len(forwarder.Spans()), len(forwarder.Payloads()))
+	}
+	forwarder.Reset()
+	if len(forwarder.Spans()) != 0 {
+		t.Errorf("reset should forget spans")
+	}
+}
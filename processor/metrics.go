@@ -0,0 +1,113 @@
+package processor
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	ingestBytes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "ingest_bytes_total",
+		Help: "Number of bytes of (decompressed) span data received",
+	}, []string{"content_type"})
+	ingestCompressionRatio = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "ingest_compression_ratio",
+		Help:    "Ratio of decompressed to compressed size of gzipped span requests",
+		Buckets: prometheus.LinearBuckets(1, 2, 10),
+	})
+	ingestDecompressDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "ingest_decompress_duration_seconds",
+		Help:    "Time spent decompressing each gzipped span request",
+		Buckets: prometheus.ExponentialBuckets(0.0001, 4, 8),
+	})
+	spansReceived = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "spans_received_total",
+		Help: "Number of spans successfully decoded from ingest requests",
+	}, []string{"content_type"})
+	serviceSpansReceived = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "service_spans_received_total",
+		Help: "Number of spans successfully decoded from ingest requests, by reporting service",
+	}, []string{"service"})
+	spansInvalid = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "spans_invalid_total",
+		Help: "Number of decoded spans that failed validation, whether or not they were rejected",
+	}, []string{"reason"})
+	spansDropped = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "spans_dropped_total",
+		Help: "Number of spans dropped by the processing pipeline",
+	}, []string{"reason"})
+	spansMissingTiming = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "spans_missing_timing_total",
+		Help: "Number of spans received without a timestamp or duration, by the action taken",
+	}, []string{"action"})
+	spansTruncated = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "spans_truncated_total",
+		Help: "Number of spans that had data removed by the processing pipeline",
+	}, []string{"reason"})
+	sampleFraction = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "sample_fraction",
+		Help: "Fraction of traces currently kept by the adaptive sampler to approximate --target-spans-per-second",
+	})
+	sampledDebugSpans = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "sample_debug_spans_total",
+		Help: "Number of spans the adaptive sampler kept regardless of the sample fraction because they have the debug flag",
+	})
+	redSpans = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "operation_spans_total",
+		Help: "Number of spans received for each service and operation, with --red-metrics",
+	}, []string{"service", "operation", "kind"})
+	redErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "operation_errors_total",
+		Help: "Number of spans with an error tag received for each service and operation, with --red-metrics",
+	}, []string{"service", "operation", "kind"})
+	redDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "operation_duration_seconds",
+		Help: "Duration of spans received for each service and operation, with --red-metrics",
+	}, []string{"service", "operation", "kind"})
+	forwardBatchSpans = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "forward_batch_spans",
+		Help:    "Number of spans in each batch sent to each forwarder's queue, by what triggered the flush",
+		Buckets: prometheus.ExponentialBuckets(1, 2, 13),
+	}, []string{"forwarder", "trigger"})
+	forwardFlushInterval = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "forward_flush_interval_seconds",
+		Help: "Current interval between timed flushes of batched spans, by forwarder",
+	}, []string{"forwarder"})
+	spansPerTrace = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "spans_per_trace",
+		Help:    "Number of spans seen for each trace within --spans-per-trace-window",
+		Buckets: prometheus.ExponentialBuckets(1, 2, 13),
+	})
+	forwardRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "forward_requests_total",
+		Help: "Number of payloads sent by each forwarder, by result",
+	}, []string{"forwarder", "result"})
+	forwardDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "forward_request_duration_seconds",
+		Help: "Time taken by each forwarder to send a payload",
+	}, []string{"forwarder"})
+	deadLetterPayloads = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "dead_letter_payloads_total",
+		Help: "Number of payloads each forwarder's downstream failed to accept that were sent to the dead letter url, by result",
+	}, []string{"forwarder", "result"})
+	clientCancelledIngests = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "ingest_client_cancelled_total",
+		Help: "Number of span ingest requests abandoned because the client went away",
+	})
+	handlerPanics = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "ingest_panics_total",
+		Help: "Number of span ingest requests that failed because of a panic while handling them",
+	})
+	backgroundPanics = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "background_panics_total",
+		Help: "Number of panics recovered while passing spans on outside of a request, by component",
+	}, []string{"component"})
+	policyLookups = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "policy_lookups_total",
+		Help: "Number of trace decisions requested from the policy service, by result",
+	}, []string{"result"})
+	tailSampledTraces = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "tail_sampling_traces_total",
+		Help: "Number of traces the tail sampler has made a decision on",
+	}, []string{"decision"})
+)
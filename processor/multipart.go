@@ -0,0 +1,76 @@
+package processor
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+
+	"github.com/apache/thrift/lib/go/thrift"
+)
+
+// decodableTypes are the content types handleSpans can decode
+var decodableTypes = map[string]bool{
+	"application/json":       true,
+	"application/x-ndjson":   true,
+	"application/x-thrift":   true,
+	"application/x-protobuf": true,
+}
+
+// multipartSpans returns the contents and content type of the first
+// file in a multipart/form-data body, ignoring any other form fields.
+// The file's content type is taken from its part header if it is one
+// we can decode, otherwise it is detected from the contents
+func multipartSpans(data []byte, boundary string) ([]byte, string, error) {
+	reader := multipart.NewReader(bytes.NewReader(data), boundary)
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return nil, "", errors.New("no file in multipart form")
+		}
+		if err != nil {
+			return nil, "", err
+		}
+		if part.FileName() == "" {
+			continue
+		}
+		body, err := ioutil.ReadAll(part)
+		if err != nil {
+			return nil, "", err
+		}
+		contentType, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type"))
+		if !decodableTypes[contentType] {
+			contentType = detectContentType(body)
+		}
+		return body, contentType, nil
+	}
+}
+
+// detectContentType guesses whether data is a JSON array of spans,
+// newline delimited JSON spans or a thrift list of spans, assuming
+// thrift if it can't tell
+func detectContentType(data []byte) string {
+	if contentType := sniffContentType(data); contentType != "" {
+		return contentType
+	}
+	return "application/x-thrift"
+}
+
+// sniffContentType is as detectContentType, but returns an empty
+// string unless data looks like one of the formats. Thrift lists of
+// spans start with the element type, which is struct
+func sniffContentType(data []byte) string {
+	trimmed := bytes.TrimLeft(data, " \t\r\n")
+	switch {
+	case len(trimmed) > 0 && trimmed[0] == '[':
+		return "application/json"
+	case len(trimmed) > 0 && trimmed[0] == '{':
+		return "application/x-ndjson"
+	case len(data) > 0 && thrift.TType(data[0]) == thrift.STRUCT:
+		return "application/x-thrift"
+	default:
+		return ""
+	}
+}
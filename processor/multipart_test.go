@@ -0,0 +1,74 @@
+package processor
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMultipartUpload(t *testing.T) {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	form.WriteField("comment", "captured from staging")
+	file, _ := form.CreateFormFile("spans", "spans.ndjson")
+	file.Write([]byte("{\"traceId\":\"1\",\"id\":\"1\"}\n{\"traceId\":\"1\",\"id\":\"2\"}\n"))
+	form.Close()
+
+	receiver := new(recordingReceiver)
+	app := &App{Receiver: receiver}
+	r := httptest.NewRequest("POST", "/api/v1/spans", &body)
+	r.Header.Set("Content-Type", form.FormDataContentType())
+	w := httptest.NewRecorder()
+	app.handleSpans(w, r)
+	if w.Code != http.StatusAccepted || len(receiver.spans) != 2 {
+		t.Errorf("expected both spans from uploaded file, got status %d and %d spans", w.Code, len(receiver.spans))
+	}
+
+	body.Reset()
+	form = multipart.NewWriter(&body)
+	form.WriteField("comment", "no file")
+	form.Close()
+	r = httptest.NewRequest("POST", "/api/v1/spans", &body)
+	r.Header.Set("Content-Type", form.FormDataContentType())
+	w = httptest.NewRecorder()
+	app.handleSpans(w, r)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for a form with no file, got %d", w.Code)
+	}
+}
+
+func TestDetectContentType(t *testing.T) {
+	for data, expected := range map[string]string{
+		" [{\"id\":\"1\"}]": "application/json",
+		"{\"id\":\"1\"}\n":  "application/x-ndjson",
+		"\x0c\x00\x00\x00":  "application/x-thrift",
+	} {
+		if got := detectContentType([]byte(data)); got != expected {
+			t.Errorf("expected %q to be detected as %s, got %s", data, expected, got)
+		}
+	}
+}
+
+func TestAutodetectFormat(t *testing.T) {
+	receiver := new(recordingReceiver)
+	app := &App{Receiver: receiver}
+	post := func() int {
+		r := httptest.NewRequest("POST", "/api/v1/spans", bytes.NewReader([]byte(`[{"traceId":"1","id":"1"}]`)))
+		r.Header.Set("Content-Type", "application/x-thrift")
+		w := httptest.NewRecorder()
+		app.handleSpans(w, r)
+		return w.Code
+	}
+	if code := post(); code != http.StatusBadRequest {
+		t.Errorf("expected mislabeled spans to be rejected by default, got %d", code)
+	}
+	app.autodetectFormat = true
+	if code := post(); code != http.StatusAccepted || len(receiver.spans) != 1 {
+		t.Errorf("expected mislabeled spans to be decoded as json, got status %d and %d spans", code, len(receiver.spans))
+	}
+	if got := sniffContentType([]byte("spans")); got != "" {
+		t.Errorf("expected unrecognisable data not to be sniffed, got %s", got)
+	}
+}
@@ -0,0 +1,101 @@
+package processor
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/willthames/opentracing-processor/otlp"
+)
+
+// keyList is a flag.Value for a comma separated list of keys
+type keyList []string
+
+func (k *keyList) String() string {
+	if k == nil {
+		return ""
+	}
+	return strings.Join(*k, ",")
+}
+
+func (k *keyList) Set(value string) error {
+	for _, key := range strings.Split(value, ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			*k = append(*k, key)
+		}
+	}
+	return nil
+}
+
+// writeOTLPResponse answers an OTLP/HTTP export with the 200 and
+// encoded response OTLP exporters expect. Spans dropped for missing
+// required fields, or by transformers such as filters and samplers,
+// are reported as a partial success
+func writeOTLPResponse(w http.ResponseWriter, missing int, filtered int) {
+	response := new(otlp.ExportTraceServiceResponse)
+	if filtered < 0 {
+		// transformers may add spans as well as drop them
+		filtered = 0
+	}
+	var reasons []string
+	if missing > 0 {
+		reasons = append(reasons, fmt.Sprintf("%s missing required fields", pluralSpans(missing)))
+	}
+	if filtered > 0 {
+		reasons = append(reasons, fmt.Sprintf("%s dropped by filters or sampling", pluralSpans(filtered)))
+	}
+	if len(reasons) > 0 {
+		response.PartialSuccess = &otlp.ExportTracePartialSuccess{
+			RejectedSpans: int64(missing + filtered),
+			ErrorMessage:  strings.Join(reasons, "; "),
+		}
+	}
+	body, _ := response.Marshal()
+	w.Header().Set("Content-Type", "application/x-protobuf")
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
+
+// isOTLPProtobuf reports whether r is a protobuf encoded OTLP/HTTP
+// export, whose errors must be protobuf too
+func isOTLPProtobuf(r *http.Request) bool {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return r.URL.Path == "/v1/traces" && mediaType == "application/x-protobuf"
+}
+
+// writeOTLPError answers an OTLP/HTTP export with status and a
+// protobuf google.rpc.Status body, as OTLP exporters expect
+func writeOTLPError(w http.ResponseWriter, status int, message string) {
+	body, _ := (&otlp.RPCStatus{Code: grpcCode(status), Message: message}).Marshal()
+	w.Header().Set("Content-Type", "application/x-protobuf")
+	w.WriteHeader(status)
+	w.Write(body)
+}
+
+// grpcCode returns the gRPC status code closest to an HTTP status
+func grpcCode(status int) int32 {
+	switch status {
+	case http.StatusBadRequest, http.StatusRequestEntityTooLarge, http.StatusUnsupportedMediaType:
+		return 3 // INVALID_ARGUMENT
+	case http.StatusUnauthorized:
+		return 16 // UNAUTHENTICATED
+	case http.StatusForbidden:
+		return 7 // PERMISSION_DENIED
+	case http.StatusNotFound:
+		return 5 // NOT_FOUND
+	case http.StatusTooManyRequests:
+		return 8 // RESOURCE_EXHAUSTED
+	case http.StatusServiceUnavailable:
+		return 14 // UNAVAILABLE
+	default:
+		return 2 // UNKNOWN
+	}
+}
+
+func pluralSpans(n int) string {
+	if n == 1 {
+		return "1 span"
+	}
+	return fmt.Sprintf("%d spans", n)
+}
@@ -0,0 +1,95 @@
+package processor
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/willthames/opentracing-processor/otlp"
+	"github.com/willthames/opentracing-processor/span"
+)
+
+type dropTransformer struct {
+	traceID string
+}
+
+func (d dropTransformer) TransformSpans(spans []*span.Span) []*span.Span {
+	var kept []*span.Span
+	for _, s := range spans {
+		if s.TraceID != d.traceID {
+			kept = append(kept, s)
+		}
+	}
+	return kept
+}
+
+func TestOTLPPartialSuccess(t *testing.T) {
+	ids := func(trace byte, id byte) ([]byte, []byte) {
+		return bytes.Repeat([]byte{trace}, 16), bytes.Repeat([]byte{id}, 8)
+	}
+	var spans []*otlp.Span
+	for i, name := range []string{"good", "", "filtered", "filtered"} {
+		traceID, spanID := ids(1, byte(i+1))
+		if name == "filtered" {
+			traceID = bytes.Repeat([]byte{2}, 16)
+		}
+		spans = append(spans, &otlp.Span{TraceID: traceID, SpanID: spanID, Name: name})
+	}
+	request := &otlp.ExportTraceServiceRequest{ResourceSpans: []*otlp.ResourceSpans{{ScopeSpans: []*otlp.ScopeSpans{{Spans: spans}}}}}
+	body, _ := request.Marshal()
+	receiver := new(recordingReceiver)
+	app := &App{
+		Receiver:       receiver,
+		requiredFields: requiredFields{"name"},
+		Transformers:   []SpanTransformer{dropTransformer{traceID: "02020202020202020202020202020202"}},
+	}
+	r := httptest.NewRequest("POST", "/v1/traces", bytes.NewReader(body))
+	r.Header.Set("Content-Type", "application/x-protobuf")
+	w := httptest.NewRecorder()
+	app.handleSpans(w, r)
+
+	expected, _ := (&otlp.ExportTraceServiceResponse{PartialSuccess: &otlp.ExportTracePartialSuccess{
+		RejectedSpans: 3,
+		ErrorMessage:  "1 span missing required fields; 2 spans dropped by filters or sampling",
+	}}).Marshal()
+	if w.Code != http.StatusOK || !bytes.Equal(w.Body.Bytes(), expected) {
+		t.Errorf("expected a partial success rejecting 3 spans, got %d %q", w.Code, w.Body.Bytes())
+	}
+	if len(receiver.spans) != 1 {
+		t.Errorf("expected only the good span to be received, got %d", len(receiver.spans))
+	}
+}
+
+func TestOTLPErrorStatus(t *testing.T) {
+	app := &App{Receiver: new(recordingReceiver)}
+	r := httptest.NewRequest("POST", "/v1/traces", bytes.NewReader([]byte{0x0a, 0x7f}))
+	r.Header.Set("Content-Type", "application/x-protobuf")
+	w := httptest.NewRecorder()
+	app.handleSpans(w, r)
+	if w.Code != http.StatusBadRequest || w.Header().Get("Content-Type") != "application/x-protobuf" {
+		t.Fatalf("expected a protobuf 400, got %d %s", w.Code, w.Header().Get("Content-Type"))
+	}
+	// field 1 is the INVALID_ARGUMENT code, field 2 the message
+	body := w.Body.Bytes()
+	if !bytes.HasPrefix(body, []byte{0x08, 3, 0x12}) || int(body[3]) != len(body)-4 {
+		t.Errorf("expected a google.rpc.Status body, got %q", body)
+	}
+
+	w = httptest.NewRecorder()
+	writeOTLPError(w, http.StatusServiceUnavailable, "busy")
+	expected, _ := (&otlp.RPCStatus{Code: 14, Message: "busy"}).Marshal()
+	if w.Code != http.StatusServiceUnavailable || !bytes.Equal(w.Body.Bytes(), expected) {
+		t.Errorf("expected an UNAVAILABLE status, got %d %q", w.Code, w.Body.Bytes())
+	}
+}
+
+func TestKeyList(t *testing.T) {
+	var keys keyList
+	if err := keys.Set("service.version, k8s.pod.name,"); err != nil {
+		t.Fatal(err)
+	}
+	if keys.String() != "service.version,k8s.pod.name" {
+		t.Errorf("unexpected keys %v", keys)
+	}
+}
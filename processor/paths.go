@@ -0,0 +1,43 @@
+package processor
+
+import (
+	"net/http"
+	"strings"
+)
+
+// spanPaths are the API paths spans are accepted on: the Zipkin APIs
+// and OTLP/HTTP
+var spanPaths = []string{"/api/v1/spans", "/api/v2/spans", "/v1/traces"}
+
+// methodsWrap rejects requests using methods other than methods with a
+// 405, so that each endpoint only answers the methods it's meant for
+func (a *App) methodsWrap(hf http.HandlerFunc, methods ...string) http.HandlerFunc {
+	allow := strings.Join(methods, ", ")
+	return func(w http.ResponseWriter, r *http.Request) {
+		for _, method := range methods {
+			if r.Method == method {
+				hf(w, r)
+				return
+			}
+		}
+		w.Header().Set("Allow", allow)
+		a.writeError(w, r, http.StatusMethodNotAllowed, "method_not_allowed", "method must be "+allow)
+	}
+}
+
+// normalizePathWrap routes near misses of the span paths, with a
+// trailing slash or different case, to the span path they were meant
+// for. Other paths are left alone
+func normalizePathWrap(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		normalized := strings.ToLower(strings.TrimSuffix(r.URL.Path, "/"))
+		for _, path := range spanPaths {
+			if normalized == path && r.URL.Path != path {
+				r.URL.Path = path
+				r.URL.RawPath = ""
+				break
+			}
+		}
+		h.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,52 @@
+package processor
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNormalizePathWrap(t *testing.T) {
+	var routed string
+	h := normalizePathWrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		routed = r.URL.Path
+	}))
+	for path, expected := range map[string]string{
+		"/api/v1/spans":    "/api/v1/spans",
+		"/api/v1/spans/":   "/api/v1/spans",
+		"/API/v2/Spans":    "/api/v2/spans",
+		"/api/v1/spans/x":  "/api/v1/spans/x",
+		"/API/v1/services": "/API/v1/services",
+	} {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", path, nil))
+		if routed != expected {
+			t.Errorf("expected %s to be routed to %s, got %s", path, expected, routed)
+		}
+	}
+}
+
+func TestMethodsWrap(t *testing.T) {
+	app := &App{}
+	h := app.methodsWrap(func(w http.ResponseWriter, r *http.Request) {}, http.MethodPost)
+	w := httptest.NewRecorder()
+	h(w, httptest.NewRequest("POST", "/api/v1/spans", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("expected POST to be allowed, got %d", w.Code)
+	}
+	w = httptest.NewRecorder()
+	h(w, httptest.NewRequest("GET", "/api/v1/spans", nil))
+	if w.Code != http.StatusMethodNotAllowed || w.Header().Get("Allow") != "POST" {
+		t.Errorf("expected GET to be refused with Allow: POST, got %d %v", w.Code, w.Header())
+	}
+}
+
+func TestDisableDebugEndpoints(t *testing.T) {
+	for disabled, expected := range map[bool]int{false: http.StatusOK, true: http.StatusNotFound} {
+		app := &App{disableDebug: disabled}
+		w := httptest.NewRecorder()
+		app.metricsMux().ServeHTTP(w, httptest.NewRequest("GET", "/debug/config", nil))
+		if w.Code != expected {
+			t.Errorf("expected /debug/config to give %d with debug disabled %v, got %d", expected, disabled, w.Code)
+		}
+	}
+}
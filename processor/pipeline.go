@@ -0,0 +1,91 @@
+package processor
+
+import (
+	"fmt"
+
+	"github.com/willthames/opentracing-processor/span"
+)
+
+// SpanTransformer modifies, drops or adds spans in a batch before the
+// batch is handed to the Receiver
+type SpanTransformer interface {
+	TransformSpans(spans []*span.Span) []*span.Span
+}
+
+// transform passes spans through each of the App's Transformers in turn
+func (a *App) transform(spans []*span.Span) []*span.Span {
+	for _, t := range a.Transformers {
+		spans = t.TransformSpans(spans)
+	}
+	return spans
+}
+
+// addBuiltinTransformers puts the transformers enabled by command line
+// flags at the start of the pipeline
+func (a *App) addBuiltinTransformers() error {
+	var builtin []SpanTransformer
+	if a.chaosDropRate > 0 {
+		builtin = append(builtin, &chaosDropper{Rate: a.chaosDropRate})
+	}
+	switch a.missingTimingPolicy {
+	case "":
+	case missingKeep, missingDrop, missingBackfill:
+		builtin = append(builtin, &missingTimingFilter{Policy: a.missingTimingPolicy, Clock: a.Clock})
+	default:
+		return fmt.Errorf("invalid missing-timestamp-policy %s. Must be keep, drop or backfill", a.missingTimingPolicy)
+	}
+	if a.maxSpanAge > 0 {
+		builtin = append(builtin, &ageFilter{MaxAge: a.maxSpanAge, MaxSkew: a.maxClockSkew, Clock: a.Clock})
+	}
+	if a.maxDuration > 0 {
+		if a.durationPolicy != "drop" && a.durationPolicy != "zero" {
+			return fmt.Errorf("invalid max-duration-policy %s. Must be drop or zero", a.durationPolicy)
+		}
+		builtin = append(builtin, &durationLimiter{Max: a.maxDuration, Zero: a.durationPolicy == "zero"})
+	}
+	if a.dropOrphans {
+		builtin = append(builtin, &orphanFilter{})
+	}
+	switch a.dedupeAnnotations {
+	case "":
+	case "first", "last":
+		builtin = append(builtin, &annotationDeduper{KeepFirst: a.dedupeAnnotations == "first"})
+	default:
+		return fmt.Errorf("invalid dedupe-annotations %s. Must be first or last", a.dedupeAnnotations)
+	}
+	if a.maxAnnotations > 0 {
+		if a.annotationsPolicy != "truncate" && a.annotationsPolicy != "drop" {
+			return fmt.Errorf("invalid max-annotations-policy %s. Must be truncate or drop", a.annotationsPolicy)
+		}
+		builtin = append(builtin, &annotationLimiter{Max: a.maxAnnotations, Drop: a.annotationsPolicy == "drop"})
+	}
+	if a.maxValueBytes > 0 {
+		builtin = append(builtin, &valueTruncator{MaxBytes: a.maxValueBytes, Tag: a.tagTruncatedValues})
+	}
+	if a.traceIDSalt != "" {
+		builtin = append(builtin, &idRewriter{Salt: []byte(a.traceIDSalt)})
+	}
+	if a.mappingFile != "" {
+		mapping, err := loadMapping(a.mappingFile)
+		if err != nil {
+			return err
+		}
+		builtin = append(builtin, mapping)
+	}
+	if a.targetRate > 0 {
+		builtin = append(builtin, &adaptiveSampler{Target: a.targetRate, Window: a.adaptiveWindow, Clock: a.Clock})
+	}
+	if a.policyURL != "" {
+		policy, err := newPolicyTransformer(a.policyURL, a.policyTTL, a.policyTimeout, a.policyCacheSize)
+		if err != nil {
+			return err
+		}
+		policy.Clock = a.Clock
+		builtin = append(builtin, policy)
+	}
+	if a.processorName != "" {
+		builtin = append(builtin, &hopRecorder{Name: a.processorName})
+	}
+	a.Transformers = append(builtin, a.Transformers...)
+	return nil
+}
@@ -0,0 +1,146 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/willthames/opentracing-processor/span"
+)
+
+// policyTransformer asks an external policy service whether to keep
+// each trace, caching its decisions for TTL. The service is sent a GET
+// with traceId and service query parameters and must respond with
+// {"keep": true} or {"keep": false}. Every lookup in a batch shares a
+// deadline of Timeout, and traces the service can't decide on in time
+// are kept
+type policyTransformer struct {
+	URL        *url.URL
+	TTL        time.Duration
+	Timeout    time.Duration
+	MaxEntries int
+	Clock      Clock
+
+	client   http.Client
+	errorLog *rateLimitedLog
+	mu       sync.Mutex
+	cache    map[string]policyDecision
+}
+
+type policyDecision struct {
+	keep    bool
+	expires time.Time
+}
+
+// policyResponse is the policy service's response body
+type policyResponse struct {
+	Keep bool `json:"keep"`
+}
+
+func newPolicyTransformer(policyURL string, ttl, timeout time.Duration, maxEntries int) (*policyTransformer, error) {
+	parsed, err := parseHTTPURL(policyURL)
+	if err != nil {
+		return nil, err
+	}
+	return &policyTransformer{
+		URL:        parsed,
+		TTL:        ttl,
+		Timeout:    timeout,
+		MaxEntries: maxEntries,
+		errorLog:   newRateLimitedLog(10 * time.Second),
+		cache:      make(map[string]policyDecision),
+	}, nil
+}
+
+func (p *policyTransformer) TransformSpans(spans []*span.Span) []*span.Span {
+	ctx, cancel := context.WithTimeout(context.Background(), p.Timeout)
+	defer cancel()
+	kept := spans[:0]
+	for _, s := range spans {
+		if !p.keep(ctx, s) {
+			spansDropped.WithLabelValues("policy").Inc()
+			continue
+		}
+		kept = append(kept, s)
+	}
+	return kept
+}
+
+// keep returns the decision for s's trace, from the cache or the
+// policy service. Errors fail open
+func (p *policyTransformer) keep(ctx context.Context, s *span.Span) bool {
+	now := now(p.Clock)
+	p.mu.Lock()
+	decision, ok := p.cache[s.TraceID]
+	p.mu.Unlock()
+	if ok && now.Before(decision.expires) {
+		logSamplingDecision(s.TraceID, decision.keep, "policy_cached")
+		return decision.keep
+	}
+	keep, err := p.query(ctx, s.TraceID, s.ServiceName())
+	if err != nil {
+		policyLookups.WithLabelValues("error").Inc()
+		p.errorLog.Info(logrus.WithError(err), "Error querying policy service, keeping trace")
+		logSamplingDecision(s.TraceID, true, "policy_error")
+		return true
+	}
+	if keep {
+		policyLookups.WithLabelValues("keep").Inc()
+	} else {
+		policyLookups.WithLabelValues("drop").Inc()
+	}
+	p.store(s.TraceID, policyDecision{keep: keep, expires: now.Add(p.TTL)}, now)
+	logSamplingDecision(s.TraceID, keep, "policy")
+	return keep
+}
+
+// store caches a decision. If the cache is full, expired decisions are
+// removed, and if that isn't enough it is emptied
+func (p *policyTransformer) store(traceID string, decision policyDecision, now time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.cache) >= p.MaxEntries {
+		for id, cached := range p.cache {
+			if !now.Before(cached.expires) {
+				delete(p.cache, id)
+			}
+		}
+		if len(p.cache) >= p.MaxEntries {
+			p.cache = make(map[string]policyDecision)
+		}
+	}
+	p.cache[traceID] = decision
+}
+
+func (p *policyTransformer) query(ctx context.Context, traceID, service string) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	u := *p.URL
+	q := u.Query()
+	q.Set("traceId", traceID)
+	q.Set("service", service)
+	u.RawQuery = q.Encode()
+	r, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return false, err
+	}
+	resp, err := p.client.Do(r.WithContext(ctx))
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("policy service responded %s", resp.Status)
+	}
+	var decision policyResponse
+	if err := json.NewDecoder(resp.Body).Decode(&decision); err != nil {
+		return false, err
+	}
+	return decision.Keep, nil
+}
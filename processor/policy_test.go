@@ -0,0 +1,53 @@
+package processor
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/willthames/opentracing-processor/span"
+)
+
+func TestPolicyTransformer(t *testing.T) {
+	var lookups int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&lookups, 1)
+		switch r.URL.Query().Get("traceId") {
+		case "drop":
+			w.Write([]byte(`{"keep":false}`))
+		case "slow":
+			time.Sleep(200 * time.Millisecond)
+			w.Write([]byte(`{"keep":false}`))
+		default:
+			w.Write([]byte(`{"keep":true}`))
+		}
+	}))
+	defer server.Close()
+
+	p, err := newPolicyTransformer(server.URL, time.Minute, 50*time.Millisecond, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kept := p.TransformSpans([]*span.Span{{TraceID: "keep", ID: "1"}, {TraceID: "drop", ID: "2"}, {TraceID: "drop", ID: "3"}})
+	if len(kept) != 1 || kept[0].TraceID != "keep" {
+		t.Errorf("expected only the kept trace, got %v", kept)
+	}
+	if lookups != 2 {
+		t.Errorf("expected one lookup per trace, got %d", lookups)
+	}
+	p.TransformSpans([]*span.Span{{TraceID: "drop", ID: "4"}})
+	if lookups != 2 {
+		t.Errorf("expected the cached decision to be used, got %d lookups", lookups)
+	}
+
+	started := time.Now()
+	kept = p.TransformSpans([]*span.Span{{TraceID: "slow", ID: "5"}, {TraceID: "unknown", ID: "6"}})
+	if len(kept) != 2 {
+		t.Errorf("expected traces to be kept when the policy service is too slow, got %v", kept)
+	}
+	if elapsed := time.Since(started); elapsed > 150*time.Millisecond {
+		t.Errorf("a slow policy service held up the batch for %v", elapsed)
+	}
+}
@@ -4,33 +4,142 @@ import (
 	"bytes"
 	"compress/gzip"
 	"context"
-	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
-	"io"
 	"io/ioutil"
+	"mime"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"sync/atomic"
 	"syscall"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/sirupsen/logrus"
+	"github.com/willthames/opentracing-processor/otlp"
 	"github.com/willthames/opentracing-processor/span"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// signingSecretEnv is the environment variable holding the forward
+// signing secret, if not read from a file
+const signingSecretEnv = "FORWARD_SIGNING_SECRET"
+
+// Sinks that processed spans can be forwarded to
+const (
+	sinkCollector = "collector"
+	sinkFile      = "file"
 )
 
 // App is a base processor struct suitable for embedding in
 // specific processors (or using on its own if no extra fields are required)
 type App struct {
-	port         int
-	metricsPort  int
-	server       *http.Server
-	collectorURL string
-	logLevel     string
-	Forwarder    *Forwarder
-	OutputLines  []string
-	Receiver     SpanReceiver
+	port                int
+	metricsPort         int
+	server              *http.Server
+	shuttingDown        int32
+	metricsServer       *http.Server
+	metricsAuthUser     string
+	metricsAuthPass     string
+	collectorURL        string
+	sink                string
+	processorName       string
+	forwardName         string
+	outputFile          string
+	logLevel            string
+	logFormat           string
+	validateOnly        bool
+	stdin               bool
+	disableDebug        bool
+	credentialsFile     string
+	targetRate          float64
+	adaptiveWindow      time.Duration
+	traceContextHeaders bool
+	decompressLimit     int
+	maxBodyBytes        int
+	stdinFormat         string
+	errorFormat         string
+	verboseErrors       bool
+	autodetectFormat    bool
+	strictJSON          bool
+	otlpOptions         otlp.Options
+	rejectInvalid       bool
+	successStatus       int
+	tailSamplingWindow  time.Duration
+	tailSamplingLatency time.Duration
+	spansPerTraceWindow time.Duration
+	keepIf              tagMatches
+	requiredFields      requiredFields
+	redMetrics          bool
+	operationLabels     labelLimiter
+	forwardRetry        RetryPolicy
+	forwardBatchSize    int
+	forwardFlush        time.Duration
+	forwardMinFlush     time.Duration
+	forwardMaxFlush     time.Duration
+	preserveTraceOrder  bool
+	sortBatch           bool
+	maxBatchBytes       int
+	signingSecretFile   string
+	forwardClientCert   string
+	forwardClientKey    string
+	forwardCACert       string
+	forwardFormat       string
+	forwardJSONSchema   string
+	forwardUpperCaseIDs bool
+	forwardUserAgent    string
+	deadLetterURL       string
+	analyticsURL        string
+	tolerateInitFailure bool
+	httpDrainTimeout    time.Duration
+	maxHeaderBytes      int
+	statsInterval       time.Duration
+	intervalGauges      bool
+	forwardDrainTimeout time.Duration
+	maxSpanAge          time.Duration
+	missingTimingPolicy string
+	maxClockSkew        time.Duration
+	dropOrphans         bool
+	maxDuration         time.Duration
+	durationPolicy      string
+	dedupeAnnotations   string
+	maxAnnotations      int
+	annotationsPolicy   string
+	maxValueBytes       int
+	tagTruncatedValues  bool
+	traceIDSalt         string
+	mappingFile         string
+	policyURL           string
+	policyTTL           time.Duration
+	policyTimeout       time.Duration
+	policyCacheSize     int
+	queueDumpPath       string
+	chaosDropRate       float64
+	chaosDelay          time.Duration
+	queueHighWater      float64
+	stream              spanStream
+	serviceLabels       labelLimiter
+	buffers             bufferPool
+	ingestLimit         tokenBucket
+	Forwarder           SpanForwarder
+	OutputLines         []string
+	Receiver            SpanReceiver
+	// Receivers optionally overrides Receiver for specific API paths
+	// (e.g. /api/v2/spans). Paths not listed use Receiver
+	Receivers map[string]SpanReceiver
+	// Transformers are applied in order to each batch of decoded spans
+	// before it reaches the Receiver. Serve adds the built-in
+	// transformers enabled by command line flags ahead of these
+	Transformers []SpanTransformer
+	// Clock is used for time based behaviour such as age filtering and
+	// rate limiting. Defaults to the real clock
+	Clock Clock
 }
 
 // SpanReceiver is an interface that accepts spans
@@ -38,13 +147,107 @@ type SpanReceiver interface {
 	ReceiveSpan(span *span.Span)
 }
 
+// BatchSpanReceiver is implemented by SpanReceivers that would rather
+// be handed each request's spans at once, e.g. to take a lock once per
+// request rather than once per span. It is never called with no spans.
+// Receivers wrapped by tail sampling, the analytics tap or RED metrics
+// are called once per span
+type BatchSpanReceiver interface {
+	SpanReceiver
+	ReceiveSpans(spans []*span.Span)
+}
+
 // BaseCLI adds standard command line flags common to all
 // opentracing processors
 func (a *App) BaseCLI() {
 	flag.IntVar(&a.port, "port", 8080, "server port")
 	flag.IntVar(&a.metricsPort, "metrics-port", 10010, "prometheus /metrics port")
+	flag.StringVar(&a.metricsAuthUser, "metrics-auth-user", "", "Username required, with basic auth, for the metrics and debug endpoints")
+	flag.StringVar(&a.metricsAuthPass, "metrics-auth-pass", "", "Password required, with basic auth, for the metrics and debug endpoints")
+	flag.BoolVar(&a.disableDebug, "disable-debug-endpoints", false, "Don't serve the /debug endpoints on the metrics port, which expose configuration and span data")
 	flag.StringVar(&a.collectorURL, "collector-url", "", "Host to forward traces. Not setting this will work as dry run")
+	flag.StringVar(&a.processorName, "processor-name", "", "Name appended to the processor.hops tag of each span, to trace chains of processors. Unset leaves spans untagged")
+	flag.StringVar(&a.forwardName, "forward-name", "collector", "Name of the collector forwarder in the forwarder label of forward metrics")
+	flag.StringVar(&a.sink, "sink", sinkCollector, "Where to forward spans: collector, to --collector-url, or file, to --output-file")
+	flag.StringVar(&a.outputFile, "output-file", stdoutPath, "File the file sink appends spans to as JSON lines, or - for stdout. Reopened on SIGHUP")
 	flag.StringVar(&a.logLevel, "log-level", "Info", "log level")
+	flag.StringVar(&a.logFormat, "log-format", "text", "log format: text or json")
+	flag.BoolVar(&a.stdin, "stdin", false, "Process a single span payload read from standard input, forward it and exit, rather than starting servers")
+	flag.StringVar(&a.stdinFormat, "stdin-format", "json", "Format of the --stdin payload: json, ndjson or thrift")
+	flag.BoolVar(&a.validateOnly, "validate", false, "Check the configuration, print any problems and exit, non-zero if there were problems, without starting servers")
+	flag.StringVar(&a.missingTimingPolicy, "missing-timestamp-policy", missingKeep, "What to do with spans missing a timestamp or duration: keep, drop, or backfill the timestamp with the time received")
+	flag.DurationVar(&a.maxSpanAge, "max-span-age", 0, "Drop spans that started longer ago than this. Zero disables the check")
+	flag.DurationVar(&a.maxClockSkew, "max-clock-skew", time.Minute, "With --max-span-age, also drop spans starting further than this in the future")
+	flag.DurationVar(&a.maxDuration, "max-duration", time.Hour, "Longest believable span duration, beyond which spans are assumed to be broken. Zero disables the check")
+	flag.StringVar(&a.durationPolicy, "max-duration-policy", "drop", "What to do with spans over --max-duration: drop, or zero their duration")
+	flag.BoolVar(&a.dropOrphans, "drop-orphans", false, "Drop spans whose parent isn't in the same request, keeping roots and complete subtrees. Parents sent in other requests aren't seen, so their children are dropped too")
+	flag.StringVar(&a.dedupeAnnotations, "dedupe-annotations", "", "Remove binary annotations that repeat a key within a span, keeping the first or last value. Unset keeps duplicates")
+	flag.IntVar(&a.maxAnnotations, "max-annotations", 0, "Maximum number of binary annotations per span. Zero means no limit")
+	flag.StringVar(&a.annotationsPolicy, "max-annotations-policy", "truncate", "What to do with spans over --max-annotations: truncate or drop")
+	flag.IntVar(&a.maxValueBytes, "max-annotation-value-bytes", 0, "Maximum length of string binary annotation values, beyond which they are truncated and marked with an ellipsis. Zero means no limit")
+	flag.BoolVar(&a.tagTruncatedValues, "tag-truncated-values", false, "Tag spans with processor.truncated.<key>=true for each annotation value cut by --max-annotation-value-bytes")
+	flag.StringVar(&a.traceIDSalt, "trace-id-salt", "", "If set, rewrite trace and span IDs using this salt so that traces from different tenants can't collide")
+	flag.StringVar(&a.mappingFile, "mapping-file", "", "YAML or JSON file of rules for copying tags to the span name or other tags")
+	flag.Float64Var(&a.targetRate, "target-spans-per-second", 0, "Sample traces, consistently by trace ID and keeping each trace's first decision for a minute, so that roughly this many spans per second are kept however many arrive. Zero keeps every trace")
+	flag.DurationVar(&a.adaptiveWindow, "adaptive-sampling-window", 10*time.Second, "How often --target-spans-per-second remeasures the ingest rate and adjusts the fraction of traces kept")
+	flag.StringVar(&a.policyURL, "policy-url", "", "Policy service to ask whether to keep each trace")
+	flag.DurationVar(&a.policyTTL, "policy-ttl", time.Minute, "How long to cache policy service decisions for")
+	flag.DurationVar(&a.policyTimeout, "policy-timeout", 100*time.Millisecond, "Longest to wait for policy decisions for a request's spans, after which undecided traces are kept")
+	flag.IntVar(&a.policyCacheSize, "policy-cache-size", 10000, "Maximum number of policy decisions to cache")
+	flag.Float64Var(&a.chaosDropRate, "chaos-drop-rate", 0, "FOR TESTING ONLY: fraction of spans, between 0 and 1, to deliberately drop")
+	flag.DurationVar(&a.chaosDelay, "chaos-delay", 0, "FOR TESTING ONLY: delay before forwarding each payload")
+	flag.Float64Var(&a.queueHighWater, "forward-queue-high-water", 0, "Fraction of the forwarder queue, between 0 and 1, in use above which span requests get a 429. 0 never refuses spans")
+	flag.BoolVar(&a.preserveTraceOrder, "preserve-trace-order", false, "Forward spans from the same trace in order, at some cost to throughput")
+	flag.BoolVar(&a.sortBatch, "sort-batch", false, "Sort the spans in each forwarded batch by timestamp")
+	flag.IntVar(&a.maxBatchBytes, "forward-max-batch-bytes", 0, "Split forwarded batches so each request body is at most this many bytes. A single span over the limit is dropped. Zero means no limit")
+	flag.StringVar(&a.forwardFormat, "forward-format", FormatZipkin, "Format to forward spans in: zipkin or otlp")
+	flag.StringVar(&a.forwardJSONSchema, "forward-json-schema", span.SchemaV1, "Zipkin JSON schema to forward spans in: v1 or v2")
+	flag.BoolVar(&a.forwardUpperCaseIDs, "forward-json-upper-case-ids", false, "Spell forwarded JSON ID fields traceID, parentID and traceIDHigh, for collectors that expect them")
+	flag.StringVar(&a.queueDumpPath, "queue-dump-path", filepath.Join(os.TempDir(), "opentracing-processor-queue.json"), "File the forwarder queue is written to, as JSON, on SIGUSR1")
+	flag.IntVar(&a.forwardBatchSize, "forward-batch-size", 100, "Send spans to the collector in batches of this many, or fewer every --forward-flush-interval. Zero with no flush interval sends each received batch straight away")
+	flag.DurationVar(&a.forwardFlush, "forward-flush-interval", time.Second, "Longest time spans wait to be batched before being sent to the collector")
+	flag.DurationVar(&a.forwardMinFlush, "forward-min-flush-interval", 10*time.Millisecond, "Shortest flush interval adaptive batching may use under load")
+	flag.DurationVar(&a.forwardMaxFlush, "forward-max-flush-interval", 0, "If set, adapt the flush interval to span volume, lengthening it up to this when batches are small. Requires --forward-batch-size")
+	flag.IntVar(&a.forwardRetry.MaxAttempts, "forward-max-attempts", 3, "Most times to send each payload to the collector, retrying after network errors and 5xx responses. 1 never retries")
+	flag.DurationVar(&a.forwardRetry.BaseBackoff, "forward-retry-backoff", 100*time.Millisecond, "Wait before the first retry of a payload, doubling for each retry after")
+	flag.DurationVar(&a.forwardRetry.MaxBackoff, "forward-retry-max-backoff", 10*time.Second, "Longest wait between retries of a payload")
+	flag.StringVar(&a.deadLetterURL, "dead-letter-url", "", "URL to send payloads that the collector failed to accept, for later inspection")
+	flag.StringVar(&a.analyticsURL, "analytics-url", "", "Collector to send a best effort copy of sampled spans to, dropping them rather than ever slowing the collector-url forward")
+	flag.StringVar(&a.forwardUserAgent, "forward-user-agent", "", "User-Agent sent to the collector. Defaults to "+defaultUserAgent())
+	flag.BoolVar(&a.intervalGauges, "interval-gauges", false, "Also export spans received, forwarded and dropped since the last scrape as gauges, which each scrape resets. Only suitable for a single scraper")
+	flag.DurationVar(&a.statsInterval, "stats-interval", 0, "How often to log a summary of spans received, forwarded and dropped. Zero disables the summary")
+	flag.IntVar(&a.maxHeaderBytes, "max-header-bytes", http.DefaultMaxHeaderBytes, "Maximum size of span request headers, for clients behind proxies that add many")
+	flag.DurationVar(&a.httpDrainTimeout, "http-drain-timeout", time.Second, "How long to wait for in flight HTTP requests to finish on shutdown")
+	flag.DurationVar(&a.forwardDrainTimeout, "forward-drain-timeout", 30*time.Second, "How long to wait for the forwarder to send queued spans on shutdown")
+	flag.BoolVar(&a.tolerateInitFailure, "tolerate-forwarder-init-failure", false, "Keep accepting spans, dropping them, while retrying forwarder creation in the background if the collector is invalid or can't be resolved")
+	flag.StringVar(&a.signingSecretFile, "forward-signing-secret-file", "", "File containing a secret used to HMAC sign forwarded requests. Alternatively set "+signingSecretEnv)
+	flag.StringVar(&a.credentialsFile, "collector-credentials-file", "", "File of key=value lines giving the collector username and password, or token, and optionally a url overriding --collector-url's host. Reread on SIGHUP")
+	flag.StringVar(&a.forwardClientCert, "forward-client-cert", "", "PEM certificate file presented to the collector for mutual TLS. Requires --forward-client-key")
+	flag.StringVar(&a.forwardClientKey, "forward-client-key", "", "PEM private key file for --forward-client-cert")
+	flag.StringVar(&a.forwardCACert, "forward-ca-cert", "", "PEM file of CA certificates to verify the collector with, instead of the system roots")
+	flag.IntVar(&a.successStatus, "ingest-success-status", http.StatusAccepted, "HTTP status returned when spans are accepted. Must be 2xx")
+	flag.BoolVar(&a.redMetrics, "red-metrics", false, "Export request rate, error and duration metrics for each service and operation, derived from received spans")
+	flag.IntVar(&a.operationLabels.Max, "max-metric-operations", 1000, "Maximum number of distinct service and operation pairs labelled in --red-metrics. Spans from further operations are counted as "+otherLabel)
+	flag.IntVar(&a.serviceLabels.Max, "max-metric-services", 100, "Maximum number of distinct service names used as metric labels. Spans from further services are counted as "+otherLabel)
+	flag.Float64Var(&a.ingestLimit.Rate, "ingest-rate-limit", 0, "Maximum spans per second to accept across all requests, beyond which requests get a 429. 0 is unlimited")
+	flag.Float64Var(&a.ingestLimit.Burst, "ingest-rate-burst", 0, "Number of spans that may be accepted at once above the ingest rate limit. Defaults to one second's worth")
+	flag.IntVar(&a.maxBodyBytes, "max-body-bytes", 64*1024*1024, "Largest size in bytes of a request body as sent, before any decompression, beyond which requests get a 413. Zero is unlimited")
+	flag.IntVar(&a.decompressLimit, "max-decompressed-bytes", 64*1024*1024, "Largest size in bytes a gzipped request body may decompress to, beyond which requests get a 413. Zero is unlimited")
+	flag.IntVar(&a.buffers.Size, "read-buffer-size", 64*1024, "Initial size in bytes of the pooled buffers used to read request bodies")
+	flag.BoolVar(&a.rejectInvalid, "reject-invalid", false, "Reject requests containing invalid spans with a 400, rather than counting and accepting them")
+	flag.Var(&a.requiredFields, "require-fields", "Comma separated span fields, e.g. name,duration, that spans must have. Spans missing any are dropped, or with --reject-invalid rejected with a 400")
+	flag.BoolVar(&a.traceContextHeaders, "trace-context-headers", false, "Give posted spans without a trace ID the trace ID from the request's b3, X-B3-* or W3C traceparent headers. A single span without an ID takes the header's span and parent IDs, and a traceparent's parent-id becomes its span ID; otherwise spans without a parent become children of the header's span")
+	flag.BoolVar(&a.strictJSON, "strict-json", false, "Reject JSON span data with unknown or duplicated fields")
+	flag.StringVar(&a.otlpOptions.LinkPrefix, "otlp-link-prefix", otlp.DefaultLinkPrefix, "Prefix of the tags recording the links of spans ingested as OTLP, e.g. otlp.link.0.trace_id")
+	flag.Var((*keyList)(&a.otlpOptions.ResourceAttributes), "otlp-resource-attributes", "Comma separated resource attributes to copy onto each span ingested as OTLP. Defaults to all but service.name")
+	flag.StringVar(&a.otlpOptions.ResourcePrefix, "otlp-resource-prefix", "", "Prefix added to the tags copied from OTLP resource attributes, e.g. resource.")
+	flag.BoolVar(&a.autodetectFormat, "autodetect-format", false, "If spans fail to decode as their Content-Type, retry in the format the body looks like")
+	flag.BoolVar(&a.verboseErrors, "verbose-errors", false, "Include the offset and surrounding data of decode errors in responses. Exposes span data to clients, so only enable for debugging")
+	flag.StringVar(&a.errorFormat, "error-format", "text", "Format of error response bodies: text or json. Clients sending Accept: application/json always get json")
+	flag.DurationVar(&a.tailSamplingWindow, "tail-sampling-window", 0, "How long to buffer each trace before deciding whether to keep it. Zero disables tail sampling")
+	flag.DurationVar(&a.tailSamplingLatency, "tail-sampling-latency", 0, "Keep tail sampled traces containing a span at least this slow. Traces containing errors are always kept")
+	flag.DurationVar(&a.spansPerTraceWindow, "spans-per-trace-window", 0, "Count the spans seen for each trace over this window in the spans_per_trace metric. Zero disables counting")
+	flag.Var(&a.keepIf, "keep-if", "Always keep tail sampled traces containing a span with this key=value tag. May be repeated")
 }
 
 // handleSpans handles the /api/v1/spans POST endpoint. It decodes the request
@@ -54,84 +257,294 @@ func (a *App) BaseCLI() {
 func (a *App) handleSpans(w http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close()
 
-	data, err := ioutil.ReadAll(r.Body)
+	receiver := a.receiverFor(r.URL.Path)
+	if receiver == nil {
+		logrus.WithField("path", r.URL.Path).Error("No span receiver configured")
+		a.writeError(w, r, http.StatusInternalServerError, "no_receiver", "no span receiver is configured")
+		return
+	}
+
+	// spans must not refer to data once decoded, as the buffer is reused
+	buf := a.buffers.get()
+	defer a.buffers.put(buf)
+	_, err := buf.ReadFrom(r.Body)
+	data := buf.Bytes()
+	if tooLarge(err) {
+		logrus.WithError(err).Info("Rejecting request body that is too large")
+		a.writeError(w, r, http.StatusRequestEntityTooLarge, "too_large", err.Error())
+		return
+	}
 	if err != nil {
 		logrus.WithError(err).Error("Error reading request body")
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte("error reading request"))
+		a.writeError(w, r, http.StatusInternalServerError, "read_error", "error reading request")
+		return
+	}
+
+	if r.Context().Err() != nil {
+		a.cancelledIngest(r)
+		return
+	}
+
+	spans, contentType, decodeErr := a.decodeSpans(r.URL.Path, r.Header.Get("Content-Type"), data)
+	if decodableTypes[contentType] {
+		ingestBytes.WithLabelValues(contentType).Add(float64(len(data)))
+	}
+	if decodeErr != nil {
+		a.writeError(w, r, decodeErr.status, decodeErr.code, decodeErr.message)
+		return
+	}
+	if a.traceContextHeaders {
+		if err := applyTraceContext(r.Header, spans); err != nil {
+			logrus.WithError(err).Info("Rejecting spans with invalid trace context headers")
+			a.writeError(w, r, http.StatusBadRequest, "invalid_trace_context", err.Error())
+			return
+		}
+	}
+	if err := a.checkIDs(spans); err != nil {
+		logrus.WithError(err).Info("Rejecting spans with invalid IDs")
+		a.writeError(w, r, http.StatusBadRequest, "invalid_id", err.Error())
+		return
+	}
+	decoded := len(spans)
+	if spans, err = a.checkRequiredFields(spans); err != nil {
+		logrus.WithError(err).Info("Rejecting spans missing required fields")
+		a.writeError(w, r, http.StatusBadRequest, "missing_field", err.Error())
+		return
 	}
+	spansReceived.WithLabelValues(contentType).Add(float64(len(spans)))
+	for _, s := range spans {
+		serviceSpansReceived.WithLabelValues(a.serviceLabels.service(s.ServiceName())).Inc()
+	}
+	if a.ingestLimit.Rate > 0 {
+		if ok, wait := a.ingestLimit.take(len(spans), now(a.Clock)); !ok {
+			spansDropped.WithLabelValues("rate_limited").Add(float64(len(spans)))
+			w.Header().Set("Retry-After", retryAfter(wait))
+			a.writeError(w, r, http.StatusTooManyRequests, "rate_limited", "span ingest rate limit exceeded")
+			return
+		}
+	}
+	if a.overHighWater() {
+		spansDropped.WithLabelValues("backpressure").Add(float64(len(spans)))
+		w.Header().Set("Retry-After", "1")
+		a.writeError(w, r, http.StatusTooManyRequests, "queue_full", "forwarder queue is full")
+		return
+	}
+	valid := len(spans)
+	spans = a.transform(spans)
 
-	contentType := r.Header.Get("Content-Type")
+	// the status is only written once every span has been received, so
+	// that a panicking receiver can still fail the request
+	err = a.receiveSpans(r.Context(), receiver, spans)
+	if err != nil {
+		a.cancelledIngest(r)
+	}
+	if r.URL.Path == "/v1/traces" {
+		writeOTLPResponse(w, decoded-valid, valid-len(spans))
+		return
+	}
+	status := a.successStatus
+	if status == 0 {
+		status = http.StatusAccepted
+	}
+	w.WriteHeader(status)
+}
+
+// checkIDs counts spans with malformed IDs. If invalid spans are being
+// rejected, the error for the first of them is returned
+func (a *App) checkIDs(spans []*span.Span) error {
+	var invalid error
+	for _, s := range spans {
+		if err := s.ValidateIDs(); err != nil {
+			spansInvalid.WithLabelValues("invalid_id").Inc()
+			if invalid == nil {
+				invalid = err
+			}
+		}
+	}
+	if a.rejectInvalid {
+		return invalid
+	}
+	if invalid != nil {
+		logrus.WithError(invalid).Debug("Accepting spans with invalid IDs")
+	}
+	return nil
+}
+
+// decodeError is a failure to decode spans, with the error response
+// to send
+type decodeError struct {
+	status  int
+	code    string
+	message string
+}
+
+// decodeSpans decodes data posted to path, according to contentType.
+// It also returns the content type the spans were decoded from, which
+// differs from contentType for multipart uploads, and leaves out any
+// parameters such as charset
+func (a *App) decodeSpans(path string, contentType string, data []byte) ([]*span.Span, string, *decodeError) {
+	if mediaType, params, _ := mime.ParseMediaType(contentType); mediaType == "multipart/form-data" {
+		var err error
+		data, contentType, err = multipartSpans(data, params["boundary"])
+		if err != nil {
+			logrus.WithError(err).Info("Error reading multipart span upload")
+			return nil, contentType, &decodeError{http.StatusBadRequest, "multipart_error", err.Error()}
+		}
+	} else if mediaType != "" {
+		contentType = mediaType
+	}
 
 	var spans []*span.Span
+	var err error
 	switch contentType {
 	case "application/json":
 		logrus.Info("Receiving data in json format")
-		switch r.URL.Path {
-		case "/api/v1/spans":
-			err = json.Unmarshal(data, &spans)
-		case "/api/v2/spans":
-			err = json.Unmarshal(data, &spans)
+		switch path {
+		case "/api/v1/spans", "/api/v2/spans":
+			decode, decodeStrict := span.DecodeJSON, span.DecodeJSONStrict
+			if path == "/api/v2/spans" {
+				decode, decodeStrict = span.DecodeJSONV2, span.DecodeJSONV2Strict
+			}
+			if a.strictJSON {
+				spans, err = decodeStrict(data)
+				if err != nil {
+					logrus.WithError(err).Info("Rejecting span data in strict mode")
+					return nil, contentType, &decodeError{http.StatusBadRequest, "invalid_field", err.Error()}
+				}
+			} else {
+				spans, err = decode(data)
+			}
 		default:
-			w.WriteHeader(http.StatusBadRequest)
-			w.Write([]byte("invalid version"))
-			return
+			return nil, contentType, &decodeError{http.StatusBadRequest, "invalid_version", "invalid version"}
 		}
+	case "application/x-ndjson":
+		logrus.Info("Receiving data in ndjson format")
+		spans, err = span.DecodeNDJSON(data)
 	case "application/x-thrift":
 		logrus.Debug("Receiving data in thrift format")
-		switch r.URL.Path {
+		switch path {
 		case "/api/v1/spans":
 			spans, err = span.DecodeThrift(data)
 		case "/api/v2/spans":
-			w.WriteHeader(http.StatusBadRequest)
-			w.Write([]byte("thrift is not supported for v2 spans"))
+			return nil, contentType, &decodeError{http.StatusBadRequest, "thrift_v2_unsupported", "thrift is not supported for v2 spans"}
 		default:
-			w.WriteHeader(http.StatusBadRequest)
-			w.Write([]byte("invalid version"))
-			return
+			return nil, contentType, &decodeError{http.StatusBadRequest, "invalid_version", "invalid version"}
+		}
+	case "application/x-protobuf":
+		logrus.Debug("Receiving data in OTLP protobuf format")
+		if path != "/v1/traces" {
+			return nil, contentType, &decodeError{http.StatusBadRequest, "invalid_version", "invalid version"}
+		}
+		var request *otlp.ExportTraceServiceRequest
+		if request, err = otlp.Unmarshal(data); err == nil {
+			spans, err = otlp.ToSpans(request, a.otlpOptions)
 		}
 	default:
 		logrus.WithField("contentType", contentType).Error("unknown content type")
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte("unknown content type"))
-		return
+		return nil, contentType, &decodeError{http.StatusBadRequest, "unknown_content_type", "unknown content type"}
 	}
 	if err != nil {
+		if a.autodetectFormat {
+			if detected := sniffContentType(data); detected != "" && detected != contentType {
+				if retried, detectedType, retryErr := a.decodeSpans(path, detected, data); retryErr == nil {
+					logrus.WithField("type", contentType).WithField("detected", detected).Info("Decoded spans in autodetected format")
+					return retried, detectedType, nil
+				}
+			}
+		}
+		if a.verboseErrors {
+			detail := decodeErrorDetail(err, data)
+			logrus.WithField("type", contentType).Error(detail)
+			return nil, contentType, &decodeError{http.StatusBadRequest, "decode_error", detail}
+		}
 		logrus.WithError(err).WithField("type", contentType).Error("error unmarshaling spans")
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte("error unmarshaling span data"))
-		return
+		return nil, contentType, &decodeError{http.StatusBadRequest, "decode_error", "error unmarshaling span data"}
 	}
+	return spans, contentType, nil
+}
 
-	w.WriteHeader(http.StatusAccepted)
-	for _, span := range spans {
-		a.Receiver.ReceiveSpan(span)
+// receiverFor returns the SpanReceiver for spans posted to path
+func (a *App) receiverFor(path string) SpanReceiver {
+	if receiver, ok := a.Receivers[path]; ok {
+		return receiver
 	}
+	return a.Receiver
+}
+
+// receiveSpans hands each span to receiver, stopping early if
+// ctx is cancelled (typically because the client has disconnected).
+// A BatchSpanReceiver is handed all of the spans in one call
+func (a *App) receiveSpans(ctx context.Context, receiver SpanReceiver, spans []*span.Span) error {
+	if len(spans) == 0 {
+		return nil
+	}
+	// a panic is reported against the span being received, or the
+	// first span of a batch
+	current := spans[0]
+	defer func() {
+		if p := recover(); p != nil {
+			panic(spanPanic{TraceID: current.TraceID, Value: p})
+		}
+	}()
+	if batch, ok := receiver.(BatchSpanReceiver); ok {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		for _, s := range spans {
+			a.stream.publish(s)
+		}
+		batch.ReceiveSpans(spans)
+		return nil
+	}
+	for _, current = range spans {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+		a.stream.publish(current)
+		receiver.ReceiveSpan(current)
+	}
+	return nil
+}
+
+// cancelledIngest records that a request was abandoned by its client
+func (a *App) cancelledIngest(r *http.Request) {
+	clientCancelledIngests.Inc()
+	logrus.WithError(r.Context().Err()).WithField("path", r.URL.Path).Debug("Client cancelled span ingest")
 }
 
 // ungzipWrap wraps a handleFunc and transparently ungzips the body of the
-// request if it is gzipped
-func ungzipWrap(hf func(http.ResponseWriter, *http.Request)) func(http.ResponseWriter, *http.Request) {
+// request if it is gzipped. The body as sent, compressed or not, is
+// limited to --max-body-bytes
+func (a *App) ungzipWrap(hf func(http.ResponseWriter, *http.Request)) func(http.ResponseWriter, *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
-		var newBody io.ReadCloser
+		if a.maxBodyBytes > 0 {
+			r.Body = newLimitedBody(w, r.Body, a.maxBodyBytes)
+		}
 		isGzipped := r.Header.Get("Content-Encoding")
 		if isGzipped == "gzip" {
-			buf := bytes.Buffer{}
-			if _, err := io.Copy(&buf, r.Body); err != nil {
+			buf := a.buffers.get()
+			defer a.buffers.put(buf)
+			if _, err := buf.ReadFrom(r.Body); err == errBodyTooLarge {
+				logrus.WithField("limit", a.maxBodyBytes).Info("Rejecting gzipped request body that is too large")
+				a.writeError(w, r, http.StatusRequestEntityTooLarge, "too_large", err.Error())
+				return
+			} else if err != nil {
 				logrus.WithError(err).Error("error allocating buffer for ungzipping")
-				w.WriteHeader(http.StatusBadRequest)
-				w.Write([]byte("error allocating buffer for ungzipping"))
+				a.writeError(w, r, http.StatusBadRequest, "gzip_error", "error allocating buffer for ungzipping")
 				return
 			}
-			var err error
-			newBody, err = gzip.NewReader(&buf)
+			compressed := buf.Len()
+			gzipReader, err := gzip.NewReader(buf)
 			if err != nil {
 				logrus.WithError(err).Error("error ungzipping span data")
-				w.WriteHeader(http.StatusBadRequest)
-				w.Write([]byte("error ungzipping span data"))
+				a.writeError(w, r, http.StatusBadRequest, "gzip_error", "error ungzipping span data")
 				return
 			}
-			r.Body = newBody
+			// some clients concatenate several gzip members in one body
+			gzipReader.Multistream(true)
+			r.Body = &gzipBody{ReadCloser: gzipReader, compressed: compressed, limit: a.decompressLimit}
 		}
 		hf(w, r)
 	}
@@ -139,12 +552,16 @@ func ungzipWrap(hf func(http.ResponseWriter, *http.Request)) func(http.ResponseW
 
 func (a *App) start() error {
 	mux := http.NewServeMux()
-	mux.HandleFunc("/api/v1/spans", ungzipWrap(a.handleSpans))
-	mux.HandleFunc("/api/v2/spans", ungzipWrap(a.handleSpans))
+	for _, path := range spanPaths {
+		mux.HandleFunc(path, a.methodsWrap(a.recoverWrap(a.ungzipWrap(a.handleSpans)), http.MethodPost))
+	}
 	mux.HandleFunc("/", http.NotFoundHandler().ServeHTTP)
+	// h2c serves HTTP/2 without TLS to clients that ask for it, and
+	// passes HTTP/1.1 requests through unchanged
 	a.server = &http.Server{
-		Addr:    fmt.Sprintf(":%d", a.port),
-		Handler: mux,
+		Addr:           fmt.Sprintf(":%d", a.port),
+		Handler:        h2c.NewHandler(a.shutdownWrap(normalizePathWrap(mux)), &http2.Server{}),
+		MaxHeaderBytes: a.maxHeaderBytes,
 	}
 	go a.server.ListenAndServe()
 	if len(a.OutputLines) > 0 {
@@ -156,12 +573,88 @@ func (a *App) start() error {
 	return nil
 }
 
+// startMetrics listens on the metrics port for prometheus scrapes
+// and the debug endpoints
+func (a *App) startMetrics() {
+	if a.intervalGauges {
+		prometheus.MustRegister(newIntervalCollector())
+	}
+	a.metricsServer = &http.Server{
+		Addr:    fmt.Sprintf(":%d", a.metricsPort),
+		Handler: a.basicAuthWrap(a.metricsMux()),
+	}
+	go func() {
+		if err := a.metricsServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			logrus.WithError(err).WithField("port", a.metricsPort).Error("Error serving metrics")
+		}
+	}()
+}
+
+// metricsMux routes the metrics port's endpoints. The /debug endpoints
+// are left out, and so 404, if they have been disabled
+func (a *App) metricsMux() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", a.methodsWrap(promhttp.Handler().ServeHTTP, http.MethodGet, http.MethodHead))
+	if !a.disableDebug {
+		mux.HandleFunc("/debug/config", a.methodsWrap(handleDebugConfig, http.MethodGet, http.MethodHead))
+		mux.HandleFunc("/debug/stream", a.methodsWrap(a.stream.handle, http.MethodGet))
+		mux.HandleFunc("/debug/decode", a.methodsWrap(a.ungzipWrap(a.handleDebugDecode), http.MethodPost))
+	}
+	return mux
+}
+
+// shutdownWrap wraps a handler so that once shutdown has begun, new
+// requests are refused with a 503 and told to close the connection,
+// so that clients back off rather than seeing connection resets
+func (a *App) shutdownWrap(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&a.shuttingDown) == 1 {
+			w.Header().Set("Connection", "close")
+			a.writeError(w, r, http.StatusServiceUnavailable, "shutting_down", "server is shutting down")
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
 func (a *App) stop() error {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	atomic.StoreInt32(&a.shuttingDown, 1)
+	a.server.SetKeepAlivesEnabled(false)
+	ctx, cancel := context.WithTimeout(context.Background(), a.httpDrainTimeout)
 	defer cancel()
+	if a.metricsServer != nil {
+		a.metricsServer.Shutdown(ctx)
+	}
 	return a.server.Shutdown(ctx)
 }
 
+// flusher is implemented by forwarders that buffer spans outside of
+// their queue
+type flusher interface {
+	Flush() error
+}
+
+// stopForwarder flushes the forwarder and then stops it, giving up on
+// anything it hasn't sent after forwardDrainTimeout. The flush isn't
+// subject to the timeout, so buffered spans are always handed on
+func (a *App) stopForwarder() {
+	if f, ok := a.Forwarder.(flusher); ok {
+		if err := f.Flush(); err != nil {
+			logrus.WithError(err).Error("Error flushing forwarder")
+		}
+	}
+	stopped := make(chan struct{})
+	go func() {
+		a.Forwarder.Stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(a.forwardDrainTimeout):
+		logrus.WithField("timeout", a.forwardDrainTimeout).Warn("Timed out waiting for forwarder to drain")
+	}
+}
+
 // Serve listens for HTTP span requests and prometheus metric requests
 // and creates a forwarder suitable for sending augmented spans upstream
 func (a *App) Serve() {
@@ -172,19 +665,119 @@ func (a *App) Serve() {
 	} else {
 		logrus.SetLevel(level)
 	}
-	logrus.SetFormatter(&logrus.TextFormatter{FullTimestamp: true})
-	if a.collectorURL != "" {
-		logrus.WithField("collectorURL", a.collectorURL).Debug("Creating trace forwarder")
-		a.Forwarder, err = NewForwarder(a.collectorURL)
-		if err != nil {
-			fmt.Printf("%v", err)
+	switch a.logFormat {
+	case "json":
+		logrus.SetFormatter(&logrus.JSONFormatter{})
+	case "text":
+		logrus.SetFormatter(&logrus.TextFormatter{FullTimestamp: true})
+	default:
+		logrus.SetFormatter(&logrus.TextFormatter{FullTimestamp: true})
+		logrus.WithField("logFormat", a.logFormat).Warn("Unknown log format - defaulting to text")
+	}
+	if a.validateOnly {
+		problems := a.configProblems()
+		for _, problem := range problems {
+			fmt.Printf("%v\n", problem)
+		}
+		if len(problems) > 0 {
 			os.Exit(1)
 		}
+		fmt.Println("Configuration is valid")
+		os.Exit(0)
+	}
+	if err := a.validate(); err != nil {
+		fmt.Printf("%v\n", err)
+		os.Exit(1)
+	}
+	a.warnChaos()
+	if a.Receiver == nil {
+		logrus.Warn("No span receiver configured - span requests will fail")
+	}
+	if a.sink == sinkFile {
+		logrus.WithField("outputFile", a.outputFile).Debug("Creating file forwarder")
+		a.Forwarder = &FileForwarder{Path: a.outputFile}
+		if err := a.Forwarder.Start(); err != nil {
+			fmt.Printf("%v\n", err)
+			os.Exit(1)
+		}
+		defer a.stopForwarder()
+	} else if a.collectorURL != "" {
+		logrus.WithField("collectorURL", a.collectorURL).Debug("Creating trace forwarder")
+		if a.tolerateInitFailure {
+			a.Forwarder = newLazyForwarder(a.resolvedForwarder, 5*time.Second)
+		} else {
+			forwarder, err := a.newForwarder()
+			if err != nil {
+				fmt.Printf("%v\n", err)
+				os.Exit(1)
+			}
+			a.Forwarder = forwarder
+		}
 		a.Forwarder.Start()
-		defer a.Forwarder.Stop()
+		defer a.stopForwarder()
 	} else {
 		a.Forwarder = nil
 	}
+	if err := a.addBuiltinTransformers(); err != nil {
+		fmt.Printf("%v\n", err)
+		os.Exit(1)
+	}
+	if a.spansPerTraceWindow > 0 {
+		counter := &traceCounter{Window: a.spansPerTraceWindow, Clock: a.Clock}
+		counter.Start()
+		defer counter.Stop()
+		a.Transformers = append([]SpanTransformer{counter}, a.Transformers...)
+	}
+	if a.analyticsURL != "" {
+		forwarder, err := NewForwarder(a.analyticsURL)
+		if err != nil {
+			fmt.Printf("%v\n", err)
+			os.Exit(1)
+		}
+		forwarder.Name = "analytics"
+		forwarder.MaxConcurrency = 4
+		forwarder.UserAgent = a.forwardUserAgent
+		forwarder.Start()
+		defer forwarder.Stop()
+		if a.Receiver != nil {
+			tap := a.analyticsTap(a.Receiver, forwarder)
+			defer tap.Stop()
+			a.Receiver = tap
+		}
+		for path, receiver := range a.Receivers {
+			tap := a.analyticsTap(receiver, forwarder)
+			defer tap.Stop()
+			a.Receivers[path] = tap
+		}
+	}
+	if a.tailSamplingWindow > 0 {
+		if a.Receiver != nil {
+			sampler := a.tailSample(a.Receiver)
+			defer sampler.Stop()
+			a.Receiver = sampler
+		}
+		for path, receiver := range a.Receivers {
+			sampler := a.tailSample(receiver)
+			defer sampler.Stop()
+			a.Receivers[path] = sampler
+		}
+	}
+	if a.redMetrics {
+		if a.Receiver != nil {
+			a.Receiver = a.redRecorder(a.Receiver)
+		}
+		for path, receiver := range a.Receivers {
+			a.Receivers[path] = a.redRecorder(receiver)
+		}
+	}
+	if a.stdin {
+		// returning runs the deferred stops, which drain the forwarder
+		if err := a.ingestReader(os.Stdin, a.stdinFormat); err != nil {
+			fmt.Printf("%v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
 	err = a.start()
 	defer a.stop()
 	if err != nil {
@@ -192,15 +785,198 @@ func (a *App) Serve() {
 		os.Exit(1)
 	}
 
-	http.Handle("/metrics", promhttp.Handler())
-	http.ListenAndServe(fmt.Sprintf(":%d", a.metricsPort), nil)
-	waitForSignal()
+	a.startMetrics()
+	if a.statsInterval > 0 {
+		reporter := &statsReporter{Interval: a.statsInterval, Forwarder: a.Forwarder}
+		reporter.Start()
+		defer reporter.Stop()
+	}
+	a.waitForSignal()
+}
+
+// validate checks settings that flag parsing can't
+func (a *App) validate() error {
+	if a.successStatus < 200 || a.successStatus > 299 {
+		return fmt.Errorf("invalid ingest-success-status %d. Must be a 2xx status", a.successStatus)
+	}
+	if a.ingestLimit.Rate > 0 && a.ingestLimit.Burst == 0 {
+		a.ingestLimit.Burst = a.ingestLimit.Rate
+	}
+	if a.chaosDropRate < 0 || a.chaosDropRate > 1 {
+		return fmt.Errorf("invalid chaos-drop-rate %v. Must be between 0 and 1", a.chaosDropRate)
+	}
+	if a.sink != "" && a.sink != sinkCollector && a.sink != sinkFile {
+		return fmt.Errorf("invalid sink %s. Must be %s or %s", a.sink, sinkCollector, sinkFile)
+	}
+	if a.queueHighWater < 0 || a.queueHighWater > 1 {
+		return fmt.Errorf("invalid forward-queue-high-water %v. Must be between 0 and 1", a.queueHighWater)
+	}
+	if len(a.keepIf) > 0 && a.tailSamplingWindow == 0 {
+		return errors.New("keep-if requires tail-sampling-window to be set")
+	}
+	return nil
+}
+
+// configProblems makes the checks Serve makes before starting, without
+// starting anything, and returns every problem found rather than
+// stopping at the first. Log settings, which Serve only warns about,
+// count as problems too
+func (a *App) configProblems() []error {
+	var problems []error
+	if _, err := logrus.ParseLevel(a.logLevel); err != nil {
+		problems = append(problems, fmt.Errorf("invalid log-level %s", a.logLevel))
+	}
+	if a.logFormat != "" && a.logFormat != "text" && a.logFormat != "json" {
+		problems = append(problems, fmt.Errorf("invalid log-format %s. Must be text or json", a.logFormat))
+	}
+	if err := a.validate(); err != nil {
+		problems = append(problems, err)
+	}
+	if a.sink != sinkFile && a.collectorURL != "" {
+		if _, err := a.newForwarder(); err != nil {
+			problems = append(problems, err)
+		}
+	}
+	if a.analyticsURL != "" {
+		if _, err := NewForwarder(a.analyticsURL); err != nil {
+			problems = append(problems, err)
+		}
+	}
+	transformers := a.Transformers
+	if err := a.addBuiltinTransformers(); err != nil {
+		problems = append(problems, err)
+	}
+	a.Transformers = transformers
+	return problems
+}
+
+// newForwarder creates a Forwarder to the collector configured by
+// command line flags
+func (a *App) newForwarder() (*Forwarder, error) {
+	forwarder, err := NewForwarder(a.collectorURL)
+	if err != nil {
+		return nil, err
+	}
+	if err := forwarder.SetFormat(a.forwardFormat); err != nil {
+		return nil, err
+	}
+	if err := forwarder.SetJSONSchema(a.forwardJSONSchema); err != nil {
+		return nil, err
+	}
+	forwarder.JSON.UpperCaseIDs = a.forwardUpperCaseIDs
+	forwarder.Name = a.forwardName
+	forwarder.PreserveTraceOrder = a.preserveTraceOrder
+	forwarder.SortBatch = a.sortBatch
+	forwarder.MaxBatchBytes = a.maxBatchBytes
+	forwarder.Delay = a.chaosDelay
+	forwarder.Retry = a.forwardRetry
+	forwarder.BatchSize = a.forwardBatchSize
+	forwarder.FlushInterval = a.forwardFlush
+	forwarder.MinFlushInterval = a.forwardMinFlush
+	forwarder.MaxFlushInterval = a.forwardMaxFlush
+	forwarder.UserAgent = a.forwardUserAgent
+	forwarder.Clock = a.Clock
+	if a.deadLetterURL != "" {
+		if forwarder.DeadLetterURL, err = parseHTTPURL(a.deadLetterURL); err != nil {
+			return nil, err
+		}
+	}
+	forwarder.SigningSecret, err = a.signingSecret()
+	if err != nil {
+		return nil, err
+	}
+	forwarder.TLSConfig, err = a.forwardTLSConfig()
+	if err != nil {
+		return nil, err
+	}
+	if a.credentialsFile != "" {
+		credentials, err := readCredentials(a.credentialsFile)
+		if err != nil {
+			return nil, err
+		}
+		forwarder.SetCredentials(credentials)
+	}
+	return forwarder, nil
 }
 
-func waitForSignal() {
+// resolvedForwarder creates a forwarder, as newForwarder, but also
+// fails if the collector host can't be resolved yet
+func (a *App) resolvedForwarder() (SpanForwarder, error) {
+	forwarder, err := a.newForwarder()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := net.LookupHost(forwarder.DownstreamURL.Hostname()); err != nil {
+		return nil, err
+	}
+	return forwarder, nil
+}
+
+// signingSecret reads the forward signing secret from the configured
+// file, falling back to the environment
+func (a *App) signingSecret() ([]byte, error) {
+	if a.signingSecretFile == "" {
+		return []byte(os.Getenv(signingSecretEnv)), nil
+	}
+	secret, err := ioutil.ReadFile(a.signingSecretFile)
+	if err != nil {
+		return nil, fmt.Errorf("error reading signing secret: %v", err)
+	}
+	return bytes.TrimRight(secret, "\r\n"), nil
+}
+
+// tailSample returns a started TailSampler passing kept traces to receiver
+func (a *App) tailSample(receiver SpanReceiver) *TailSampler {
+	sampler := &TailSampler{Next: receiver, Window: a.tailSamplingWindow, LatencyThreshold: a.tailSamplingLatency, KeepIf: a.keepIf, Clock: a.Clock}
+	sampler.Start()
+	return sampler
+}
+
+// redRecorder returns a redRecorder passing spans on to receiver,
+// sharing the App's service label limit
+func (a *App) redRecorder(receiver SpanReceiver) *redRecorder {
+	return &redRecorder{Next: receiver, Services: &a.serviceLabels, Operations: &a.operationLabels}
+}
+
+// analyticsTap starts a tap copying spans received by receiver to
+// forwarder
+func (a *App) analyticsTap(receiver SpanReceiver, forwarder SpanForwarder) *analyticsTap {
+	tap := &analyticsTap{Next: receiver, Forwarder: forwarder}
+	tap.Start()
+	return tap
+}
+
+// waitForSignal returns once the process is told to stop, dumping the
+// forwarder queue whenever a dump signal arrives in the meantime and
+// reopening the forwarder's output on SIGHUP
+func (a *App) waitForSignal() {
 	ch := make(chan os.Signal, 1)
 	defer close(ch)
-	signal.Notify(ch, syscall.SIGINT, syscall.SIGTERM)
+	signal.Notify(ch, append([]os.Signal{syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP}, dumpSignals...)...)
 	defer signal.Stop(ch)
-	<-ch
+	for sig := range ch {
+		switch sig {
+		case syscall.SIGINT, syscall.SIGTERM:
+			return
+		case syscall.SIGHUP:
+			a.reopenForwarder()
+			a.reloadCredentials()
+		default:
+			a.dumpQueue()
+		}
+	}
+}
+
+// reopener is implemented by forwarders writing to files that can be
+// reopened after rotation
+type reopener interface {
+	Reopen() error
+}
+
+func (a *App) reopenForwarder() {
+	if r, ok := a.Forwarder.(reopener); ok {
+		if err := r.Reopen(); err != nil {
+			logrus.WithError(err).Error("Error reopening forwarder output")
+		}
+	}
 }
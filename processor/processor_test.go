@@ -1,8 +1,20 @@
 package processor
 
 import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
 	"flag"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/willthames/opentracing-processor/otlp"
+	"github.com/willthames/opentracing-processor/span"
 )
 
 type DummyApp struct {
@@ -17,9 +29,435 @@ func NewDummyApp() *DummyApp {
 	return dummyApp
 }
 
+type recordingReceiver struct {
+	spans []*span.Span
+}
+
+func (rr *recordingReceiver) ReceiveSpan(span *span.Span) {
+	rr.spans = append(rr.spans, span)
+}
+
 func TestProcessor(t *testing.T) {
 	dummyApp := NewDummyApp()
 	if dummyApp.port != 8080 || dummyApp.metricsPort != 10010 {
 		t.Errorf("dummyApp not correctly set up: %#v", dummyApp)
 	}
 }
+
+func TestCancelledIngest(t *testing.T) {
+	receiver := new(recordingReceiver)
+	app := &App{Receiver: receiver}
+	body := []byte(`[{"traceId":"0000000000000001","id":"0000000000000001","name":"cancelled"}]`)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	r := httptest.NewRequest("POST", "/api/v1/spans", bytes.NewReader(body)).WithContext(ctx)
+	r.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	app.handleSpans(w, r)
+	if len(receiver.spans) != 0 {
+		t.Errorf("expected no spans to be received after cancellation, got %d", len(receiver.spans))
+	}
+
+	r = httptest.NewRequest("POST", "/api/v1/spans", bytes.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	app.handleSpans(w, r)
+	if w.Code != http.StatusAccepted || len(receiver.spans) != 1 {
+		t.Errorf("expected one span to be accepted, got status %d and %d spans", w.Code, len(receiver.spans))
+	}
+}
+
+func TestErrorFormat(t *testing.T) {
+	app := &App{Receiver: new(recordingReceiver)}
+	r := httptest.NewRequest("POST", "/api/v2/spans", bytes.NewReader([]byte{}))
+	r.Header.Set("Content-Type", "application/x-thrift")
+	w := httptest.NewRecorder()
+	app.handleSpans(w, r)
+	if w.Code != http.StatusBadRequest || w.Body.String() != "thrift is not supported for v2 spans" {
+		t.Errorf("unexpected plain text error response %d %q", w.Code, w.Body.String())
+	}
+
+	r.Header.Set("Accept", "application/json")
+	w = httptest.NewRecorder()
+	app.handleSpans(w, r)
+	var resp errorResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("error response was not json: %v", err)
+	}
+	if w.Code != http.StatusBadRequest || resp.Code != "thrift_v2_unsupported" {
+		t.Errorf("unexpected json error response %d %#v", w.Code, resp)
+	}
+}
+
+func TestVerboseErrors(t *testing.T) {
+	app := &App{Receiver: new(recordingReceiver)}
+	body := []byte(`[{"traceId":"0000000000000001","id":}]`)
+	post := func() string {
+		r := httptest.NewRequest("POST", "/api/v1/spans", bytes.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		app.handleSpans(w, r)
+		return w.Body.String()
+	}
+	if resp := post(); resp != "error unmarshaling span data" {
+		t.Errorf("expected a generic decode error by default, got %q", resp)
+	}
+	app.verboseErrors = true
+	if resp := post(); !strings.Contains(resp, "at byte 37") || !strings.Contains(resp, `\"id\":}]`) {
+		t.Errorf("expected the offset and snippet in a verbose decode error, got %q", resp)
+	}
+}
+
+func TestRouteReceivers(t *testing.T) {
+	v1 := new(recordingReceiver)
+	v2 := new(recordingReceiver)
+	app := &App{Receiver: v1, Receivers: map[string]SpanReceiver{"/api/v2/spans": v2}}
+	body := []byte(`[{"traceId":"0000000000000001","id":"0000000000000001","name":"routed"}]`)
+	for _, path := range []string{"/api/v1/spans", "/api/v2/spans", "/api/v2/spans"} {
+		r := httptest.NewRequest("POST", path, bytes.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+		app.handleSpans(httptest.NewRecorder(), r)
+	}
+	if len(v1.spans) != 1 || len(v2.spans) != 2 {
+		t.Errorf("spans not routed by path: v1 got %d, v2 got %d", len(v1.spans), len(v2.spans))
+	}
+}
+
+func TestMultiMemberGzip(t *testing.T) {
+	receiver := new(recordingReceiver)
+	app := &App{Receiver: receiver}
+	var body bytes.Buffer
+	for _, member := range []string{
+		`[{"traceId":"0000000000000001","id":"0000000000000001","name":"first"}]`,
+		`[{"traceId":"0000000000000001","id":"0000000000000002","name":"second"}]`,
+	} {
+		zw := gzip.NewWriter(&body)
+		zw.Write([]byte(member))
+		zw.Close()
+	}
+	r := httptest.NewRequest("POST", "/api/v1/spans", &body)
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("Content-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	app.ungzipWrap(app.handleSpans)(w, r)
+	if w.Code != http.StatusAccepted || len(receiver.spans) != 2 {
+		t.Errorf("expected both gzip members to be decoded, got status %d and %d spans", w.Code, len(receiver.spans))
+	}
+}
+
+func TestShutdownRejectsRequests(t *testing.T) {
+	app := &App{Receiver: new(recordingReceiver)}
+	handler := app.shutdownWrap(http.HandlerFunc(app.handleSpans))
+	app.shuttingDown = 1
+	r := httptest.NewRequest("POST", "/api/v1/spans", bytes.NewReader([]byte("[]")))
+	r.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("Connection") != "close" {
+		t.Errorf("expected 503 with Connection: close during shutdown, got %d %v", w.Code, w.Header())
+	}
+}
+
+func TestIngestSuccessStatus(t *testing.T) {
+	app := &App{Receiver: new(recordingReceiver), successStatus: http.StatusNoContent}
+	if err := app.validate(); err != nil {
+		t.Errorf("204 should be a valid success status: %v", err)
+	}
+	r := httptest.NewRequest("POST", "/api/v1/spans", bytes.NewReader([]byte("[]")))
+	r.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	app.handleSpans(w, r)
+	if w.Code != http.StatusNoContent {
+		t.Errorf("expected configured success status 204, got %d", w.Code)
+	}
+	app.successStatus = http.StatusFound
+	if err := app.validate(); err == nil {
+		t.Errorf("302 should not be a valid success status")
+	}
+}
+
+// stuckForwarder is a forwarder that never finishes stopping
+type stuckForwarder struct {
+	MemoryForwarder
+}
+
+func (f *stuckForwarder) Stop() error {
+	select {}
+}
+
+func TestForwardDrainTimeout(t *testing.T) {
+	app := &App{Forwarder: new(stuckForwarder), forwardDrainTimeout: 10 * time.Millisecond}
+	done := make(chan struct{})
+	go func() {
+		app.stopForwarder()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Errorf("stopForwarder should give up after the drain timeout")
+	}
+}
+
+// flushingForwarder is a stuck forwarder that records being flushed
+type flushingForwarder struct {
+	stuckForwarder
+	flushed bool
+}
+
+func (f *flushingForwarder) Flush() error {
+	f.flushed = true
+	return nil
+}
+
+func TestFlushBeforeDrain(t *testing.T) {
+	forwarder := new(flushingForwarder)
+	app := &App{Forwarder: forwarder, forwardDrainTimeout: time.Millisecond}
+	app.stopForwarder()
+	if !forwarder.flushed {
+		t.Errorf("expected the forwarder to be flushed even though draining timed out")
+	}
+}
+
+type panickingReceiver struct{}
+
+func (panickingReceiver) ReceiveSpan(s *span.Span) {
+	panic("malformed span")
+}
+
+func TestRecoverPanic(t *testing.T) {
+	app := &App{Receiver: panickingReceiver{}}
+	r := httptest.NewRequest("POST", "/api/v1/spans", bytes.NewReader([]byte(`[{"traceId":"1","id":"1"}]`)))
+	r.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	app.recoverWrap(app.handleSpans)(w, r)
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("expected 500 after a receiver panic, got %d", w.Code)
+	}
+}
+
+type panickingBatchReceiver struct {
+	panickingReceiver
+}
+
+func (panickingBatchReceiver) ReceiveSpans(spans []*span.Span) {
+	panic("malformed batch")
+}
+
+func TestRecoverBatchPanic(t *testing.T) {
+	hook := test.NewGlobal()
+	defer hook.Reset()
+	app := &App{Receiver: panickingBatchReceiver{}}
+	r := httptest.NewRequest("POST", "/api/v1/spans", bytes.NewReader([]byte(`[{"traceId":"1","id":"1"}]`)))
+	r.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	app.recoverWrap(app.handleSpans)(w, r)
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("expected 500 after a batch receiver panic, got %d", w.Code)
+	}
+	if entry := hook.LastEntry(); entry == nil || entry.Data["traceID"] != "1" {
+		t.Errorf("expected the panic to be logged with the batch's trace ID, got %v", entry)
+	}
+}
+
+func TestRejectInvalid(t *testing.T) {
+	receiver := new(recordingReceiver)
+	app := &App{Receiver: receiver}
+	body := []byte(`[{"traceId":"0123456789ab","id":"0123456789abcdef"}]`)
+	r := httptest.NewRequest("POST", "/api/v1/spans", bytes.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	app.handleSpans(w, r)
+	if w.Code != http.StatusAccepted || len(receiver.spans) != 1 {
+		t.Errorf("expected invalid span to be accepted by default, got status %d and %d spans", w.Code, len(receiver.spans))
+	}
+
+	app.rejectInvalid = true
+	r = httptest.NewRequest("POST", "/api/v1/spans", bytes.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("Accept", "application/json")
+	w = httptest.NewRecorder()
+	app.handleSpans(w, r)
+	var resp errorResponse
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if w.Code != http.StatusBadRequest || resp.Code != "invalid_id" {
+		t.Errorf("expected invalid_id rejection, got %d %#v", w.Code, resp)
+	}
+}
+
+func TestNoReceiver(t *testing.T) {
+	app := &App{}
+	r := httptest.NewRequest("POST", "/api/v1/spans", bytes.NewReader([]byte(`[{"traceId":"1","id":"1"}]`)))
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("Accept", "application/json")
+	w := httptest.NewRecorder()
+	app.handleSpans(w, r)
+	var resp errorResponse
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if w.Code != http.StatusInternalServerError || resp.Code != "no_receiver" {
+		t.Errorf("expected no_receiver error, got %d %#v", w.Code, resp)
+	}
+}
+
+func TestIngestRateLimit(t *testing.T) {
+	receiver := new(recordingReceiver)
+	app := &App{Receiver: receiver, ingestLimit: tokenBucket{Rate: 1, Burst: 2}}
+	post := func() *httptest.ResponseRecorder {
+		r := httptest.NewRequest("POST", "/api/v1/spans", bytes.NewReader([]byte(`[{"traceId":"1","id":"1"},{"traceId":"1","id":"2"}]`)))
+		r.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		app.handleSpans(w, r)
+		return w
+	}
+	if w := post(); w.Code != http.StatusAccepted {
+		t.Errorf("expected spans within the burst to be accepted, got %d", w.Code)
+	}
+	if w := post(); w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "2" {
+		t.Errorf("expected 429 with Retry-After 2, got %d %v", w.Code, w.Header())
+	}
+	if len(receiver.spans) != 2 {
+		t.Errorf("expected rate limited spans not to be received, got %d", len(receiver.spans))
+	}
+}
+
+func TestQueueHighWater(t *testing.T) {
+	forwarder := &Forwarder{payloads: []chan Payload{make(chan Payload, 4)}}
+	receiver := new(recordingReceiver)
+	app := &App{Receiver: receiver, Forwarder: forwarder, queueHighWater: 0.5}
+	post := func() *httptest.ResponseRecorder {
+		r := httptest.NewRequest("POST", "/api/v1/spans", bytes.NewReader([]byte(`[{"traceId":"1","id":"1"}]`)))
+		r.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		app.handleSpans(w, r)
+		return w
+	}
+	forwarder.Send(Payload{Body: []byte("1")})
+	if w := post(); w.Code != http.StatusAccepted {
+		t.Errorf("expected spans to be accepted below the high-water mark, got %d", w.Code)
+	}
+	forwarder.Send(Payload{Body: []byte("2")})
+	if w := post(); w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "1" {
+		t.Errorf("expected 429 at the high-water mark, got %d %v", w.Code, w.Header())
+	}
+	if len(receiver.spans) != 1 {
+		t.Errorf("expected refused spans not to be received, got %d", len(receiver.spans))
+	}
+}
+
+func TestConfigProblems(t *testing.T) {
+	valid := &App{logLevel: "Info", successStatus: http.StatusAccepted, collectorURL: "http://localhost:9411", forwardFormat: FormatZipkin, forwardJSONSchema: span.SchemaV1}
+	if problems := valid.configProblems(); len(problems) != 0 {
+		t.Errorf("expected no problems, got %v", problems)
+	}
+	if len(valid.Transformers) != 0 {
+		t.Errorf("expected validation to leave the pipeline alone, got %d transformers", len(valid.Transformers))
+	}
+
+	invalid := &App{
+		logLevel:          "loud",
+		successStatus:     http.StatusAccepted,
+		collectorURL:      "http://localhost:9411",
+		forwardFormat:     FormatZipkin,
+		forwardJSONSchema: span.SchemaV1,
+		analyticsURL:      "localhost:9412",
+		dedupeAnnotations: "middle",
+		forwardClientCert: "missing.pem",
+	}
+	if problems := invalid.configProblems(); len(problems) != 4 {
+		t.Errorf("expected log level, client cert, analytics url and dedupe problems, got %v", problems)
+	}
+}
+
+func TestV2Ingest(t *testing.T) {
+	receiver := new(recordingReceiver)
+	app := &App{Receiver: receiver}
+	body := `[{"traceId":"5af7183fb1d4cf5f","id":"352bff9a74ca9ad2","kind":"CLIENT","localEndpoint":{"serviceName":"frontend"},"tags":{"http.path":"/api"}}]`
+	r := httptest.NewRequest("POST", "/api/v2/spans", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	app.handleSpans(w, r)
+	if w.Code != http.StatusAccepted || len(receiver.spans) != 1 {
+		t.Fatalf("expected the v2 span to be accepted, got %d: %s", w.Code, w.Body)
+	}
+	s := receiver.spans[0]
+	if s.Kind != span.KindClient || s.ServiceName() != "frontend" || len(s.BinaryAnnotations) != 1 || s.BinaryAnnotations[0].Key != "http.path" {
+		t.Errorf("expected kind, service and tags to survive v2 decoding, got %v", s)
+	}
+}
+
+func TestOTLPIngest(t *testing.T) {
+	request := &otlp.ExportTraceServiceRequest{ResourceSpans: []*otlp.ResourceSpans{{
+		Resource: &otlp.Resource{Attributes: []*otlp.KeyValue{{Key: "service.name", Value: "checkout"}}},
+		ScopeSpans: []*otlp.ScopeSpans{{Spans: []*otlp.Span{
+			{TraceID: bytes.Repeat([]byte{1}, 16), SpanID: bytes.Repeat([]byte{2}, 8), Name: "pay", Kind: otlp.SpanKindClient},
+			{TraceID: bytes.Repeat([]byte{1}, 16), SpanID: bytes.Repeat([]byte{3}, 8), Name: "charge",
+				Attributes: []*otlp.KeyValue{{Key: "amount", Value: int64(5)}}},
+		}}},
+	}}}
+	post := func(request *otlp.ExportTraceServiceRequest) (*recordingReceiver, *httptest.ResponseRecorder) {
+		body, _ := request.Marshal()
+		receiver := new(recordingReceiver)
+		app := &App{Receiver: receiver}
+		r := httptest.NewRequest("POST", "/v1/traces", bytes.NewReader(body))
+		r.Header.Set("Content-Type", "application/x-protobuf")
+		w := httptest.NewRecorder()
+		app.handleSpans(w, r)
+		return receiver, w
+	}
+
+	receiver, w := post(request)
+	if w.Code != http.StatusOK || len(receiver.spans) != 2 {
+		t.Fatalf("expected 2 OTLP spans to be accepted, got %d and %d spans: %s", w.Code, len(receiver.spans), w.Body)
+	}
+	if contentType := w.Header().Get("Content-Type"); contentType != "application/x-protobuf" || w.Body.Len() != 0 {
+		t.Errorf("expected an empty protobuf export response, got %q %x", contentType, w.Body.Bytes())
+	}
+	for _, s := range receiver.spans {
+		if s.ServiceName() != "checkout" {
+			t.Errorf("expected service name from the resource, got %q", s.ServiceName())
+		}
+	}
+	if tag := receiver.spans[1].BinaryAnnotations[0]; tag.Key != "amount" || tag.Value != int64(5) {
+		t.Errorf("expected attribute as a binary annotation, got %v", tag)
+	}
+
+	request.ResourceSpans[0].ScopeSpans[0].Spans[0].TraceID = nil
+	if receiver, w := post(request); w.Code != http.StatusBadRequest || len(receiver.spans) != 0 {
+		t.Errorf("expected a span without a trace ID to be rejected, got %d", w.Code)
+	}
+}
+
+type batchRecordingReceiver struct {
+	recordingReceiver
+	batches [][]*span.Span
+}
+
+func (br *batchRecordingReceiver) ReceiveSpans(spans []*span.Span) {
+	br.batches = append(br.batches, spans)
+}
+
+func TestBatchSpanReceiver(t *testing.T) {
+	body := `[{"traceId":"0123456789abcdef","id":"0123456789abcdef"},{"traceId":"0123456789abcdef","id":"0123456789abcdee"}]`
+	post := func(app *DummyApp, body string) int {
+		r := httptest.NewRequest("POST", "/api/v1/spans", strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		app.handleSpans(w, r)
+		return w.Code
+	}
+
+	batch := new(batchRecordingReceiver)
+	app := &DummyApp{App: App{Receiver: batch}}
+	if code := post(app, body); code != http.StatusAccepted || len(batch.batches) != 1 || len(batch.batches[0]) != 2 || len(batch.spans) != 0 {
+		t.Errorf("expected one batch of two spans, got status %d and batches %v", code, batch.batches)
+	}
+	if code := post(app, "[]"); code != http.StatusAccepted || len(batch.batches) != 1 {
+		t.Errorf("expected no spans to be a no-op, got status %d and %d batches", code, len(batch.batches))
+	}
+
+	single := new(recordingReceiver)
+	app = &DummyApp{App: App{Receiver: single}}
+	if code := post(app, body); code != http.StatusAccepted || len(single.spans) != 2 {
+		t.Errorf("expected spans to be received one at a time, got status %d and %d spans", code, len(single.spans))
+	}
+}
@@ -0,0 +1,51 @@
+package processor
+
+import (
+	"math"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// tokenBucket limits the rate at which spans are accepted. It holds up
+// to Burst tokens, refilled at Rate per second, and each span takes
+// one
+type tokenBucket struct {
+	Rate  float64
+	Burst float64
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// take removes n tokens, returning whether there were enough and, if
+// not, how long until there will be. To stop batches larger than
+// Burst being refused forever, a full bucket always admits a batch,
+// leaving it owing the difference
+func (b *tokenBucket) take(n int, now time.Time) (bool, time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.last.IsZero() {
+		b.tokens = b.Burst
+	} else {
+		b.tokens = math.Min(b.Burst, b.tokens+now.Sub(b.last).Seconds()*b.Rate)
+	}
+	b.last = now
+	needed := math.Min(float64(n), b.Burst)
+	if b.tokens < needed {
+		return false, time.Duration((needed - b.tokens) / b.Rate * float64(time.Second))
+	}
+	b.tokens -= float64(n)
+	return true, 0
+}
+
+// retryAfter formats a wait as a Retry-After header value, in whole
+// seconds rounded up
+func retryAfter(wait time.Duration) string {
+	seconds := int(math.Ceil(wait.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	return strconv.Itoa(seconds)
+}
@@ -0,0 +1,30 @@
+package processor
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTokenBucket(t *testing.T) {
+	b := &tokenBucket{Rate: 10, Burst: 20}
+	now := time.Now()
+	if ok, _ := b.take(15, now); !ok {
+		t.Errorf("expected spans within the burst to be accepted")
+	}
+	ok, wait := b.take(10, now)
+	if ok || wait != 500*time.Millisecond {
+		t.Errorf("expected to wait 500ms for 5 more tokens, got %v %v", ok, wait)
+	}
+	if ok, _ := b.take(10, now.Add(500*time.Millisecond)); !ok {
+		t.Errorf("expected tokens to be refilled at the rate")
+	}
+	if ok, _ := b.take(50, now.Add(time.Hour)); !ok {
+		t.Errorf("expected a batch larger than the burst to be accepted by a full bucket")
+	}
+	if ok, _ := b.take(1, now.Add(time.Hour+time.Second)); ok {
+		t.Errorf("expected the oversized batch to be paid back before more spans are accepted")
+	}
+	if retryAfter(200*time.Millisecond) != "1" || retryAfter(1500*time.Millisecond) != "2" {
+		t.Errorf("expected Retry-After rounded up to whole seconds")
+	}
+}
@@ -0,0 +1,108 @@
+package processor
+
+import (
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// rateLimitedLog logs the first occurrence of a message and then at
+// most once per interval, reporting how many repeats were suppressed
+// in between. This stops a persistent failure flooding the logs.
+// Suppressed repeats are reported when the interval ends even if the
+// message stops recurring, so that the size of a flood isn't hidden
+type rateLimitedLog struct {
+	interval time.Duration
+	clock    Clock
+
+	mu   sync.Mutex
+	seen map[string]*logOccurrence
+}
+
+type logOccurrence struct {
+	last       time.Time
+	suppressed int
+	// entry is the most recent suppressed entry, and timer reports it
+	// once the interval ends
+	entry *logrus.Entry
+	timer *time.Timer
+}
+
+func newRateLimitedLog(interval time.Duration) *rateLimitedLog {
+	return &rateLimitedLog{interval: interval, seen: make(map[string]*logOccurrence)}
+}
+
+// Info logs msg at info level unless it was already logged within
+// the interval
+func (l *rateLimitedLog) Info(entry *logrus.Entry, msg string) {
+	if entry, ok := l.allow(entry, msg); ok {
+		entry.Info(msg)
+	}
+}
+
+func (l *rateLimitedLog) allow(entry *logrus.Entry, msg string) (*logrus.Entry, bool) {
+	now := now(l.clock)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	occurrence, ok := l.seen[msg]
+	if !ok {
+		l.seen[msg] = &logOccurrence{last: now}
+		return entry, true
+	}
+	if now.Sub(occurrence.last) < l.interval {
+		occurrence.suppressed++
+		occurrence.entry = entry
+		if occurrence.timer == nil {
+			occurrence.timer = time.AfterFunc(l.interval-now.Sub(occurrence.last), func() {
+				l.report(msg)
+			})
+		}
+		return entry, false
+	}
+	if occurrence.suppressed > 0 {
+		entry = entry.WithField("suppressed", occurrence.suppressed)
+	}
+	l.reset(occurrence, now)
+	return entry, true
+}
+
+// report logs how many repeats of msg have been suppressed, if any
+func (l *rateLimitedLog) report(msg string) {
+	l.mu.Lock()
+	occurrence, ok := l.seen[msg]
+	if !ok || occurrence.suppressed == 0 {
+		l.mu.Unlock()
+		return
+	}
+	entry := occurrence.entry.WithField("suppressed", occurrence.suppressed)
+	l.reset(occurrence, now(l.clock))
+	l.mu.Unlock()
+	entry.Info(msg)
+}
+
+// Flush logs how many repeats of every message have been suppressed
+// without waiting for their intervals to end, e.g. when stopping
+func (l *rateLimitedLog) Flush() {
+	l.mu.Lock()
+	msgs := make([]string, 0, len(l.seen))
+	for msg := range l.seen {
+		msgs = append(msgs, msg)
+	}
+	l.mu.Unlock()
+	for _, msg := range msgs {
+		l.report(msg)
+	}
+}
+
+// reset starts a new interval for occurrence, which was last logged
+// at now
+func (l *rateLimitedLog) reset(occurrence *logOccurrence, now time.Time) {
+	if occurrence.timer != nil {
+		occurrence.timer.Stop()
+		occurrence.timer = nil
+	}
+	occurrence.last = now
+	occurrence.suppressed = 0
+	occurrence.entry = nil
+}
@@ -0,0 +1,64 @@
+package processor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+)
+
+func TestRateLimitedLog(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(1480979203, 0)}
+	l := newRateLimitedLog(time.Hour)
+	l.clock = clock
+	entry := logrus.NewEntry(logrus.StandardLogger())
+	if _, ok := l.allow(entry, "collector down"); !ok {
+		t.Errorf("first occurrence should be logged")
+	}
+	for i := 0; i < 5; i++ {
+		if _, ok := l.allow(entry, "collector down"); ok {
+			t.Errorf("repeat within interval should be suppressed")
+		}
+	}
+	if _, ok := l.allow(entry, "other error"); !ok {
+		t.Errorf("different message should be logged")
+	}
+	clock.Advance(2 * time.Hour)
+	logged, ok := l.allow(entry, "collector down")
+	if !ok || logged.Data["suppressed"] != 5 {
+		t.Errorf("expected summary of 5 suppressed messages, got %v", logged.Data)
+	}
+}
+
+func TestRateLimitedLogReportsAfterFlood(t *testing.T) {
+	logger, hook := test.NewNullLogger()
+	entry := logrus.NewEntry(logger)
+	l := newRateLimitedLog(10 * time.Millisecond)
+	for i := 0; i < 4; i++ {
+		l.Info(entry, "collector down")
+	}
+	for deadline := time.Now().Add(5 * time.Second); len(hook.AllEntries()) < 2; {
+		if time.Now().After(deadline) {
+			t.Fatal("expected suppressed repeats to be reported once the interval ended")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if last := hook.LastEntry(); last.Data["suppressed"] != 3 || last.Message != "collector down" {
+		t.Errorf("expected a summary of 3 suppressed messages, got %v", last.Data)
+	}
+
+	l = newRateLimitedLog(time.Hour)
+	hook.Reset()
+	for i := 0; i < 3; i++ {
+		l.Info(entry, "collector down")
+	}
+	l.Flush()
+	if entries := hook.AllEntries(); len(entries) != 2 || entries[1].Data["suppressed"] != 2 {
+		t.Errorf("expected Flush to report 2 suppressed messages, got %v", entries)
+	}
+	l.Flush()
+	if len(hook.AllEntries()) != 2 {
+		t.Errorf("expected nothing more to report")
+	}
+}
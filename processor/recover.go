@@ -0,0 +1,55 @@
+package processor
+
+import (
+	"net/http"
+	"runtime/debug"
+
+	"github.com/sirupsen/logrus"
+)
+
+// spanPanic wraps a panic raised by a SpanReceiver with the trace ID
+// of the span it was receiving
+type spanPanic struct {
+	TraceID string
+	Value   interface{}
+}
+
+// recoverBackground recovers a panic raised while a background
+// goroutine, outside of any request, passes spans on to a receiver or
+// forwarder, logging it with the trace ID rather than crashing the
+// process. It must be deferred
+func recoverBackground(component string, traceID string) {
+	p := recover()
+	if p == nil {
+		return
+	}
+	backgroundPanics.WithLabelValues(component).Inc()
+	logrus.WithField("stack", string(debug.Stack())).WithField("component", component).
+		WithField("traceID", traceID).WithField("panic", p).Error("Recovered from panic while passing spans on")
+}
+
+// recoverWrap wraps a handleFunc so that a panic while handling spans,
+// e.g. in a custom SpanReceiver or SpanTransformer, fails only that
+// request with a 500 rather than the whole server
+func (a *App) recoverWrap(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			p := recover()
+			if p == nil {
+				return
+			}
+			if p == http.ErrAbortHandler {
+				panic(p)
+			}
+			handlerPanics.Inc()
+			entry := logrus.WithField("stack", string(debug.Stack()))
+			if sp, ok := p.(spanPanic); ok {
+				entry = entry.WithField("traceID", sp.TraceID)
+				p = sp.Value
+			}
+			entry.WithField("panic", p).Error("Recovered from panic while handling spans")
+			a.writeError(w, r, http.StatusInternalServerError, "internal_error", "internal error handling spans")
+		}()
+		handler(w, r)
+	}
+}
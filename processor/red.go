@@ -0,0 +1,36 @@
+package processor
+
+import (
+	"github.com/willthames/opentracing-processor/span"
+)
+
+// redRecorder is a SpanReceiver that passes spans on to Next, and
+// records request rate, error and duration (RED) metrics for each
+// service, operation and span kind. Services are labelled by Services
+// and operations by Operations, which bounds the distinct service and
+// operation pairs. Spans with an error tag count as errors. The client
+// and server halves of a call are counted separately, by kind
+type redRecorder struct {
+	Next       SpanReceiver
+	Services   *labelLimiter
+	Operations *labelLimiter
+}
+
+func (r *redRecorder) ReceiveSpan(s *span.Span) {
+	service := r.Services.service(s.ServiceName())
+	operation := otherLabel
+	if r.Operations.value(service+"\x00"+s.Name) != otherLabel {
+		operation = s.Name
+	}
+	redSpans.WithLabelValues(service, operation, s.Kind).Inc()
+	for _, ba := range s.BinaryAnnotations {
+		if ba.Key == "error" {
+			redErrors.WithLabelValues(service, operation, s.Kind).Inc()
+			break
+		}
+	}
+	if s.Duration > 0 {
+		redDuration.WithLabelValues(service, operation, s.Kind).Observe(s.Duration.Seconds())
+	}
+	r.Next.ReceiveSpan(s)
+}
@@ -0,0 +1,43 @@
+package processor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/willthames/opentracing-processor/span"
+)
+
+func TestREDRecorder(t *testing.T) {
+	receiver := new(recordingReceiver)
+	r := &redRecorder{Next: receiver, Services: &labelLimiter{Max: 10}, Operations: &labelLimiter{Max: 2}}
+	newSpan := func(name string, err bool) *span.Span {
+		s := &span.Span{Name: name, Kind: span.KindServer, Duration: 50 * time.Millisecond}
+		s.AddTag("component", "red-test")
+		s.BinaryAnnotations[0].Host = &span.Endpoint{ServiceName: "red-test"}
+		if err {
+			s.AddTag("error", "timeout")
+		}
+		return s
+	}
+	r.ReceiveSpan(newSpan("get", false))
+	r.ReceiveSpan(newSpan("get", true))
+	r.ReceiveSpan(newSpan("put", false))
+	r.ReceiveSpan(newSpan("delete", false))
+
+	if len(receiver.spans) != 4 {
+		t.Errorf("expected every span to be passed on, got %d", len(receiver.spans))
+	}
+	if n := metricTotal(redSpans.WithLabelValues("red-test", "get", span.KindServer)); n != 2 {
+		t.Errorf("expected two get spans, got %v", n)
+	}
+	if n := metricTotal(redErrors.WithLabelValues("red-test", "get", span.KindServer)); n != 1 {
+		t.Errorf("expected one get error, got %v", n)
+	}
+	if n := metricTotal(redSpans.WithLabelValues("red-test", otherLabel, span.KindServer)); n != 1 {
+		t.Errorf("expected operations beyond the limit to be counted as other, got %v", n)
+	}
+	if n := metricTotal(redDuration.WithLabelValues("red-test", "put", span.KindServer).(prometheus.Histogram)); n != 0.05 {
+		t.Errorf("expected put's duration to be observed, got %v", n)
+	}
+}
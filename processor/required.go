@@ -0,0 +1,79 @@
+package processor
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/willthames/opentracing-processor/span"
+)
+
+// fieldPresent tells, for each field --require-fields can name, whether
+// a span has it set
+var fieldPresent = map[string]func(*span.Span) bool{
+	"traceId":     func(s *span.Span) bool { return s.TraceID != "" },
+	"id":          func(s *span.Span) bool { return s.ID != "" },
+	"parentId":    func(s *span.Span) bool { return s.ParentID != "" },
+	"name":        func(s *span.Span) bool { return s.Name != "" },
+	"kind":        func(s *span.Span) bool { return s.Kind != "" },
+	"timestamp":   func(s *span.Span) bool { return !s.Timestamp.IsZero() },
+	"duration":    func(s *span.Span) bool { return s.Duration > 0 },
+	"serviceName": func(s *span.Span) bool { return s.ServiceName() != "" },
+}
+
+// requiredFields is a flag.Value for a comma separated list of span
+// fields, from fieldPresent, that spans must have
+type requiredFields []string
+
+func (f *requiredFields) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *requiredFields) Set(value string) error {
+	for _, field := range strings.Split(value, ",") {
+		field = strings.TrimSpace(field)
+		if _, ok := fieldPresent[field]; !ok {
+			var known []string
+			for name := range fieldPresent {
+				known = append(known, name)
+			}
+			sort.Strings(known)
+			return fmt.Errorf("unknown required field %q. Must be one of %s", field, strings.Join(known, ", "))
+		}
+		*f = append(*f, field)
+	}
+	return nil
+}
+
+// checkRequiredFields counts each required field missing from each
+// span. If invalid spans are being rejected, the error for the first
+// span missing a field is returned, otherwise spans missing fields are
+// dropped
+func (a *App) checkRequiredFields(spans []*span.Span) ([]*span.Span, error) {
+	if len(a.requiredFields) == 0 {
+		return spans, nil
+	}
+	var invalid error
+	kept := spans[:0]
+	for _, s := range spans {
+		var missing []string
+		for _, field := range a.requiredFields {
+			if !fieldPresent[field](s) {
+				spansInvalid.WithLabelValues("missing_" + field).Inc()
+				missing = append(missing, field)
+			}
+		}
+		if len(missing) == 0 {
+			kept = append(kept, s)
+			continue
+		}
+		if invalid == nil {
+			invalid = fmt.Errorf("span %s is missing required fields %s", s.ID, strings.Join(missing, ", "))
+		}
+		spansDropped.WithLabelValues("missing_field").Inc()
+	}
+	if a.rejectInvalid && invalid != nil {
+		return nil, invalid
+	}
+	return kept, nil
+}
@@ -0,0 +1,48 @@
+package processor
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequiredFieldsFlag(t *testing.T) {
+	var fields requiredFields
+	if err := fields.Set("name, duration"); err != nil {
+		t.Fatal(err)
+	}
+	if fields.String() != "name,duration" {
+		t.Errorf("unexpected required fields %s", fields.String())
+	}
+	if err := fields.Set("colour"); err == nil {
+		t.Error("expected an unknown field to be refused")
+	}
+}
+
+func TestRequireFields(t *testing.T) {
+	body := []byte(`[{"traceId":"0123456789abcdef","id":"0123456789abcdef","name":"get","duration":1000},` +
+		`{"traceId":"0123456789abcdef","id":"0123456789abcdee","duration":1000}]`)
+	receiver := new(recordingReceiver)
+	app := &App{Receiver: receiver, requiredFields: requiredFields{"name", "duration"}}
+	before := metricTotal(spansInvalid)
+	r := httptest.NewRequest("POST", "/api/v1/spans", bytes.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	app.handleSpans(w, r)
+	if w.Code != http.StatusAccepted || len(receiver.spans) != 1 || receiver.spans[0].Name != "get" {
+		t.Errorf("expected the span missing a name to be dropped, got status %d and %d spans", w.Code, len(receiver.spans))
+	}
+	if missing := metricTotal(spansInvalid) - before; missing != 1 {
+		t.Errorf("expected one missing field to be counted, got %v", missing)
+	}
+
+	app.rejectInvalid = true
+	r = httptest.NewRequest("POST", "/api/v1/spans", bytes.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	app.handleSpans(w, r)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected spans missing fields to be rejected, got %d", w.Code)
+	}
+}
@@ -0,0 +1,159 @@
+package processor
+
+import (
+	"hash/fnv"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/willthames/opentracing-processor/span"
+)
+
+// adaptiveSampler is a SpanTransformer that keeps a fraction of traces
+// chosen to pass on roughly Target spans per second. The rate spans
+// arrive at is measured over each Window, and the fraction kept during
+// the next window is Target over that rate. Whether a trace is first
+// kept depends only on its ID and the current fraction, and the
+// decision is remembered for DecisionTTL, so the spans of a trace are
+// kept or dropped together even if the fraction changes in between.
+// Spans with the debug flag are always kept, as by the TailSampler
+type adaptiveSampler struct {
+	Target float64
+	// Window defaults to 10 seconds
+	Window time.Duration
+	// DecisionTTL is how long to remember each trace's decision,
+	// defaulting to a minute. At most MaxTraces decisions, defaulting
+	// to 10000, are remembered, forgetting the oldest first
+	DecisionTTL time.Duration
+	MaxTraces   int
+	Clock       Clock
+
+	mu          sync.Mutex
+	windowStart time.Time
+	seen        int
+	fraction    float64
+	decisions   map[string]sampleDecision
+	// order holds trace IDs in the order they were decided, which is
+	// also the order their decisions expire in
+	order []string
+}
+
+// sampleDecision is a remembered decision on whether to keep a trace
+type sampleDecision struct {
+	keep    bool
+	expires time.Time
+}
+
+func (s *adaptiveSampler) TransformSpans(spans []*span.Span) []*span.Span {
+	fraction := s.update(len(spans))
+	current := now(s.Clock)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	kept := spans[:0]
+	for _, sp := range spans {
+		if sp.Debug {
+			sampledDebugSpans.Inc()
+			logSamplingDecision(sp.TraceID, true, "debug")
+			kept = append(kept, sp)
+			continue
+		}
+		keep, cached := s.decide(sp.TraceID, fraction, current)
+		if fraction < 1 || !keep {
+			reason := "rate"
+			if cached {
+				reason = "rate_cached"
+			}
+			logSamplingDecision(sp.TraceID, keep, reason)
+		}
+		if !keep {
+			spansDropped.WithLabelValues("sampled").Inc()
+			continue
+		}
+		kept = append(kept, sp)
+	}
+	return kept
+}
+
+// decide returns whether to keep the trace with traceID, and whether
+// that was an earlier decision on it. Decisions that have expired are
+// forgotten first. It must be called with mu held
+func (s *adaptiveSampler) decide(traceID string, fraction float64, current time.Time) (bool, bool) {
+	if s.decisions == nil {
+		s.decisions = make(map[string]sampleDecision)
+	}
+	if s.DecisionTTL == 0 {
+		s.DecisionTTL = time.Minute
+	}
+	if s.MaxTraces == 0 {
+		s.MaxTraces = 10000
+	}
+	for len(s.order) > 0 && !s.decisions[s.order[0]].expires.After(current) {
+		delete(s.decisions, s.order[0])
+		s.order = s.order[1:]
+	}
+	if decision, ok := s.decisions[traceID]; ok {
+		return decision.keep, true
+	}
+	if len(s.order) >= s.MaxTraces {
+		delete(s.decisions, s.order[0])
+		s.order = s.order[1:]
+	}
+	keep := traceHash(traceID) < fraction
+	s.decisions[traceID] = sampleDecision{keep: keep, expires: current.Add(s.DecisionTTL)}
+	s.order = append(s.order, traceID)
+	return keep, false
+}
+
+// logSamplingDecision logs whether a trace was kept and why, for
+// auditing sampling configuration. It only logs at debug level, and
+// costs nothing more than a level check otherwise
+func logSamplingDecision(traceID string, keep bool, reason string) {
+	if !logrus.IsLevelEnabled(logrus.DebugLevel) {
+		return
+	}
+	decision := "drop"
+	if keep {
+		decision = "keep"
+	}
+	logrus.WithField("traceID", traceID).
+		WithField("decision", decision).
+		WithField("reason", reason).
+		Debug("Sampling decision")
+}
+
+// update counts n more spans, starting a new window and recalculating
+// the fraction kept once the current window is over, and returns the
+// fraction to keep
+func (s *adaptiveSampler) update(n int) float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.Window == 0 {
+		s.Window = 10 * time.Second
+	}
+	current := now(s.Clock)
+	if s.windowStart.IsZero() {
+		s.windowStart = current
+		s.fraction = 1
+		sampleFraction.Set(s.fraction)
+	}
+	if elapsed := current.Sub(s.windowStart); elapsed >= s.Window {
+		rate := float64(s.seen) / elapsed.Seconds()
+		s.fraction = 1
+		if rate > s.Target {
+			s.fraction = s.Target / rate
+		}
+		sampleFraction.Set(s.fraction)
+		s.windowStart = current
+		s.seen = 0
+	}
+	s.seen += n
+	return s.fraction
+}
+
+// traceHash maps a trace ID to a number in [0, 1)
+func traceHash(traceID string) float64 {
+	h := fnv.New64a()
+	h.Write([]byte(traceID))
+	return float64(h.Sum64()) / (math.MaxUint64 + 1.0)
+}
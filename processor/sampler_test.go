@@ -0,0 +1,131 @@
+package processor
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/willthames/opentracing-processor/span"
+)
+
+// traceSpans returns spansPerTrace spans for each of the traces
+// numbered from first
+func traceSpans(first, traces, spansPerTrace int) []*span.Span {
+	var spans []*span.Span
+	for i := first; i < first+traces; i++ {
+		for j := 0; j < spansPerTrace; j++ {
+			spans = append(spans, &span.Span{TraceID: fmt.Sprintf("%016x", i), ID: fmt.Sprintf("%016x", j)})
+		}
+	}
+	return spans
+}
+
+func TestAdaptiveSampler(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(1480979203, 0)}
+	s := &adaptiveSampler{Target: 100, Window: 10 * time.Second, Clock: clock}
+
+	// everything is kept until the rate has been measured
+	if kept := s.TransformSpans(traceSpans(5000, 5000, 2)); len(kept) != 10000 {
+		t.Errorf("expected every span to be kept in the first window, got %d", len(kept))
+	}
+	clock.Advance(10 * time.Second)
+
+	// 1000 spans per second were seen, so a tenth of traces are kept
+	kept := s.TransformSpans(traceSpans(0, 5000, 2))
+	if len(kept) < 800 || len(kept) > 1200 {
+		t.Errorf("expected around 1000 spans to be kept, got %d", len(kept))
+	}
+	traces := make(map[string]int)
+	for _, sp := range kept {
+		traces[sp.TraceID]++
+	}
+	for traceID, count := range traces {
+		if count != 2 {
+			t.Errorf("expected both spans of trace %s to be kept together, got %d", traceID, count)
+		}
+	}
+
+	// once a quiet window has been measured everything is kept again
+	clock.Advance(10 * time.Second)
+	s.TransformSpans(traceSpans(10000, 10, 1))
+	clock.Advance(10 * time.Second)
+	if kept := s.TransformSpans(traceSpans(10010, 10, 1)); len(kept) != 10 {
+		t.Errorf("expected every span to be kept below the target, got %d", len(kept))
+	}
+}
+
+func TestAdaptiveSamplerKeepsDebug(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(1480979203, 0)}
+	s := &adaptiveSampler{Target: 0.001, Window: time.Second, Clock: clock}
+	s.TransformSpans(traceSpans(0, 10000, 1))
+	clock.Advance(time.Second)
+
+	spans := traceSpans(10000, 100, 1)
+	spans[42].Debug = true
+	debug := spans[42]
+	before := metricTotal(sampledDebugSpans)
+	kept := s.TransformSpans(spans)
+	if len(kept) != 1 || kept[0] != debug {
+		t.Errorf("expected only the debug span to survive a fraction near 0, got %d spans", len(kept))
+	}
+	if counted := metricTotal(sampledDebugSpans) - before; counted != 1 {
+		t.Errorf("expected the debug span to be counted, got %v", counted)
+	}
+}
+
+func TestAdaptiveSamplerRemembersDecisions(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(1480979203, 0)}
+	s := &adaptiveSampler{Target: 100, Window: 10 * time.Second, DecisionTTL: time.Minute, MaxTraces: 20000, Clock: clock}
+
+	// the first batch of each trace is kept while the rate is unmeasured
+	if kept := s.TransformSpans(traceSpans(0, 5000, 2)); len(kept) != 10000 {
+		t.Fatalf("expected every span to be kept in the first window, got %d", len(kept))
+	}
+	clock.Advance(10 * time.Second)
+
+	// the fraction is now a tenth, but traces already kept stay kept
+	if kept := s.TransformSpans(traceSpans(0, 5000, 1)); len(kept) != 5000 {
+		t.Errorf("expected later spans of kept traces to be kept, got %d", len(kept))
+	}
+
+	// traces first seen at the lower fraction keep that decision once
+	// the fraction rises again
+	first := s.TransformSpans(traceSpans(5000, 100, 1))
+	keptTraces := make(map[string]bool)
+	for _, sp := range first {
+		keptTraces[sp.TraceID] = true
+	}
+	if len(keptTraces) == 100 {
+		t.Fatalf("expected some new traces to be dropped at a fraction of a tenth")
+	}
+	clock.Advance(10 * time.Second)
+	s.TransformSpans(traceSpans(20000, 10, 1))
+	clock.Advance(10 * time.Second)
+	later := s.TransformSpans(traceSpans(5000, 100, 1))
+	if len(later) != len(first) {
+		t.Errorf("expected %d spans of earlier decided traces, got %d", len(first), len(later))
+	}
+	for _, sp := range later {
+		if !keptTraces[sp.TraceID] {
+			t.Errorf("expected trace %s to stay dropped", sp.TraceID)
+		}
+	}
+
+	// decisions are forgotten once they expire
+	clock.Advance(time.Minute)
+	if kept := s.TransformSpans(traceSpans(5000, 100, 1)); len(kept) != 100 {
+		t.Errorf("expected expired decisions to be made afresh below the target, got %d", len(kept))
+	}
+}
+
+func TestAdaptiveSamplerBoundsDecisions(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(1480979203, 0)}
+	s := &adaptiveSampler{Target: 100, MaxTraces: 10, Clock: clock}
+	s.TransformSpans(traceSpans(0, 100, 1))
+	if len(s.decisions) != 10 || len(s.order) != 10 {
+		t.Errorf("expected 10 remembered decisions, got %d and %d", len(s.decisions), len(s.order))
+	}
+	if _, ok := s.decisions[fmt.Sprintf("%016x", 99)]; !ok {
+		t.Errorf("expected the newest decision to be remembered")
+	}
+}
@@ -0,0 +1,161 @@
+package processor
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/sirupsen/logrus"
+)
+
+// statsReporter logs a summary of pipeline activity every Interval,
+// for deployments that don't scrape metrics. The figures are read from
+// the prometheus metrics, so cost nothing between reports
+type statsReporter struct {
+	Interval  time.Duration
+	Forwarder SpanForwarder
+
+	last statsTotals
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// statsTotals are the running totals a report is the difference of
+type statsTotals struct {
+	received  float64
+	forwarded float64
+	dropped   float64
+}
+
+func (r *statsReporter) Start() error {
+	r.last = currentStatsTotals()
+	r.done = make(chan struct{})
+	r.wg.Add(1)
+	go r.run()
+	return nil
+}
+
+func (r *statsReporter) Stop() error {
+	close(r.done)
+	r.wg.Wait()
+	return nil
+}
+
+func (r *statsReporter) run() {
+	defer r.wg.Done()
+	ticker := time.NewTicker(r.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.done:
+			return
+		case <-ticker.C:
+			r.report()
+		}
+	}
+}
+
+// report logs the activity since the last report
+func (r *statsReporter) report() {
+	totals := currentStatsTotals()
+	entry := logrus.WithFields(logrus.Fields{
+		"received":  totals.received - r.last.received,
+		"forwarded": totals.forwarded - r.last.forwarded,
+		"dropped":   totals.dropped - r.last.dropped,
+	})
+	if inspector, ok := r.Forwarder.(queueInspector); ok {
+		entry = entry.WithField("queued", len(inspector.Queued()))
+	}
+	entry.Info("Pipeline stats")
+	r.last = totals
+}
+
+// currentStatsTotals reads the totals. Only spans sent to the
+// collector count as forwarded, not copies sent for analytics
+func currentStatsTotals() statsTotals {
+	return statsTotals{
+		received:  metricTotal(spansReceived),
+		forwarded: labelledMetricTotal(forwardBatchSpans, prometheus.Labels{"forwarder": "collector"}),
+		dropped:   metricTotal(spansDropped),
+	}
+}
+
+// metricTotal sums a counter or histogram collector across all of its
+// labels. For histograms, the sum of observations is used
+func metricTotal(c prometheus.Collector) float64 {
+	return labelledMetricTotal(c, nil)
+}
+
+// labelledMetricTotal sums a counter or histogram collector as
+// metricTotal does, but only where it has every one of labels
+func labelledMetricTotal(c prometheus.Collector, labels prometheus.Labels) float64 {
+	metrics := make(chan prometheus.Metric)
+	go func() {
+		c.Collect(metrics)
+		close(metrics)
+	}()
+	var total float64
+	for metric := range metrics {
+		var m dto.Metric
+		if err := metric.Write(&m); err != nil || !hasLabels(&m, labels) {
+			continue
+		}
+		if m.Counter != nil {
+			total += m.Counter.GetValue()
+		}
+		if m.Histogram != nil {
+			total += m.Histogram.GetSampleSum()
+		}
+	}
+	return total
+}
+
+// hasLabels reports whether m has every one of labels
+func hasLabels(m *dto.Metric, labels prometheus.Labels) bool {
+	matched := 0
+	for _, pair := range m.GetLabel() {
+		if value, ok := labels[pair.GetName()]; ok && value == pair.GetValue() {
+			matched++
+		}
+	}
+	return matched == len(labels)
+}
+
+// intervalCollector reports gauges of the spans received, forwarded
+// and dropped since the previous scrape, for tools without rate().
+// Each scrape resets the gauges, so they only make sense with a single
+// scraper
+type intervalCollector struct {
+	mu   sync.Mutex
+	last statsTotals
+}
+
+var (
+	receivedIntervalDesc  = prometheus.NewDesc("spans_received_interval", "Number of spans received since the last scrape", nil, nil)
+	forwardedIntervalDesc = prometheus.NewDesc("spans_forwarded_interval", "Number of spans sent to the forwarder since the last scrape", nil, nil)
+	droppedIntervalDesc   = prometheus.NewDesc("spans_dropped_interval", "Number of spans dropped since the last scrape", nil, nil)
+)
+
+func newIntervalCollector() *intervalCollector {
+	return &intervalCollector{last: currentStatsTotals()}
+}
+
+func (c *intervalCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- receivedIntervalDesc
+	ch <- forwardedIntervalDesc
+	ch <- droppedIntervalDesc
+}
+
+// Collect reports the change in each total since the last call and
+// resets it, under a lock so overlapping scrapes don't double count
+func (c *intervalCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	totals := currentStatsTotals()
+	last := c.last
+	c.last = totals
+	c.mu.Unlock()
+	ch <- prometheus.MustNewConstMetric(receivedIntervalDesc, prometheus.GaugeValue, totals.received-last.received)
+	ch <- prometheus.MustNewConstMetric(forwardedIntervalDesc, prometheus.GaugeValue, totals.forwarded-last.forwarded)
+	ch <- prometheus.MustNewConstMetric(droppedIntervalDesc, prometheus.GaugeValue, totals.dropped-last.dropped)
+}
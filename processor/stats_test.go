@@ -0,0 +1,56 @@
+package processor
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestMetricTotal(t *testing.T) {
+	before := metricTotal(spansDropped)
+	spansDropped.WithLabelValues("stats_a").Add(2)
+	spansDropped.WithLabelValues("stats_b").Inc()
+	if total := metricTotal(spansDropped) - before; total != 3 {
+		t.Errorf("expected drops to be summed across reasons, got %v", total)
+	}
+
+	before = metricTotal(forwardBatchSpans)
+	forwardBatchSpans.WithLabelValues("collector", "send").Observe(5)
+	if total := metricTotal(forwardBatchSpans) - before; total != 5 {
+		t.Errorf("expected forwarded spans to be the sum of batch sizes, got %v", total)
+	}
+}
+
+func TestStatsCountCollectorOnly(t *testing.T) {
+	before := currentStatsTotals()
+	forwardBatchSpans.WithLabelValues("collector", "stats").Observe(3)
+	forwardBatchSpans.WithLabelValues("analytics", "stats").Observe(3)
+	if forwarded := currentStatsTotals().forwarded - before.forwarded; forwarded != 3 {
+		t.Errorf("expected only spans sent to the collector to be counted as forwarded, got %v", forwarded)
+	}
+}
+
+func TestIntervalCollector(t *testing.T) {
+	c := newIntervalCollector()
+	spansDropped.WithLabelValues("interval").Add(4)
+	collect := func() float64 {
+		metrics := make(chan prometheus.Metric, 3)
+		c.Collect(metrics)
+		close(metrics)
+		for metric := range metrics {
+			if metric.Desc() == droppedIntervalDesc {
+				var m dto.Metric
+				metric.Write(&m)
+				return m.GetGauge().GetValue()
+			}
+		}
+		return -1
+	}
+	if dropped := collect(); dropped != 4 {
+		t.Errorf("expected 4 spans dropped in the interval, got %v", dropped)
+	}
+	if dropped := collect(); dropped != 0 {
+		t.Errorf("expected the interval to be reset by the scrape, got %v", dropped)
+	}
+}
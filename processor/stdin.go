@@ -0,0 +1,57 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// stdinFormats maps --stdin-format values to the content type the
+// payload is decoded as
+var stdinFormats = map[string]string{
+	"json":   "application/json",
+	"ndjson": "application/x-ndjson",
+	"thrift": "application/x-thrift",
+}
+
+// ingestReader reads a single span payload in format from r and
+// processes it as handleSpans would a request posted to /api/v1/spans
+func (a *App) ingestReader(r io.Reader, format string) error {
+	contentType, ok := stdinFormats[format]
+	if !ok {
+		var formats []string
+		for name := range stdinFormats {
+			formats = append(formats, name)
+		}
+		sort.Strings(formats)
+		return fmt.Errorf("invalid stdin-format %s. Must be one of %s", format, strings.Join(formats, ", "))
+	}
+	if a.Receiver == nil {
+		return errors.New("no span receiver is configured")
+	}
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("error reading spans: %v", err)
+	}
+	spans, contentType, decodeErr := a.decodeSpans("/api/v1/spans", contentType, data)
+	if decodeErr != nil {
+		return errors.New(decodeErr.message)
+	}
+	if err := a.checkIDs(spans); err != nil {
+		return err
+	}
+	if spans, err = a.checkRequiredFields(spans); err != nil {
+		return err
+	}
+	ingestBytes.WithLabelValues(contentType).Add(float64(len(data)))
+	spansReceived.WithLabelValues(contentType).Add(float64(len(spans)))
+	spans = a.transform(spans)
+	logrus.WithField("spans", len(spans)).Debug("Processing spans from stdin")
+	return a.receiveSpans(context.Background(), a.Receiver, spans)
+}
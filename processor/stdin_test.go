@@ -0,0 +1,26 @@
+package processor
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestIngestReader(t *testing.T) {
+	receiver := &recordingReceiver{}
+	app := &App{Receiver: receiver, Transformers: []SpanTransformer{&orphanFilter{}}}
+	payload := `{"traceId":"0000000000000001","id":"0000000000000001"}` + "\n" +
+		`{"traceId":"0000000000000001","id":"0000000000000002","parentId":"0000000000000009"}`
+	if err := app.ingestReader(strings.NewReader(payload), "ndjson"); err != nil {
+		t.Fatal(err)
+	}
+	if len(receiver.spans) != 1 || receiver.spans[0].ID != "0000000000000001" {
+		t.Errorf("expected the transformed span to be received, got %v", receiver.spans)
+	}
+
+	if err := app.ingestReader(strings.NewReader(payload), "yaml"); err == nil {
+		t.Error("expected an unknown format to fail")
+	}
+	if err := app.ingestReader(strings.NewReader("not json"), "json"); err == nil {
+		t.Error("expected undecodable spans to fail")
+	}
+}
@@ -0,0 +1,94 @@
+package processor
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+	"github.com/willthames/opentracing-processor/span"
+)
+
+// spanStream fans received spans out to /debug/stream subscribers.
+// Spans are sent as JSON, encoded as they are published, so that
+// subscribers never read spans that later receivers may change
+type spanStream struct {
+	mu          sync.Mutex
+	subscribers map[chan []byte]string
+}
+
+// subscribe returns a channel receiving the JSON of spans from
+// service, or all spans if service is empty
+func (ss *spanStream) subscribe(service string) chan []byte {
+	ch := make(chan []byte, 100)
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	if ss.subscribers == nil {
+		ss.subscribers = make(map[chan []byte]string)
+	}
+	ss.subscribers[ch] = service
+	return ch
+}
+
+func (ss *spanStream) unsubscribe(ch chan []byte) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	delete(ss.subscribers, ch)
+}
+
+// publish sends s to every interested subscriber. Slow subscribers
+// miss spans rather than holding up ingest
+func (ss *spanStream) publish(s *span.Span) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	if len(ss.subscribers) == 0 {
+		return
+	}
+	service := s.ServiceName()
+	var data []byte
+	for ch, filter := range ss.subscribers {
+		if filter != "" && filter != service {
+			continue
+		}
+		if data == nil {
+			var err error
+			if data, err = json.Marshal(s); err != nil {
+				logrus.WithError(err).Debug("Error encoding span for stream")
+				return
+			}
+		}
+		select {
+		case ch <- data:
+		default:
+		}
+	}
+}
+
+// handle serves the /debug/stream endpoint, pushing each received
+// span as a server-sent event until the client disconnects. The
+// service query parameter limits events to spans from that service
+func (ss *spanStream) handle(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte("streaming not supported"))
+		return
+	}
+	ch := ss.subscribe(r.URL.Query().Get("service"))
+	defer ss.unsubscribe(ch)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case data := <-ch:
+			fmt.Fprintf(w, "data: %s\n\n", data)
+			flusher.Flush()
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package processor
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/willthames/opentracing-processor/span"
+)
+
+func TestSpanStreamFilter(t *testing.T) {
+	var ss spanStream
+	all := ss.subscribe("")
+	frontend := ss.subscribe("frontend")
+
+	s := &span.Span{TraceID: "1", ID: "1"}
+	s.BinaryAnnotations = []span.BinaryAnnotation{{Key: "lc", Value: "", Host: &span.Endpoint{ServiceName: "backend"}}}
+	ss.publish(s)
+
+	if len(all) != 1 {
+		t.Fatalf("unfiltered subscriber should receive every span")
+	}
+	// later changes to the span mustn't reach subscribers
+	s.TraceID = "2"
+	var published span.Span
+	if err := json.Unmarshal(<-all, &published); err != nil || published.TraceID != "1" {
+		t.Errorf("expected the span as it was published, got %v %v", published, err)
+	}
+	if len(frontend) != 0 {
+		t.Errorf("filtered subscriber should not receive spans from other services")
+	}
+
+	ss.unsubscribe(all)
+	ss.unsubscribe(frontend)
+	if len(ss.subscribers) != 0 {
+		t.Errorf("subscriptions should be cleaned up")
+	}
+}
@@ -0,0 +1,45 @@
+package processor
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/willthames/opentracing-processor/span"
+)
+
+// TagMatch matches spans with a tag whose value, formatted as text,
+// is Value
+type TagMatch struct {
+	Key   string
+	Value string
+}
+
+// Matches returns whether s has a tag matching m
+func (m TagMatch) Matches(s *span.Span) bool {
+	for _, ba := range s.BinaryAnnotations {
+		if ba.Key == m.Key && fmt.Sprint(ba.Value) == m.Value {
+			return true
+		}
+	}
+	return false
+}
+
+// tagMatches is a flag.Value for a repeatable key=value flag
+type tagMatches []TagMatch
+
+func (t *tagMatches) String() string {
+	var matches []string
+	for _, m := range *t {
+		matches = append(matches, m.Key+"="+m.Value)
+	}
+	return strings.Join(matches, ",")
+}
+
+func (t *tagMatches) Set(value string) error {
+	parts := strings.SplitN(value, "=", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return fmt.Errorf("invalid tag match %q. Must be key=value", value)
+	}
+	*t = append(*t, TagMatch{Key: parts[0], Value: parts[1]})
+	return nil
+}
@@ -0,0 +1,168 @@
+package processor
+
+import (
+	"sync"
+	"time"
+
+	"github.com/willthames/opentracing-processor/span"
+)
+
+// TailSampler is a SpanReceiver that holds spans by trace ID for a
+// decision window before passing them on to Next. Only traces that
+// contain an error, a debug span, a span matching KeepIf or a span
+// at least as slow as LatencyThreshold are passed on, the rest are
+// dropped.
+type TailSampler struct {
+	Next             SpanReceiver
+	Window           time.Duration
+	LatencyThreshold time.Duration
+	MaxTraces        int
+	KeepIf           []TagMatch
+	// Clock decides when each trace's window started. Defaults to the
+	// real clock
+	Clock Clock
+
+	mu     sync.Mutex
+	traces map[string]*bufferedTrace
+	order  []*bufferedTrace
+	done   chan struct{}
+	wg     sync.WaitGroup
+}
+
+// bufferedTrace is a trace awaiting a sampling decision
+type bufferedTrace struct {
+	id       string
+	deadline time.Time
+	spans    []*span.Span
+	// reason is why the trace is being kept, empty if it isn't
+	reason string
+}
+
+// Start begins periodically deciding on traces whose window has expired
+func (ts *TailSampler) Start() error {
+	if ts.Window == 0 {
+		ts.Window = 10 * time.Second
+	}
+	if ts.MaxTraces == 0 {
+		ts.MaxTraces = 10000
+	}
+	ts.done = make(chan struct{})
+	ts.wg.Add(1)
+	go ts.run()
+	return nil
+}
+
+// Stop makes a decision on every buffered trace, regardless of
+// whether its window has expired
+func (ts *TailSampler) Stop() error {
+	if ts.done != nil {
+		close(ts.done)
+		ts.wg.Wait()
+	}
+	ts.release(ts.expire(time.Time{}))
+	return nil
+}
+
+func (ts *TailSampler) run() {
+	defer ts.wg.Done()
+	ticker := time.NewTicker(expiryTick(ts.Window))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ts.done:
+			return
+		case <-ticker.C:
+			ts.release(ts.expire(now(ts.Clock)))
+		}
+	}
+}
+
+// ReceiveSpan adds a span to its trace's buffer
+func (ts *TailSampler) ReceiveSpan(s *span.Span) {
+	var evicted []*bufferedTrace
+	ts.mu.Lock()
+	if ts.traces == nil {
+		ts.traces = make(map[string]*bufferedTrace)
+	}
+	trace, ok := ts.traces[s.TraceID]
+	if !ok {
+		if ts.MaxTraces > 0 && len(ts.order) >= ts.MaxTraces {
+			evicted = ts.order[:1]
+			ts.order = ts.order[1:]
+			delete(ts.traces, evicted[0].id)
+		}
+		trace = &bufferedTrace{id: s.TraceID, deadline: now(ts.Clock).Add(ts.Window)}
+		ts.traces[s.TraceID] = trace
+		ts.order = append(ts.order, trace)
+	}
+	trace.spans = append(trace.spans, s)
+	if trace.reason == "" {
+		trace.reason = ts.interesting(s)
+	}
+	ts.mu.Unlock()
+	ts.release(evicted)
+}
+
+// interesting returns why a span alone is enough to keep its trace,
+// or empty if it isn't
+func (ts *TailSampler) interesting(s *span.Span) string {
+	if s.Debug {
+		return "debug"
+	}
+	for _, m := range ts.KeepIf {
+		if m.Matches(s) {
+			return "keep_if"
+		}
+	}
+	if ts.LatencyThreshold > 0 && s.Duration >= ts.LatencyThreshold {
+		return "latency"
+	}
+	for _, ba := range s.BinaryAnnotations {
+		if ba.Key == "error" {
+			return "error"
+		}
+	}
+	return ""
+}
+
+// expire removes and returns all traces whose deadline is before now.
+// A zero now expires every trace
+func (ts *TailSampler) expire(now time.Time) []*bufferedTrace {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	// traces all share the same window, so order is also deadline order
+	i := 0
+	for ; i < len(ts.order); i++ {
+		if !now.IsZero() && ts.order[i].deadline.After(now) {
+			break
+		}
+		delete(ts.traces, ts.order[i].id)
+	}
+	expired := ts.order[:i]
+	ts.order = ts.order[i:]
+	return expired
+}
+
+// release passes kept traces on to Next and drops the rest
+func (ts *TailSampler) release(traces []*bufferedTrace) {
+	for _, trace := range traces {
+		ts.releaseTrace(trace)
+	}
+}
+
+// releaseTrace passes trace on to Next if it is being kept. Traces are
+// mostly released from the expiry goroutine, so a panic in Next is
+// recovered rather than crashing the process
+func (ts *TailSampler) releaseTrace(trace *bufferedTrace) {
+	defer recoverBackground("tail_sampler", trace.id)
+	if trace.reason == "" {
+		tailSampledTraces.WithLabelValues("dropped").Inc()
+		logSamplingDecision(trace.id, false, "uninteresting")
+		return
+	}
+	tailSampledTraces.WithLabelValues("kept").Inc()
+	logSamplingDecision(trace.id, true, trace.reason)
+	for _, s := range trace.spans {
+		ts.Next.ReceiveSpan(s)
+	}
+}
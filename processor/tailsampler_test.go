@@ -0,0 +1,149 @@
+package processor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/willthames/opentracing-processor/span"
+)
+
+func TestTailSampler(t *testing.T) {
+	receiver := new(recordingReceiver)
+	sampler := &TailSampler{Next: receiver, Window: time.Minute, LatencyThreshold: time.Second}
+
+	errored := &span.Span{TraceID: "errored", ID: "1"}
+	errored.AddTag("error", "true")
+	sampler.ReceiveSpan(&span.Span{TraceID: "errored", ID: "2"})
+	sampler.ReceiveSpan(errored)
+	sampler.ReceiveSpan(&span.Span{TraceID: "slow", ID: "3", Duration: 2 * time.Second})
+	sampler.ReceiveSpan(&span.Span{TraceID: "boring", ID: "4", Duration: time.Millisecond})
+	sampler.ReceiveSpan(&span.Span{TraceID: "debug", ID: "5", Duration: time.Millisecond, Debug: true})
+
+	sampler.release(sampler.expire(time.Now()))
+	if len(receiver.spans) != 0 {
+		t.Errorf("expected no spans before the window expires, got %d", len(receiver.spans))
+	}
+	sampler.release(sampler.expire(time.Now().Add(2 * time.Minute)))
+	if len(receiver.spans) != 4 {
+		t.Fatalf("expected four spans from errored, slow and debug traces, got %d", len(receiver.spans))
+	}
+	for _, s := range receiver.spans {
+		if s.TraceID == "boring" {
+			t.Errorf("boring trace should have been dropped")
+		}
+	}
+}
+
+func TestTailSamplerMaxTraces(t *testing.T) {
+	receiver := new(recordingReceiver)
+	sampler := &TailSampler{Next: receiver, Window: time.Minute, LatencyThreshold: time.Second, MaxTraces: 1}
+	sampler.ReceiveSpan(&span.Span{TraceID: "first", Duration: 2 * time.Second})
+	sampler.ReceiveSpan(&span.Span{TraceID: "second"})
+	if len(receiver.spans) != 1 || receiver.spans[0].TraceID != "first" {
+		t.Errorf("expected first trace to be decided early when buffer is full, got %v", receiver.spans)
+	}
+}
+
+func TestTailSamplerKeepIf(t *testing.T) {
+	receiver := new(recordingReceiver)
+	var keepIf tagMatches
+	if err := keepIf.Set("priority=high"); err != nil {
+		t.Fatal(err)
+	}
+	if err := keepIf.Set("priority"); err == nil {
+		t.Errorf("expected an error for a keep-if without a value")
+	}
+	sampler := &TailSampler{Next: receiver, Window: time.Minute, KeepIf: keepIf}
+	important := &span.Span{TraceID: "important", ID: "1"}
+	important.AddTag("priority", "high")
+	low := &span.Span{TraceID: "low", ID: "2"}
+	low.AddTag("priority", "low")
+	sampler.ReceiveSpan(&span.Span{TraceID: "important", ID: "3"})
+	sampler.ReceiveSpan(important)
+	sampler.ReceiveSpan(low)
+	sampler.release(sampler.expire(time.Time{}))
+	if len(receiver.spans) != 2 {
+		t.Errorf("expected the whole important trace and nothing else to be kept, got %v", receiver.spans)
+	}
+}
+
+func TestSamplingDecisionLogging(t *testing.T) {
+	hook := test.NewGlobal()
+	defer hook.Reset()
+	level := logrus.GetLevel()
+	defer logrus.SetLevel(level)
+
+	sampler := &TailSampler{Next: new(recordingReceiver), Window: time.Minute, LatencyThreshold: time.Second}
+	sampler.ReceiveSpan(&span.Span{TraceID: "slow", Duration: 2 * time.Second})
+	sampler.ReceiveSpan(&span.Span{TraceID: "boring"})
+
+	logrus.SetLevel(logrus.InfoLevel)
+	sampler.release(sampler.expire(time.Time{}))
+	if len(hook.AllEntries()) != 0 {
+		t.Errorf("expected no decisions to be logged at info, got %d", len(hook.AllEntries()))
+	}
+
+	logrus.SetLevel(logrus.DebugLevel)
+	sampler.ReceiveSpan(&span.Span{TraceID: "slow", Duration: 2 * time.Second})
+	sampler.ReceiveSpan(&span.Span{TraceID: "boring"})
+	sampler.release(sampler.expire(time.Time{}))
+	entries := hook.AllEntries()
+	if len(entries) != 2 {
+		t.Fatalf("expected a decision to be logged for each trace, got %d", len(entries))
+	}
+	if entries[0].Data["decision"] != "keep" || entries[0].Data["reason"] != "latency" {
+		t.Errorf("expected the slow trace to be kept for latency, got %v", entries[0].Data)
+	}
+	if entries[1].Data["decision"] != "drop" || entries[1].Data["traceID"] != "boring" {
+		t.Errorf("expected the boring trace to be dropped, got %v", entries[1].Data)
+	}
+}
+
+func TestTailSamplerClock(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(1000, 0)}
+	sampler := &TailSampler{Next: new(recordingReceiver), Window: 10 * time.Millisecond, Clock: clock}
+	buffered := func() int {
+		sampler.mu.Lock()
+		defer sampler.mu.Unlock()
+		return len(sampler.traces)
+	}
+	sampler.Start()
+	defer sampler.Stop()
+	sampler.ReceiveSpan(&span.Span{TraceID: "trace", ID: "1"})
+	time.Sleep(50 * time.Millisecond)
+	if buffered() != 1 {
+		t.Fatal("expected the trace to wait for the clock to pass its window")
+	}
+	clock.Advance(time.Minute)
+	for deadline := time.Now().Add(5 * time.Second); buffered() != 0; {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the trace to expire once the clock passed its window")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestTailSamplerRecoversPanic(t *testing.T) {
+	sampler := &TailSampler{Next: panickingReceiver{}, Window: time.Minute}
+	sampler.ReceiveSpan(&span.Span{TraceID: "debug", ID: "1", Debug: true})
+	sampler.ReceiveSpan(&span.Span{TraceID: "other", ID: "2", Debug: true})
+	before := metricTotal(backgroundPanics)
+	sampler.release(sampler.expire(time.Time{}))
+	if panics := metricTotal(backgroundPanics) - before; panics != 2 {
+		t.Errorf("expected a recovered panic for each kept trace, got %v", panics)
+	}
+}
+
+func TestTailSamplerShortWindow(t *testing.T) {
+	receiver := new(recordingReceiver)
+	sampler := &TailSampler{Next: receiver, Window: time.Nanosecond}
+	sampler.Start()
+	sampler.ReceiveSpan(&span.Span{TraceID: "debug", ID: "1", Debug: true})
+	time.Sleep(10 * time.Millisecond)
+	sampler.Stop()
+	if len(receiver.spans) != 1 {
+		t.Errorf("expected the debug trace to be kept, got %d spans", len(receiver.spans))
+	}
+}
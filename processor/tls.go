@@ -0,0 +1,40 @@
+package processor
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+)
+
+// forwardTLSConfig builds the TLS configuration for connecting to the
+// collector from command line flags. It returns nil if no TLS options
+// are set, so the default configuration is used
+func (a *App) forwardTLSConfig() (*tls.Config, error) {
+	if a.forwardClientCert == "" && a.forwardClientKey == "" && a.forwardCACert == "" {
+		return nil, nil
+	}
+	config := &tls.Config{}
+	if a.forwardClientCert != "" || a.forwardClientKey != "" {
+		if a.forwardClientCert == "" || a.forwardClientKey == "" {
+			return nil, errors.New("forward-client-cert and forward-client-key must be set together")
+		}
+		cert, err := tls.LoadX509KeyPair(a.forwardClientCert, a.forwardClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("error loading forward client certificate: %v", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	if a.forwardCACert != "" {
+		pem, err := ioutil.ReadFile(a.forwardCACert)
+		if err != nil {
+			return nil, fmt.Errorf("error reading forward CA certificate: %v", err)
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", a.forwardCACert)
+		}
+	}
+	return config, nil
+}
@@ -0,0 +1,65 @@
+package processor
+
+import (
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestForwardTLSConfig(t *testing.T) {
+	a := &App{}
+	if config, err := a.forwardTLSConfig(); config != nil || err != nil {
+		t.Errorf("expected no TLS config by default, got %v, %v", config, err)
+	}
+	a.forwardClientCert = "client.pem"
+	if _, err := a.forwardTLSConfig(); err == nil {
+		t.Errorf("expected an error for a client cert without a key")
+	}
+	a.forwardClientKey = "missing.key"
+	if _, err := a.forwardTLSConfig(); err == nil {
+		t.Errorf("expected an error for missing client cert files")
+	}
+}
+
+func TestForwardCACert(t *testing.T) {
+	received := make(chan struct{}, 1)
+	collector := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- struct{}{}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer collector.Close()
+
+	dir, err := ioutil.TempDir("", "forward-tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	caFile := filepath.Join(dir, "ca.pem")
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: collector.Certificate().Raw})
+	if err := ioutil.WriteFile(caFile, ca, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	a := &App{forwardCACert: caFile}
+	config, err := a.forwardTLSConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := NewForwarder(collector.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.TLSConfig = config
+	f.Start()
+	f.Send(Payload{ContentType: "application/json", Body: []byte("[]")})
+	f.Stop()
+	select {
+	case <-received:
+	default:
+		t.Errorf("expected the collector's certificate to be trusted")
+	}
+}
@@ -0,0 +1,172 @@
+package processor
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/willthames/opentracing-processor/span"
+)
+
+// traceContext identifies a span from B3 or W3C trace context request
+// headers
+type traceContext struct {
+	TraceID  string
+	ID       string
+	ParentID string
+	Debug    bool
+}
+
+// parseTraceContext reads the trace context from the single b3 header,
+// the X-B3-* headers or the W3C traceparent header, in that order of
+// preference. ok is false if there is no context. A traceparent's
+// parent-id is the ID of the span its sender made the request from,
+// so it becomes the ID of the span, which is left without a parent
+func parseTraceContext(h http.Header) (c traceContext, ok bool, err error) {
+	if b3 := h.Get("b3"); b3 != "" {
+		c, ok, err = parseB3(b3)
+		if ok || err != nil {
+			return c, ok, err
+		}
+	}
+	if h.Get("X-B3-TraceId") != "" || h.Get("X-B3-SpanId") != "" {
+		c, err = parseB3Headers(h)
+		return c, err == nil, err
+	}
+	if traceparent := h.Get("traceparent"); traceparent != "" {
+		c, err = parseTraceparent(traceparent)
+		return c, err == nil, err
+	}
+	return c, false, nil
+}
+
+// parseB3 parses a single b3 header of the form
+// {TraceId}-{SpanId}-{SamplingState}-{ParentSpanId}, where the last
+// two fields are optional. A header with only a sampling state has no
+// IDs, so ok is false
+func parseB3(value string) (c traceContext, ok bool, err error) {
+	fields := strings.Split(value, "-")
+	if len(fields) == 1 {
+		if !validSamplingState(value) {
+			return c, false, fmt.Errorf("invalid b3 sampling state %q", value)
+		}
+		return c, false, nil
+	}
+	if len(fields) > 4 {
+		return c, false, fmt.Errorf("invalid b3 header %q", value)
+	}
+	c.TraceID, c.ID = fields[0], fields[1]
+	if len(fields) > 2 {
+		if !validSamplingState(fields[2]) {
+			return c, false, fmt.Errorf("invalid b3 sampling state %q", fields[2])
+		}
+		c.Debug = fields[2] == "d"
+	}
+	if len(fields) > 3 {
+		c.ParentID = fields[3]
+	}
+	return c, true, c.validate()
+}
+
+// parseB3Headers parses the X-B3-* headers
+func parseB3Headers(h http.Header) (traceContext, error) {
+	c := traceContext{
+		TraceID:  h.Get("X-B3-TraceId"),
+		ID:       h.Get("X-B3-SpanId"),
+		ParentID: h.Get("X-B3-ParentSpanId"),
+		Debug:    h.Get("X-B3-Flags") == "1",
+	}
+	return c, c.validate()
+}
+
+// parseTraceparent parses a W3C traceparent header of the form
+// {version}-{trace-id}-{parent-id}-{trace-flags}. Versions after 00
+// may append further fields, which are ignored
+func parseTraceparent(value string) (traceContext, error) {
+	var c traceContext
+	fields := strings.Split(value, "-")
+	if len(fields) < 4 || len(fields[0]) != 2 || !isLowerHex(fields[0]) || fields[0] == "ff" {
+		return c, fmt.Errorf("invalid traceparent %q", value)
+	}
+	if fields[0] == "00" && len(fields) != 4 {
+		return c, fmt.Errorf("invalid traceparent %q", value)
+	}
+	traceID, parentID, flags := fields[1], fields[2], fields[3]
+	if len(traceID) != 32 || !isLowerHex(traceID) || strings.Trim(traceID, "0") == "" {
+		return c, fmt.Errorf("invalid traceparent trace-id %q", traceID)
+	}
+	if len(parentID) != 16 || !isLowerHex(parentID) || strings.Trim(parentID, "0") == "" {
+		return c, fmt.Errorf("invalid traceparent parent-id %q", parentID)
+	}
+	if len(flags) != 2 || !isLowerHex(flags) {
+		return c, fmt.Errorf("invalid traceparent trace-flags %q", flags)
+	}
+	c.TraceID, c.ID = traceID, parentID
+	return c, nil
+}
+
+// validate checks B3 IDs, which must be lower case hex
+func (c traceContext) validate() error {
+	if (len(c.TraceID) != 16 && len(c.TraceID) != 32) || !isLowerHex(c.TraceID) {
+		return fmt.Errorf("invalid b3 trace ID %q", c.TraceID)
+	}
+	if len(c.ID) != 16 || !isLowerHex(c.ID) {
+		return fmt.Errorf("invalid b3 span ID %q", c.ID)
+	}
+	if c.ParentID != "" && (len(c.ParentID) != 16 || !isLowerHex(c.ParentID)) {
+		return fmt.Errorf("invalid b3 parent span ID %q", c.ParentID)
+	}
+	return nil
+}
+
+func validSamplingState(state string) bool {
+	return state == "0" || state == "1" || state == "d"
+}
+
+func isLowerHex(s string) bool {
+	for _, c := range s {
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f') {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// apply gives spans without a trace ID the context's trace ID, and
+// marks them debug if the context is. A lone span without its own ID
+// is the span the context describes, so takes its ID and parent too.
+// Otherwise the spans keep their IDs and any without a parent become
+// children of the context's span. Spans with their own trace ID are
+// left alone
+func (c traceContext) apply(spans []*span.Span) {
+	for _, s := range spans {
+		if s.TraceID != "" {
+			continue
+		}
+		s.TraceID = c.TraceID
+		if len(spans) == 1 && (s.ID == "" || s.ID == c.ID) {
+			s.ID, s.ParentID = c.ID, c.ParentID
+		} else if s.ParentID == "" && s.ID != c.ID {
+			s.ParentID = c.ID
+		}
+		s.Debug = s.Debug || c.Debug
+	}
+}
+
+// applyTraceContext fills in spans from the request's trace context
+// headers, if it has any
+func applyTraceContext(h http.Header, spans []*span.Span) error {
+	c, ok, err := parseTraceContext(h)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return nil
+	}
+	if len(spans) == 0 {
+		return errors.New("trace context headers need a span body to apply to")
+	}
+	c.apply(spans)
+	return nil
+}
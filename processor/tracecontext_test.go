@@ -0,0 +1,90 @@
+package processor
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/willthames/opentracing-processor/span"
+)
+
+func TestParseTraceContext(t *testing.T) {
+	for _, test := range []struct {
+		headers  map[string]string
+		expected traceContext
+		ok       bool
+		invalid  bool
+	}{
+		{map[string]string{"b3": "80f198ee56343ba864fe8b2a57d3eff7-e457b5a2e4d86bd1-d-05e3ac9a4f6e3b90"},
+			traceContext{"80f198ee56343ba864fe8b2a57d3eff7", "e457b5a2e4d86bd1", "05e3ac9a4f6e3b90", true}, true, false},
+		{map[string]string{"b3": "a3ce929d0e0e4736-f67b1f1d4e8a2c3b"},
+			traceContext{TraceID: "a3ce929d0e0e4736", ID: "f67b1f1d4e8a2c3b"}, true, false},
+		{map[string]string{"b3": "0"}, traceContext{}, false, false},
+		{map[string]string{"b3": "A3CE929D0E0E4736-f67b1f1d4e8a2c3b"}, traceContext{}, false, true},
+		{map[string]string{"X-B3-TraceId": "a3ce929d0e0e4736", "X-B3-SpanId": "f67b1f1d4e8a2c3b", "X-B3-ParentSpanId": "05e3ac9a4f6e3b90", "X-B3-Flags": "1"},
+			traceContext{"a3ce929d0e0e4736", "f67b1f1d4e8a2c3b", "05e3ac9a4f6e3b90", true}, true, false},
+		{map[string]string{"traceparent": "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"},
+			traceContext{TraceID: "0af7651916cd43dd8448eb211c80319c", ID: "b7ad6b7169203331"}, true, false},
+		{map[string]string{"traceparent": "01-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01-future"},
+			traceContext{TraceID: "0af7651916cd43dd8448eb211c80319c", ID: "b7ad6b7169203331"}, true, false},
+		{map[string]string{"traceparent": "00-00000000000000000000000000000000-b7ad6b7169203331-01"}, traceContext{}, false, true},
+		{map[string]string{"traceparent": "ff-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"}, traceContext{}, false, true},
+		{map[string]string{}, traceContext{}, false, false},
+	} {
+		h := http.Header{}
+		for key, value := range test.headers {
+			h.Set(key, value)
+		}
+		c, ok, err := parseTraceContext(h)
+		if (err != nil) != test.invalid {
+			t.Errorf("unexpected error %v for %v", err, test.headers)
+			continue
+		}
+		if !test.invalid && (ok != test.ok || c != test.expected) {
+			t.Errorf("expected %+v (%v) for %v, got %+v (%v)", test.expected, test.ok, test.headers, c, ok)
+		}
+	}
+}
+
+func TestTraceContextHeaders(t *testing.T) {
+	receiver := &recordingReceiver{}
+	app := &App{Receiver: receiver, traceContextHeaders: true}
+	r := httptest.NewRequest("POST", "/api/v1/spans", strings.NewReader(`{"name":"get","timestamp":1480979203000000,"duration":1000}`))
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("b3", "a3ce929d0e0e4736-f67b1f1d4e8a2c3b-1")
+	w := httptest.NewRecorder()
+	app.handleSpans(w, r)
+	if w.Code != http.StatusAccepted || len(receiver.spans) != 1 {
+		t.Fatalf("expected the span to be accepted, got %d: %s", w.Code, w.Body)
+	}
+	if s := receiver.spans[0]; s.TraceID != "a3ce929d0e0e4736" || s.ID != "f67b1f1d4e8a2c3b" || s.Name != "get" {
+		t.Errorf("expected the span to take its IDs from the b3 header, got %+v", s)
+	}
+}
+
+func TestTraceContextMultipleSpans(t *testing.T) {
+	spans := []*span.Span{
+		{ID: "0000000000000001", Name: "root"},
+		{ID: "0000000000000002", ParentID: "0000000000000001", Name: "child"},
+		{TraceID: "0000000000000009", ID: "0000000000000003", Name: "other"},
+	}
+	c := traceContext{TraceID: "a3ce929d0e0e4736", ID: "f67b1f1d4e8a2c3b", ParentID: "0000000000000004"}
+	c.apply(spans)
+	root, child, other := spans[0], spans[1], spans[2]
+	if root.TraceID != c.TraceID || root.ID != "0000000000000001" || root.ParentID != c.ID {
+		t.Errorf("expected the root span to keep its ID and become a child of the header's span, got %+v", root)
+	}
+	if child.TraceID != c.TraceID || child.ID != "0000000000000002" || child.ParentID != "0000000000000001" {
+		t.Errorf("expected the child span to keep its IDs, got %+v", child)
+	}
+	if other.TraceID != "0000000000000009" || other.ParentID != "" {
+		t.Errorf("expected a span with its own trace ID to be left alone, got %+v", other)
+	}
+
+	lone := []*span.Span{{ID: "0000000000000005", Name: "lone"}}
+	c.apply(lone)
+	if s := lone[0]; s.ID != "0000000000000005" || s.ParentID != c.ID {
+		t.Errorf("expected a lone span with its own ID to keep it, got %+v", s)
+	}
+}
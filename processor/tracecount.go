@@ -0,0 +1,120 @@
+package processor
+
+import (
+	"sync"
+	"time"
+
+	"github.com/willthames/opentracing-processor/span"
+)
+
+// traceCounter is a SpanTransformer that counts the spans seen for each
+// trace over Window, observing each trace's count in spans_per_trace
+// once its window expires. At most MaxTraces are counted at once; when
+// that is exceeded the oldest trace is observed early. Spans are passed
+// through unchanged
+type traceCounter struct {
+	Window    time.Duration
+	MaxTraces int
+	Clock     Clock
+
+	mu     sync.Mutex
+	traces map[string]*countedTrace
+	order  []*countedTrace
+	done   chan struct{}
+	wg     sync.WaitGroup
+}
+
+// countedTrace is a trace whose spans are being counted
+type countedTrace struct {
+	id       string
+	deadline time.Time
+	spans    int
+}
+
+// Start begins periodically observing traces whose window has expired
+func (tc *traceCounter) Start() error {
+	if tc.Window == 0 {
+		tc.Window = 10 * time.Second
+	}
+	if tc.MaxTraces == 0 {
+		tc.MaxTraces = 10000
+	}
+	tc.done = make(chan struct{})
+	tc.wg.Add(1)
+	go tc.run()
+	return nil
+}
+
+// Stop observes every trace still being counted
+func (tc *traceCounter) Stop() error {
+	if tc.done != nil {
+		close(tc.done)
+		tc.wg.Wait()
+	}
+	tc.observe(tc.expire(time.Time{}))
+	return nil
+}
+
+func (tc *traceCounter) run() {
+	defer tc.wg.Done()
+	ticker := time.NewTicker(expiryTick(tc.Window))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-tc.done:
+			return
+		case <-ticker.C:
+			tc.observe(tc.expire(now(tc.Clock)))
+		}
+	}
+}
+
+func (tc *traceCounter) TransformSpans(spans []*span.Span) []*span.Span {
+	var evicted []*countedTrace
+	now := now(tc.Clock)
+	tc.mu.Lock()
+	if tc.traces == nil {
+		tc.traces = make(map[string]*countedTrace)
+	}
+	for _, s := range spans {
+		trace, ok := tc.traces[s.TraceID]
+		if !ok {
+			if tc.MaxTraces > 0 && len(tc.order) >= tc.MaxTraces {
+				evicted = append(evicted, tc.order[0])
+				tc.order = tc.order[1:]
+				delete(tc.traces, evicted[len(evicted)-1].id)
+			}
+			trace = &countedTrace{id: s.TraceID, deadline: now.Add(tc.Window)}
+			tc.traces[s.TraceID] = trace
+			tc.order = append(tc.order, trace)
+		}
+		trace.spans++
+	}
+	tc.mu.Unlock()
+	tc.observe(evicted)
+	return spans
+}
+
+// expire removes and returns all traces whose deadline is before now.
+// A zero now expires every trace
+func (tc *traceCounter) expire(now time.Time) []*countedTrace {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	// traces all share the same window, so order is also deadline order
+	i := 0
+	for ; i < len(tc.order); i++ {
+		if !now.IsZero() && tc.order[i].deadline.After(now) {
+			break
+		}
+		delete(tc.traces, tc.order[i].id)
+	}
+	expired := tc.order[:i]
+	tc.order = tc.order[i:]
+	return expired
+}
+
+func (tc *traceCounter) observe(traces []*countedTrace) {
+	for _, trace := range traces {
+		spansPerTrace.Observe(float64(trace.spans))
+	}
+}
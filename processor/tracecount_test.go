@@ -0,0 +1,38 @@
+package processor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/willthames/opentracing-processor/span"
+)
+
+func TestTraceCounter(t *testing.T) {
+	tc := &traceCounter{Window: time.Minute, MaxTraces: 2}
+	spans := []*span.Span{{TraceID: "1"}, {TraceID: "1"}, {TraceID: "2"}}
+	if got := tc.TransformSpans(spans); len(got) != 3 {
+		t.Errorf("expected spans to be passed through, got %d", len(got))
+	}
+	if expired := tc.expire(time.Now()); len(expired) != 0 {
+		t.Errorf("expected no traces to expire within the window, got %d", len(expired))
+	}
+	// a third trace evicts the first
+	tc.TransformSpans([]*span.Span{{TraceID: "3"}, {TraceID: "2"}})
+	if _, ok := tc.traces["1"]; ok {
+		t.Errorf("expected oldest trace to be evicted")
+	}
+	expired := tc.expire(time.Now().Add(2 * time.Minute))
+	if len(expired) != 2 || expired[0].id != "2" || expired[0].spans != 2 || expired[1].spans != 1 {
+		t.Errorf("unexpected expired traces %+v", expired)
+	}
+}
+
+func TestTraceCounterShortWindow(t *testing.T) {
+	tc := &traceCounter{Window: time.Nanosecond}
+	tc.Start()
+	tc.TransformSpans([]*span.Span{{TraceID: "1"}})
+	tc.Stop()
+	if len(tc.traces) != 0 {
+		t.Errorf("expected every trace to be observed on stop, got %d", len(tc.traces))
+	}
+}
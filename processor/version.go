@@ -0,0 +1,10 @@
+package processor
+
+// Version is the processor version, set at build time with
+// -ldflags "-X github.com/willthames/opentracing-processor/processor.Version=..."
+var Version = "dev"
+
+// defaultUserAgent identifies the processor in forwarded requests
+func defaultUserAgent() string {
+	return "opentracing-processor/" + Version
+}
@@ -0,0 +1,194 @@
+package span
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/uber/jaeger/thrift-gen/zipkincore"
+)
+
+// Binary annotation value types. BinaryAnnotation.Value holds bool,
+// []byte, int16, int32, int64, float64 or string respectively
+const (
+	AnnotationBool   = AnnotationType(zipkincore.AnnotationType_BOOL)
+	AnnotationBytes  = AnnotationType(zipkincore.AnnotationType_BYTES)
+	AnnotationI16    = AnnotationType(zipkincore.AnnotationType_I16)
+	AnnotationI32    = AnnotationType(zipkincore.AnnotationType_I32)
+	AnnotationI64    = AnnotationType(zipkincore.AnnotationType_I64)
+	AnnotationDouble = AnnotationType(zipkincore.AnnotationType_DOUBLE)
+	AnnotationString = AnnotationType(zipkincore.AnnotationType_STRING)
+)
+
+func (t AnnotationType) String() string {
+	return zipkincore.AnnotationType(t).String()
+}
+
+// UnmarshalJSON accepts either the numeric annotation type or its
+// name, e.g. "I64"
+func (t *AnnotationType) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err != nil {
+		var number int64
+		if err := json.Unmarshal(data, &number); err != nil {
+			return err
+		}
+		*t = AnnotationType(number)
+		return nil
+	}
+	annotationType, err := zipkincore.AnnotationTypeFromString(name)
+	if err != nil {
+		return err
+	}
+	*t = AnnotationType(annotationType)
+	return nil
+}
+
+// v1BinaryAnnotation is the JSON form of BinaryAnnotation.
+// AnnotationType is a pointer so that a missing type can be told
+// apart from BOOL
+type v1BinaryAnnotation struct {
+	Key            string          `json:"key"`
+	Value          interface{}     `json:"value"`
+	AnnotationType *AnnotationType `json:"annotationType"`
+	Host           *Endpoint       `json:"endpoint,omitempty"`
+}
+
+// binaryAnnotation converts the JSON form, with numbers decoded as
+// json.Number. Values are converted to their annotation type if one
+// was given and they fit it, otherwise the type is inferred from the
+// JSON value
+func (ba v1BinaryAnnotation) binaryAnnotation() BinaryAnnotation {
+	result := BinaryAnnotation{Key: ba.Key, Host: ba.Host}
+	if ba.AnnotationType != nil {
+		if value, err := coerceValue(ba.Value, *ba.AnnotationType); err == nil {
+			result.Value, result.AnnotationType = value, *ba.AnnotationType
+			return result
+		}
+	}
+	result.Value, result.AnnotationType = typedValue(ba.Value)
+	return result
+}
+
+func newV1BinaryAnnotation(ba BinaryAnnotation) v1BinaryAnnotation {
+	annotationType := ba.AnnotationType
+	return v1BinaryAnnotation{Key: ba.Key, Value: ba.Value, AnnotationType: &annotationType, Host: ba.Host}
+}
+
+// typedValue normalises value to one of the Go types used for binary
+// annotation values and returns its annotation type. Values of other
+// types are kept as they are and treated as strings
+func typedValue(value interface{}) (interface{}, AnnotationType) {
+	switch v := value.(type) {
+	case bool:
+		return v, AnnotationBool
+	case []byte:
+		return v, AnnotationBytes
+	case int16:
+		return v, AnnotationI16
+	case int32:
+		return v, AnnotationI32
+	case int64:
+		return v, AnnotationI64
+	case int:
+		return int64(v), AnnotationI64
+	case float32:
+		return float64(v), AnnotationDouble
+	case float64:
+		return v, AnnotationDouble
+	case json.Number:
+		if number, err := v.Int64(); err == nil {
+			return number, AnnotationI64
+		}
+		if number, err := v.Float64(); err == nil {
+			return number, AnnotationDouble
+		}
+		return v.String(), AnnotationString
+	default:
+		return v, AnnotationString
+	}
+}
+
+// coerceValue converts a decoded JSON value to the Go type used for
+// annotationType. Numbers may be given as JSON numbers or strings,
+// and bytes as base64 strings
+func coerceValue(value interface{}, annotationType AnnotationType) (interface{}, error) {
+	text, isText := value.(string)
+	if number, ok := value.(json.Number); ok {
+		text, isText = number.String(), true
+	}
+	switch annotationType {
+	case AnnotationBool:
+		if b, ok := value.(bool); ok {
+			return b, nil
+		}
+		if isText {
+			return strconv.ParseBool(text)
+		}
+	case AnnotationBytes:
+		if _, ok := value.(string); ok {
+			return base64.StdEncoding.DecodeString(text)
+		}
+	case AnnotationI16:
+		if isText {
+			number, err := strconv.ParseInt(text, 10, 16)
+			return int16(number), err
+		}
+	case AnnotationI32:
+		if isText {
+			number, err := strconv.ParseInt(text, 10, 32)
+			return int32(number), err
+		}
+	case AnnotationI64:
+		if isText {
+			return strconv.ParseInt(text, 10, 64)
+		}
+	case AnnotationDouble:
+		if isText {
+			return strconv.ParseFloat(text, 64)
+		}
+	case AnnotationString:
+		if isText {
+			return text, nil
+		}
+	}
+	return nil, fmt.Errorf("can't convert %v to %s", value, annotationType)
+}
+
+// convertBinaryAnnotationValue decodes a thrift binary annotation
+// value. Values too short for their type are kept as bytes
+func convertBinaryAnnotationValue(ba *zipkincore.BinaryAnnotation) (interface{}, AnnotationType) {
+	var number interface{}
+	switch ba.AnnotationType {
+	case zipkincore.AnnotationType_BOOL:
+		return bytes.Compare(ba.Value, []byte{0}) == 1, AnnotationBool
+	case zipkincore.AnnotationType_STRING:
+		return string(ba.Value), AnnotationString
+	case zipkincore.AnnotationType_I16:
+		number = new(int16)
+	case zipkincore.AnnotationType_I32:
+		number = new(int32)
+	case zipkincore.AnnotationType_I64:
+		number = new(int64)
+	case zipkincore.AnnotationType_DOUBLE:
+		number = new(float64)
+	default:
+		return ba.Value, AnnotationBytes
+	}
+	if err := binary.Read(bytes.NewReader(ba.Value), binary.BigEndian, number); err != nil {
+		return ba.Value, AnnotationBytes
+	}
+	switch n := number.(type) {
+	case *int16:
+		return *n, AnnotationI16
+	case *int32:
+		return *n, AnnotationI32
+	case *int64:
+		return *n, AnnotationI64
+	default:
+		return *n.(*float64), AnnotationDouble
+	}
+}
@@ -0,0 +1,98 @@
+package span
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/uber/jaeger/thrift-gen/zipkincore"
+)
+
+func TestThriftAnnotationTypes(t *testing.T) {
+	be := func(value interface{}) []byte {
+		var buf bytes.Buffer
+		binary.Write(&buf, binary.BigEndian, value)
+		return buf.Bytes()
+	}
+	data := encodeThrift(t, &zipkincore.Span{TraceID: 1, ID: 1, BinaryAnnotations: []*zipkincore.BinaryAnnotation{
+		{Key: "bool", Value: []byte{1}, AnnotationType: zipkincore.AnnotationType_BOOL},
+		{Key: "bytes", Value: []byte{1, 2}, AnnotationType: zipkincore.AnnotationType_BYTES},
+		{Key: "i16", Value: be(int16(-2)), AnnotationType: zipkincore.AnnotationType_I16},
+		{Key: "i32", Value: be(int32(404)), AnnotationType: zipkincore.AnnotationType_I32},
+		{Key: "i64", Value: be(int64(math.MaxInt64)), AnnotationType: zipkincore.AnnotationType_I64},
+		{Key: "double", Value: be(1.5), AnnotationType: zipkincore.AnnotationType_DOUBLE},
+		{Key: "string", Value: []byte("hello"), AnnotationType: zipkincore.AnnotationType_STRING},
+		{Key: "short", Value: []byte{1}, AnnotationType: zipkincore.AnnotationType_I64},
+	}})
+	spans, err := DecodeThrift(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []BinaryAnnotation{
+		{Key: "bool", Value: true, AnnotationType: AnnotationBool},
+		{Key: "bytes", Value: []byte{1, 2}, AnnotationType: AnnotationBytes},
+		{Key: "i16", Value: int16(-2), AnnotationType: AnnotationI16},
+		{Key: "i32", Value: int32(404), AnnotationType: AnnotationI32},
+		{Key: "i64", Value: int64(math.MaxInt64), AnnotationType: AnnotationI64},
+		{Key: "double", Value: 1.5, AnnotationType: AnnotationDouble},
+		{Key: "string", Value: "hello", AnnotationType: AnnotationString},
+		{Key: "short", Value: []byte{1}, AnnotationType: AnnotationBytes},
+	}
+	if !reflect.DeepEqual(spans[0].BinaryAnnotations, expected) {
+		t.Errorf("expected %v, got %v", expected, spans[0].BinaryAnnotations)
+	}
+
+	// types survive a JSON round trip
+	out, err := json.Marshal(spans)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := DecodeJSON(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded[0].BinaryAnnotations, expected) {
+		t.Errorf("expected %v after round trip through %s, got %v", expected, out, decoded[0].BinaryAnnotations)
+	}
+}
+
+func TestJSONAnnotationTypes(t *testing.T) {
+	b := []byte(`[{"traceId":"1","id":"1","binaryAnnotations":[
+		{"key":"http.status_code","value":200},
+		{"key":"ratio","value":0.5},
+		{"key":"error","value":true},
+		{"key":"port","value":"8080","annotationType":"I32"},
+		{"key":"big","value":9007199254740993,"annotationType":4},
+		{"key":"mislabelled","value":"abc","annotationType":"I64"}
+	]}]`)
+	spans, err := DecodeJSON(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []BinaryAnnotation{
+		{Key: "http.status_code", Value: int64(200), AnnotationType: AnnotationI64},
+		{Key: "ratio", Value: 0.5, AnnotationType: AnnotationDouble},
+		{Key: "error", Value: true, AnnotationType: AnnotationBool},
+		{Key: "port", Value: int32(8080), AnnotationType: AnnotationI32},
+		{Key: "big", Value: int64(9007199254740993), AnnotationType: AnnotationI64},
+		{Key: "mislabelled", Value: "abc", AnnotationType: AnnotationString},
+	}
+	if !reflect.DeepEqual(spans[0].BinaryAnnotations, expected) {
+		t.Errorf("expected %v, got %v", expected, spans[0].BinaryAnnotations)
+	}
+}
+
+func TestAddTagType(t *testing.T) {
+	s := new(Span)
+	s.AddTag("count", 3)
+	s.AddTag("name", "value")
+	if ba := s.BinaryAnnotations[0]; ba.Value != int64(3) || ba.AnnotationType != AnnotationI64 {
+		t.Errorf("expected int tag to be I64, got %v", ba)
+	}
+	if ba := s.BinaryAnnotations[1]; ba.AnnotationType != AnnotationString {
+		t.Errorf("expected string tag to be STRING, got %v", ba)
+	}
+}
@@ -0,0 +1,371 @@
+package span
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/uber/jaeger/thrift-gen/zipkincore"
+)
+
+// JSON schemas that a JSONEncoding can produce
+const (
+	SchemaV1 = "v1"
+	SchemaV2 = "v2"
+)
+
+// JSONEncoding controls the shape of JSON encoded spans, for collectors
+// that are particular about it. The zero value encodes spans as
+// MarshalJSON does
+type JSONEncoding struct {
+	// Schema is SchemaV1 (the default) or SchemaV2
+	Schema string
+	// UpperCaseIDs spells the ID field names traceID, parentID and
+	// traceIDHigh rather than traceId, parentId and traceIdHigh
+	UpperCaseIDs bool
+}
+
+// upperCaseIDFields maps ID field names to their upper cased forms
+var upperCaseIDFields = map[string]string{
+	"traceId":     "traceID",
+	"parentId":    "parentID",
+	"traceIdHigh": "traceIDHigh",
+}
+
+// v2Span is the Zipkin v2 JSON representation of a span
+type v2Span struct {
+	TraceID        string            `json:"traceId"`
+	ID             string            `json:"id"`
+	ParentID       string            `json:"parentId,omitempty"`
+	Name           string            `json:"name,omitempty"`
+	Kind           string            `json:"kind,omitempty"`
+	Timestamp      int64             `json:"timestamp,omitempty"`
+	Duration       int64             `json:"duration,omitempty"`
+	Debug          bool              `json:"debug,omitempty"`
+	Shared         bool              `json:"shared,omitempty"`
+	LocalEndpoint  *v2Endpoint       `json:"localEndpoint,omitempty"`
+	RemoteEndpoint *v2Endpoint       `json:"remoteEndpoint,omitempty"`
+	Annotations    []v2Annotation    `json:"annotations,omitempty"`
+	Tags           map[string]string `json:"tags,omitempty"`
+}
+
+// v2Endpoint is the Zipkin v2 JSON representation of an endpoint. Its
+// port is unsigned, unlike the thrift derived Endpoint's
+type v2Endpoint struct {
+	ServiceName string `json:"serviceName,omitempty"`
+	Ipv4        string `json:"ipv4,omitempty"`
+	Ipv6        string `json:"ipv6,omitempty"`
+	Port        uint16 `json:"port,omitempty"`
+}
+
+type v2Annotation struct {
+	Timestamp int64  `json:"timestamp"`
+	Value     string `json:"value"`
+}
+
+// Marshal encodes spans as a JSON list
+func (e JSONEncoding) Marshal(spans []*Span) ([]byte, error) {
+	if e.Schema != SchemaV2 && !e.UpperCaseIDs {
+		return json.Marshal(spans)
+	}
+	var buf bytes.Buffer
+	buf.WriteByte('[')
+	for i, s := range spans {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		data, err := e.marshalSpan(s)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(data)
+	}
+	buf.WriteByte(']')
+	return buf.Bytes(), nil
+}
+
+func (e JSONEncoding) marshalSpan(s *Span) ([]byte, error) {
+	var data []byte
+	var err error
+	switch e.Schema {
+	case "", SchemaV1:
+		data, err = s.MarshalJSON()
+	case SchemaV2:
+		data, err = s.marshalV2()
+	default:
+		return nil, fmt.Errorf("unknown JSON schema %s", e.Schema)
+	}
+	if err != nil || !e.UpperCaseIDs {
+		return data, err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	for from, to := range upperCaseIDFields {
+		if value, ok := fields[from]; ok {
+			delete(fields, from)
+			fields[to] = value
+		}
+	}
+	return json.Marshal(fields)
+}
+
+// startAnnotations and endAnnotations map a span kind to the v1 core
+// annotations recording when that side of the span started and ended
+var (
+	startAnnotations = map[string]string{
+		KindClient:   zipkincore.CLIENT_SEND,
+		KindServer:   zipkincore.SERVER_RECV,
+		KindProducer: zipkincore.MESSAGE_SEND,
+		KindConsumer: zipkincore.MESSAGE_RECV,
+	}
+	endAnnotations = map[string]string{
+		KindClient: zipkincore.CLIENT_RECV,
+		KindServer: zipkincore.SERVER_SEND,
+	}
+)
+
+// marshalV2 encodes s in the Zipkin v2 schema. Core annotations
+// matching the span kind are implied by the kind, so are dropped,
+// and give the timestamp and duration if the span has none. Binary
+// annotations become tags, except the ca and sa address annotations,
+// which give the remote endpoint. The local endpoint is the first
+// annotation host with a service name. Extra fields not otherwise
+// produced are passed through
+func (s *Span) marshalV2() ([]byte, error) {
+	v2 := v2Span{
+		TraceID:  s.TraceID,
+		ID:       s.ID,
+		ParentID: s.ParentID,
+		Name:     s.Name,
+		Kind:     s.Kind,
+		Duration: s.Duration.Microseconds(),
+		Debug:    s.ForceSampled(),
+		Shared:   s.Shared,
+	}
+	if s.TraceIDHigh != nil {
+		v2.TraceID = fmt.Sprintf("%016x", uint64(*s.TraceIDHigh)) + s.TraceID
+	}
+	if !s.Timestamp.IsZero() {
+		v2.Timestamp = s.Timestamp.UnixNano() / 1e3
+	}
+	if host := s.localEndpoint(); host != nil {
+		v2.LocalEndpoint = newV2Endpoint(host)
+	}
+	var start, end int64
+	for _, a := range s.Annotations {
+		if s.Kind != "" && coreAnnotationKind(a.Value) == s.Kind {
+			switch a.Value {
+			case startAnnotations[s.Kind]:
+				start = a.Timestamp
+			case endAnnotations[s.Kind]:
+				end = a.Timestamp
+			}
+			continue
+		}
+		v2.Annotations = append(v2.Annotations, v2Annotation{Timestamp: a.Timestamp, Value: a.Value})
+	}
+	if v2.Timestamp == 0 {
+		v2.Timestamp = start
+	}
+	if v2.Duration == 0 && start != 0 && end > start {
+		v2.Duration = end - start
+	}
+	for _, ba := range s.BinaryAnnotations {
+		if ba.Key == localComponentKey && ba.Value == "" {
+			// only there to carry the local endpoint
+			continue
+		}
+		if ba.Key == "ca" || ba.Key == "sa" {
+			// the server address is the better remote endpoint when
+			// a span has both
+			if ba.Host != nil && (v2.RemoteEndpoint == nil || ba.Key == "sa") {
+				v2.RemoteEndpoint = newV2Endpoint(ba.Host)
+			}
+			continue
+		}
+		if v2.Tags == nil {
+			v2.Tags = make(map[string]string)
+		}
+		v2.Tags[ba.Key] = tagString(ba.Value)
+	}
+	data, err := json.Marshal(v2)
+	if err != nil || len(s.Extra) == 0 {
+		return data, err
+	}
+	var produced map[string]json.RawMessage
+	if err := json.Unmarshal(data, &produced); err != nil {
+		return nil, err
+	}
+	extra := make(map[string]json.RawMessage)
+	for key, value := range s.Extra {
+		if _, ok := produced[key]; !ok {
+			extra[key] = value
+		}
+	}
+	if len(extra) == 0 {
+		return data, nil
+	}
+	return appendExtra(data, extra)
+}
+
+// localEndpoint returns the first annotation host with a service name,
+// ignoring address annotations, which describe the remote side
+func (s *Span) localEndpoint() *Endpoint {
+	for _, ba := range s.BinaryAnnotations {
+		if ba.Key != "ca" && ba.Key != "sa" && ba.Host != nil && ba.Host.ServiceName != "" {
+			return ba.Host
+		}
+	}
+	for _, a := range s.Annotations {
+		if a.Host != nil && a.Host.ServiceName != "" {
+			return a.Host
+		}
+	}
+	return nil
+}
+
+func newV2Endpoint(e *Endpoint) *v2Endpoint {
+	return &v2Endpoint{ServiceName: e.ServiceName, Ipv4: e.Ipv4, Ipv6: e.Ipv6, Port: uint16(e.Port)}
+}
+
+// tagString formats a binary annotation value as a v2 tag value
+func tagString(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case []byte:
+		return base64.StdEncoding.EncodeToString(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// localComponentKey is the v1 binary annotation that carries the local
+// endpoint of a span with no other annotations
+const localComponentKey = "lc"
+
+// v2Fields are the lower cased JSON keys modelled by v2Span
+var v2Fields = jsonFields(reflect.TypeOf(v2Span{}))
+
+// DecodeJSONV2 decodes Zipkin v2 JSON spans, from a list or a single
+// object, into the v1 model. Tags become string binary annotations.
+// The local endpoint is the host of every annotation, and the remote
+// endpoint becomes an sa annotation, or ca for server and consumer
+// spans. Core annotations implied by the kind are added from the
+// timestamp and duration. Other fields are kept in Extra
+func DecodeJSONV2(data []byte) ([]*Span, error) {
+	return decodeJSONV2(data, false)
+}
+
+// DecodeJSONV2Strict is like DecodeJSONV2, but returns an error naming
+// the offending field if the data contains any fields that the v2
+// schema doesn't define, or repeats a field within an object
+func DecodeJSONV2Strict(data []byte) ([]*Span, error) {
+	if err := checkDuplicateFields(json.NewDecoder(bytes.NewReader(data))); err != nil {
+		return nil, err
+	}
+	return decodeJSONV2(data, true)
+}
+
+func decodeJSONV2(data []byte, strict bool) ([]*Span, error) {
+	var objects []json.RawMessage
+	if trimmed := bytes.TrimLeft(data, " \t\r\n"); len(trimmed) > 0 && trimmed[0] == '{' {
+		objects = []json.RawMessage{data}
+	} else {
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		for decoded := 0; ; decoded++ {
+			var batch []json.RawMessage
+			err := decoder.Decode(&batch)
+			if err == io.EOF && decoded > 0 {
+				break
+			}
+			if err == io.EOF {
+				return nil, io.ErrUnexpectedEOF
+			}
+			if err != nil {
+				return nil, err
+			}
+			objects = append(objects, batch...)
+		}
+	}
+	spans := make([]*Span, len(objects))
+	for i, object := range objects {
+		var v2 v2Span
+		decoder := json.NewDecoder(bytes.NewReader(object))
+		if strict {
+			decoder.DisallowUnknownFields()
+		}
+		if err := decoder.Decode(&v2); err != nil {
+			return nil, err
+		}
+		spans[i] = v2.span()
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(object, &fields); err != nil {
+			return nil, err
+		}
+		for key, value := range fields {
+			if v2Fields[strings.ToLower(key)] {
+				continue
+			}
+			if spans[i].Extra == nil {
+				spans[i].Extra = make(map[string]json.RawMessage)
+			}
+			spans[i].Extra[key] = value
+		}
+	}
+	return spans, nil
+}
+
+// span converts a v2 span to the v1 model
+func (v2 v2Span) span() *Span {
+	s := &Span{
+		TraceID:   v2.TraceID,
+		ID:        v2.ID,
+		ParentID:  v2.ParentID,
+		Name:      v2.Name,
+		Kind:      v2.Kind,
+		Timestamp: convertTimestamp(v2.Timestamp),
+		Duration:  convertDuration(v2.Duration),
+		Debug:     v2.Debug,
+		Shared:    v2.Shared,
+	}
+	local := v2.LocalEndpoint.endpoint()
+	for _, a := range v2.Annotations {
+		s.Annotations = append(s.Annotations, &Annotation{Timestamp: a.Timestamp, Value: a.Value, Host: local})
+	}
+	s.AddCoreAnnotations(local)
+	keys := make([]string, 0, len(v2.Tags))
+	for key := range v2.Tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		s.BinaryAnnotations = append(s.BinaryAnnotations, BinaryAnnotation{Key: key, Value: v2.Tags[key], AnnotationType: AnnotationString, Host: local})
+	}
+	if remote := v2.RemoteEndpoint.endpoint(); remote != nil {
+		key := "sa"
+		if v2.Kind == KindServer || v2.Kind == KindConsumer {
+			key = "ca"
+		}
+		s.BinaryAnnotations = append(s.BinaryAnnotations, BinaryAnnotation{Key: key, Value: true, AnnotationType: AnnotationBool, Host: remote})
+	}
+	if local != nil && len(s.Annotations) == 0 && len(v2.Tags) == 0 {
+		s.BinaryAnnotations = append(s.BinaryAnnotations, BinaryAnnotation{Key: localComponentKey, Value: "", AnnotationType: AnnotationString, Host: local})
+	}
+	return s
+}
+
+// endpoint converts a v2 endpoint to the v1 model, or nil if e is
+func (e *v2Endpoint) endpoint() *Endpoint {
+	if e == nil {
+		return nil
+	}
+	return &Endpoint{ServiceName: e.ServiceName, Ipv4: e.Ipv4, Ipv6: e.Ipv6, Port: int16(e.Port)}
+}
@@ -0,0 +1,117 @@
+package span
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestJSONEncoding(t *testing.T) {
+	s := &Span{
+		TraceID:   "0000000000000001",
+		ID:        "0000000000000002",
+		ParentID:  "0000000000000003",
+		Name:      "get",
+		Kind:      KindClient,
+		Timestamp: time.Unix(1480979203, 0),
+		Duration:  time.Millisecond,
+	}
+	s.BinaryAnnotations = []BinaryAnnotation{
+		{Key: "http.status_code", Value: int64(200), AnnotationType: AnnotationI64, Host: &Endpoint{ServiceName: "mario"}},
+		{Key: "sa", Value: true, AnnotationType: AnnotationBool, Host: &Endpoint{ServiceName: "koopa", Port: 80}},
+	}
+
+	v1, err := JSONEncoding{}.Marshal([]*Span{s})
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain, _ := json.Marshal([]*Span{s})
+	if string(v1) != string(plain) {
+		t.Errorf("expected the default encoding to match json.Marshal, got %s", v1)
+	}
+
+	upper, err := JSONEncoding{UpperCaseIDs: true}.Marshal([]*Span{s})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fields []map[string]interface{}
+	json.Unmarshal(upper, &fields)
+	if fields[0]["traceID"] != s.TraceID || fields[0]["parentID"] != s.ParentID || fields[0]["traceId"] != nil {
+		t.Errorf("expected upper cased ID fields, got %s", upper)
+	}
+	if fields[0]["binaryAnnotations"] == nil {
+		t.Errorf("expected a v1 span, got %s", upper)
+	}
+
+	v2, err := JSONEncoding{Schema: SchemaV2}.Marshal([]*Span{s})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `[{"traceId":"0000000000000001","id":"0000000000000002","parentId":"0000000000000003","name":"get","kind":"CLIENT","timestamp":1480979203000000,"duration":1000,"localEndpoint":{"serviceName":"mario"},"remoteEndpoint":{"serviceName":"koopa","port":80},"tags":{"http.status_code":"200"}}]`
+	if string(v2) != expected {
+		t.Errorf("unexpected v2 encoding\n%s\nexpected\n%s", v2, expected)
+	}
+}
+
+func TestJSONEncodingV1ToV2(t *testing.T) {
+	v1 := `[{"traceId":"0000000000000001","id":"0000000000000002","name":"get",` +
+		`"annotations":[{"timestamp":1480979203000000,"value":"cs","endpoint":{"serviceName":"mario"}},` +
+		`{"timestamp":1480979203000100,"value":"retry","endpoint":{"serviceName":"mario"}},` +
+		`{"timestamp":1480979203002000,"value":"cr","endpoint":{"serviceName":"mario"}}],` +
+		`"binaryAnnotations":[{"key":"http.path","value":"/castle","endpoint":{"serviceName":"mario"}},` +
+		`{"key":"sa","value":true,"endpoint":{"serviceName":"koopa"}}]}]`
+	spans, err := DecodeJSON([]byte(v1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	v2, err := JSONEncoding{Schema: SchemaV2}.Marshal(spans)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `[{"traceId":"0000000000000001","id":"0000000000000002","name":"get","kind":"CLIENT","timestamp":1480979203000000,"duration":2000,"localEndpoint":{"serviceName":"mario"},"remoteEndpoint":{"serviceName":"koopa"},"annotations":[{"timestamp":1480979203000100,"value":"retry"}],"tags":{"http.path":"/castle"}}]`
+	if string(v2) != expected {
+		t.Errorf("unexpected v2 encoding\n%s\nexpected\n%s", v2, expected)
+	}
+}
+
+func TestDecodeJSONV2(t *testing.T) {
+	v2 := `[{"traceId":"5af7183fb1d4cf5f","id":"352bff9a74ca9ad2","parentId":"6b221d5bc9e6496c","name":"get /api",` +
+		`"kind":"SERVER","timestamp":1556604172355737,"duration":1431,` +
+		`"localEndpoint":{"serviceName":"backend","ipv4":"192.168.99.1","port":3306},` +
+		`"remoteEndpoint":{"ipv4":"172.19.0.2","port":58648},` +
+		`"tags":{"http.method":"GET","http.path":"/api"}}]`
+	spans, err := DecodeJSONV2([]byte(v2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := spans[0]
+	if s.Kind != KindServer || s.ServiceName() != "backend" || s.Duration != 1431*time.Microsecond {
+		t.Errorf("expected a backend server span, got %v", s)
+	}
+	if len(s.BinaryAnnotations) != 3 || s.BinaryAnnotations[0].Key != "http.method" || s.BinaryAnnotations[0].Value != "GET" {
+		t.Errorf("expected tags and the client address as binary annotations, got %v", s.BinaryAnnotations)
+	}
+	if len(s.Annotations) != 2 || s.Annotations[0].Value != "sr" || s.Annotations[1].Value != "ss" {
+		t.Errorf("expected server core annotations, got %v", s.Annotations)
+	}
+
+	encoded, err := JSONEncoding{Schema: SchemaV2}.Marshal(spans)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(encoded) != v2 {
+		t.Errorf("expected v2 spans to round trip\n%s\nexpected\n%s", encoded, v2)
+	}
+
+	// a span with nothing but a local endpoint keeps its service
+	spans, err = DecodeJSONV2([]byte(`{"traceId":"5af7183fb1d4cf5f","id":"352bff9a74ca9ad2","localEndpoint":{"serviceName":"backend"},"colour":"blue"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if spans[0].ServiceName() != "backend" || string(spans[0].Extra["colour"]) != `"blue"` {
+		t.Errorf("expected the service and unknown fields to be kept, got %v", spans[0])
+	}
+	if _, err := DecodeJSONV2Strict([]byte(`[{"traceId":"5af7183fb1d4cf5f","id":"352bff9a74ca9ad2","colour":"blue"}]`)); err == nil {
+		t.Error("expected strict decoding to refuse unknown fields")
+	}
+}
@@ -0,0 +1,89 @@
+package span
+
+import (
+	"bytes"
+	"reflect"
+)
+
+// Equal returns whether s and o describe the same span. Every field is
+// compared, with timestamps compared as instants and endpoints by
+// value. Annotations and binary annotations are compared regardless of
+// order, though the number of times each occurs must match. Extra JSON
+// fields must match byte for byte
+func (s *Span) Equal(o *Span) bool {
+	if s == nil || o == nil {
+		return s == o
+	}
+	if s.TraceID != o.TraceID || s.Name != o.Name || s.ID != o.ID || s.ParentID != o.ParentID ||
+		s.Debug != o.Debug || !s.Timestamp.Equal(o.Timestamp) || s.Duration != o.Duration ||
+		s.Kind != o.Kind || s.Shared != o.Shared {
+		return false
+	}
+	if (s.TraceIDHigh == nil) != (o.TraceIDHigh == nil) || (s.TraceIDHigh != nil && *s.TraceIDHigh != *o.TraceIDHigh) {
+		return false
+	}
+	if len(s.Extra) != len(o.Extra) {
+		return false
+	}
+	for key, value := range s.Extra {
+		other, ok := o.Extra[key]
+		if !ok || !bytes.Equal(value, other) {
+			return false
+		}
+	}
+	return sameAnnotations(s.Annotations, o.Annotations) && sameBinaryAnnotations(s.BinaryAnnotations, o.BinaryAnnotations)
+}
+
+// sameAnnotations returns whether a and b hold the same annotations in
+// any order
+func sameAnnotations(a, b []*Annotation) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	matched := make([]bool, len(b))
+	for _, x := range a {
+		found := false
+		for i, y := range b {
+			if !matched[i] && x.Timestamp == y.Timestamp && x.Value == y.Value && sameEndpoint(x.Host, y.Host) {
+				matched[i] = true
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// sameBinaryAnnotations returns whether a and b hold the same binary
+// annotations in any order
+func sameBinaryAnnotations(a, b []BinaryAnnotation) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	matched := make([]bool, len(b))
+	for _, x := range a {
+		found := false
+		for i, y := range b {
+			if !matched[i] && x.Key == y.Key && x.AnnotationType == y.AnnotationType &&
+				reflect.DeepEqual(x.Value, y.Value) && sameEndpoint(x.Host, y.Host) {
+				matched[i] = true
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func sameEndpoint(a, b *Endpoint) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
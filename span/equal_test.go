@@ -0,0 +1,45 @@
+package span
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestEqual(t *testing.T) {
+	makeSpan := func() *Span {
+		s := &Span{
+			TraceID:   "0000000000000001",
+			ID:        "0000000000000002",
+			Name:      "get",
+			Timestamp: time.Unix(1480979203, 0),
+			Duration:  time.Millisecond,
+			Extra:     map[string]json.RawMessage{"remoteEndpoint": json.RawMessage(`{"serviceName":"koopa"}`)},
+		}
+		s.Annotations = []*Annotation{{Timestamp: 1, Value: "cs"}, {Timestamp: 2, Value: "cr"}}
+		s.AddTag("http.method", "GET")
+		s.AddTag("http.status_code", 200)
+		return s
+	}
+	a := makeSpan()
+	b := makeSpan()
+	b.Timestamp = b.Timestamp.In(time.FixedZone("elsewhere", 3600))
+	b.Annotations[0], b.Annotations[1] = b.Annotations[1], b.Annotations[0]
+	b.BinaryAnnotations[0], b.BinaryAnnotations[1] = b.BinaryAnnotations[1], b.BinaryAnnotations[0]
+	if !a.Equal(b) {
+		t.Errorf("expected spans differing only in annotation order and time zone to be equal")
+	}
+
+	b.AddTag("http.method", "GET")
+	if a.Equal(b) {
+		t.Errorf("expected a repeated annotation to make spans unequal")
+	}
+	c := makeSpan()
+	c.Extra["remoteEndpoint"] = json.RawMessage(`{"serviceName":"bowser"}`)
+	if a.Equal(c) {
+		t.Errorf("expected differing extra fields to make spans unequal")
+	}
+	if a.Equal(nil) || !(*Span)(nil).Equal(nil) {
+		t.Errorf("unexpected nil span comparison")
+	}
+}
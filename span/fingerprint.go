@@ -0,0 +1,44 @@
+package span
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sort"
+)
+
+// Fingerprint returns a hash of the span's service, name and kind and
+// the values of the tags with the given keys, so that spans doing the
+// same thing can be grouped or deduplicated. The order of keys doesn't
+// matter, and a missing tag hashes differently to an empty one. The
+// hash is FNV-1a, so is stable across processes and Go versions
+func (s *Span) Fingerprint(keys []string) uint64 {
+	h := fnv.New64a()
+	write := func(value string) {
+		h.Write([]byte(value))
+		h.Write([]byte{0})
+	}
+	write(s.ServiceName())
+	write(s.Name)
+	write(s.Kind)
+	sorted := append([]string(nil), keys...)
+	sort.Strings(sorted)
+	for _, key := range sorted {
+		write(key)
+		if tag := s.tag(key); tag != nil {
+			write("=" + fmt.Sprint(tag.Value))
+		} else {
+			write("")
+		}
+	}
+	return h.Sum64()
+}
+
+// tag returns the first binary annotation with key, or nil
+func (s *Span) tag(key string) *BinaryAnnotation {
+	for i := range s.BinaryAnnotations {
+		if s.BinaryAnnotations[i].Key == key {
+			return &s.BinaryAnnotations[i]
+		}
+	}
+	return nil
+}
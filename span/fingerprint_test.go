@@ -0,0 +1,33 @@
+package span
+
+import "testing"
+
+func TestFingerprint(t *testing.T) {
+	newSpan := func(id string, tags map[string]interface{}) *Span {
+		s := &Span{TraceID: id, ID: id, Name: "GET /users", Kind: KindServer}
+		s.BinaryAnnotations = []BinaryAnnotation{{Key: "lc", Value: "", Host: &Endpoint{ServiceName: "users"}}}
+		for key, value := range tags {
+			s.AddTag(key, value)
+		}
+		return s
+	}
+	keys := []string{"http.method", "http.status_code"}
+	a := newSpan("1", map[string]interface{}{"http.method": "GET", "http.status_code": 200, "user": "a"})
+	b := newSpan("2", map[string]interface{}{"http.method": "GET", "http.status_code": 200, "user": "b"})
+	if a.Fingerprint(keys) != b.Fingerprint([]string{"http.status_code", "http.method"}) {
+		t.Errorf("spans differing only in untracked tags and ids should share a fingerprint")
+	}
+	failed := newSpan("3", map[string]interface{}{"http.method": "GET", "http.status_code": 500})
+	if a.Fingerprint(keys) == failed.Fingerprint(keys) {
+		t.Errorf("spans with different tracked tag values should have different fingerprints")
+	}
+	empty := newSpan("4", map[string]interface{}{"http.method": ""})
+	missing := newSpan("5", nil)
+	if empty.Fingerprint(keys) == missing.Fingerprint(keys) {
+		t.Errorf("a missing tag should fingerprint differently to an empty one")
+	}
+	// guard against the hash changing between releases
+	if fp := missing.Fingerprint(nil); fp != 0x2a3e0a82147a431b {
+		t.Errorf("fingerprint changed to %#x", fp)
+	}
+}
@@ -0,0 +1,25 @@
+package span
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// SamplingPriorityTag is the OpenTracing tag that asks for a span to be
+// sampled (above zero) or not (zero)
+const SamplingPriorityTag = "sampling.priority"
+
+// ForceSampled returns whether the span must be kept by downstream
+// sampling, because it is a debug span or its sampling priority is above
+// zero
+func (s *Span) ForceSampled() bool {
+	if s.Debug {
+		return true
+	}
+	ba := s.tag(SamplingPriorityTag)
+	if ba == nil {
+		return false
+	}
+	priority, err := strconv.ParseFloat(fmt.Sprint(ba.Value), 64)
+	return err == nil && priority > 0
+}
@@ -0,0 +1,37 @@
+package span
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestForceSampled(t *testing.T) {
+	for _, test := range []struct {
+		span     *Span
+		expected bool
+	}{
+		{&Span{}, false},
+		{&Span{Debug: true}, true},
+		{&Span{BinaryAnnotations: []BinaryAnnotation{{Key: SamplingPriorityTag, Value: int64(1), AnnotationType: AnnotationI64}}}, true},
+		{&Span{BinaryAnnotations: []BinaryAnnotation{{Key: SamplingPriorityTag, Value: "1", AnnotationType: AnnotationString}}}, true},
+		{&Span{BinaryAnnotations: []BinaryAnnotation{{Key: SamplingPriorityTag, Value: int64(0), AnnotationType: AnnotationI64}}}, false},
+	} {
+		if got := test.span.ForceSampled(); got != test.expected {
+			t.Errorf("expected ForceSampled %v for %v, got %v", test.expected, test.span.BinaryAnnotations, got)
+		}
+	}
+}
+
+func TestSamplingPriorityForwarded(t *testing.T) {
+	s := &Span{TraceID: "0000000000000001", ID: "0000000000000001"}
+	s.AddTag(SamplingPriorityTag, 1)
+	for _, schema := range []string{SchemaV1, SchemaV2} {
+		out, err := JSONEncoding{Schema: schema}.Marshal([]*Span{s})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(out), `"debug":true`) {
+			t.Errorf("expected a prioritised span to be forwarded as debug in %s, got %s", schema, out)
+		}
+	}
+}
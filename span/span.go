@@ -4,9 +4,12 @@ import (
 	"encoding/json"
 
 	"bytes"
-	"encoding/binary"
 	"fmt"
+	"io"
 	"net"
+	"reflect"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/sirupsen/logrus"
@@ -28,8 +31,24 @@ type Span struct {
 	Timestamp         time.Time
 	Duration          time.Duration
 	TraceIDHigh       *int64
+	// Kind is one of the Kind constants, or empty if unknown
+	Kind string
+	// Shared is set on a server span that shares its ID with the
+	// client span that started it
+	Shared bool
+	// Extra holds any JSON fields that Span doesn't model, so that
+	// they survive being forwarded
+	Extra map[string]json.RawMessage
 }
 
+// Span kinds, as used by Zipkin v2
+const (
+	KindClient   = "CLIENT"
+	KindServer   = "SERVER"
+	KindProducer = "PRODUCER"
+	KindConsumer = "CONSUMER"
+)
+
 // V1Spans is the result of thrift decoding the spans input
 type v1Spans struct {
 	spans []v1Span `thrift:"spans,1"`
@@ -37,16 +56,18 @@ type v1Spans struct {
 
 // v1Span is used as an intermediate step between encoding and the Span tyhpe
 type v1Span struct {
-	TraceID           string             `thrift:"trace_id,1" json:"traceId"`
-	Name              string             `thrift:"name,3" json:"name"`
-	ID                string             `thrift:"id,4" json:"id"`
-	ParentID          string             `thrift:"parent_id,5" json:"parentId,omitempty"`
-	Annotations       []*Annotation      `thrift:"annotations,6" json:"annotations"`
-	Debug             bool               `thrift:"debug,9" json:"debug,omitempty"`
-	TraceIDHigh       *int64             `thrift:"trace_id_high,12" json:"traceIdHigh,omitempty"`
-	BinaryAnnotations []BinaryAnnotation `thrift:"binary_annotations,8" json:"binaryAnnotations"`
-	Timestamp         int64              `thrift:"timestamp,10" json:"timestamp,omitempty"`
-	Duration          int64              `thrift:"duration,11" json:"duration,omitempty"`
+	TraceID           string               `thrift:"trace_id,1" json:"traceId"`
+	Name              string               `thrift:"name,3" json:"name"`
+	ID                string               `thrift:"id,4" json:"id"`
+	ParentID          string               `thrift:"parent_id,5" json:"parentId,omitempty"`
+	Annotations       []*Annotation        `thrift:"annotations,6" json:"annotations"`
+	Debug             bool                 `thrift:"debug,9" json:"debug,omitempty"`
+	TraceIDHigh       *int64               `thrift:"trace_id_high,12" json:"traceIdHigh,omitempty"`
+	BinaryAnnotations []v1BinaryAnnotation `thrift:"binary_annotations,8" json:"binaryAnnotations"`
+	Timestamp         int64                `thrift:"timestamp,10" json:"timestamp,omitempty"`
+	Duration          int64                `thrift:"duration,11" json:"duration,omitempty"`
+	Kind              string               `json:"kind,omitempty"`
+	Shared            bool                 `json:"shared,omitempty"`
 }
 
 type Annotation struct {
@@ -55,6 +76,8 @@ type Annotation struct {
 	Host      *Endpoint `thrift:"host,3" json:"endpoint,omitempty"`
 }
 
+// AnnotationType is the type of a binary annotation's value, one of
+// the Annotation type constants
 type AnnotationType int64
 
 type BinaryAnnotation struct {
@@ -64,11 +87,13 @@ type BinaryAnnotation struct {
 	Host           *Endpoint      `thrift:"host,4" json:"endpoint,omitempty"`
 }
 
+// Endpoint is the network address and service of the host that
+// recorded an annotation. Ipv4 and Ipv6 are in text form
 type Endpoint struct {
 	Ipv4        string `thrift:"ipv4,1" json:"ipv4"`
 	Port        int16  `thrift:"port,2" json:"port"`
 	ServiceName string `thrift:"service_name,3" json:"serviceName"`
-	Ipv6        []byte `thrift:"ipv6,4" json:"ipv6,omitempty"`
+	Ipv6        string `thrift:"ipv6,4" json:"ipv6,omitempty"`
 }
 
 func (s Span) String() string {
@@ -80,19 +105,20 @@ func (a Annotation) String() string {
 }
 
 func (ba BinaryAnnotation) String() string {
-	switch ba.AnnotationType {
-	case AnnotationType(zipkincore.AnnotationType_STRING):
-		return fmt.Sprintf("BinaryAnnotation({Key:%s Value:%s Host:%#v})", ba.Key, string(ba.Value.(string)), ba.Host)
-	default:
-		return fmt.Sprintf("BinaryAnnotation({Key:%s Value:%v Host:%#v})", ba.Key, ba.Value, ba.Host)
-	}
+	return fmt.Sprintf("BinaryAnnotation({Key:%s Value:%v Type:%s Host:%#v})", ba.Key, ba.Value, ba.AnnotationType, ba.Host)
 }
 
 func convertEndpoint(ep *zipkincore.Endpoint) *Endpoint {
+	if ep == nil {
+		return nil
+	}
 	result := new(Endpoint)
 	result.Ipv4 = convertIPv4(ep.Ipv4)
 	result.Port = ep.Port
 	result.ServiceName = ep.ServiceName
+	if len(ep.Ipv6) == net.IPv6len {
+		result.Ipv6 = net.IP(ep.Ipv6).String()
+	}
 	return result
 }
 
@@ -101,6 +127,9 @@ func convertDuration(duration int64) time.Duration {
 }
 
 func convertTimestamp(timestamp int64) time.Time {
+	if timestamp == 0 {
+		return time.Time{}
+	}
 	return time.Unix(timestamp/1e6, (timestamp%1e6)*1e3)
 }
 
@@ -115,27 +144,66 @@ func (v1span v1Span) Span() *Span {
 		BinaryAnnotations: convertJSONAnnotations(v1span.BinaryAnnotations),
 		Debug:             v1span.Debug,
 		TraceIDHigh:       v1span.TraceIDHigh,
+		Kind:              v1span.Kind,
+		Shared:            v1span.Shared,
+	}
+	if span.Kind == "" {
+		span.Kind = kindFromAnnotations(span.Annotations)
 	}
 	span.Duration = convertDuration(v1span.Duration)
 	span.Timestamp = convertTimestamp(v1span.Timestamp)
 	return span
 }
 
-func convertJSONAnnotations(ba []BinaryAnnotation) []BinaryAnnotation {
-	result := make([]BinaryAnnotation, len(ba))
-	for index, ann := range ba {
-		result[index] = BinaryAnnotation(ann)
-		switch ann.Value.(type) {
-		case int:
-			result[index].AnnotationType = AnnotationType(zipkincore.AnnotationType_I64)
-		case string:
-			result[index].AnnotationType = AnnotationType(zipkincore.AnnotationType_STRING)
-		case bool:
-			result[index].AnnotationType = AnnotationType(zipkincore.AnnotationType_BOOL)
-		default:
-			result[index].AnnotationType = AnnotationType(zipkincore.AnnotationType_STRING)
+// kindFromAnnotations derives the span kind from v1 core annotations
+func kindFromAnnotations(annotations []*Annotation) string {
+	for _, annotation := range annotations {
+		if kind := coreAnnotationKind(annotation.Value); kind != "" {
+			return kind
+		}
+	}
+	return ""
+}
+
+// coreAnnotationKind returns the span kind a v1 core annotation
+// implies, or empty if value is not a core annotation
+func coreAnnotationKind(value string) string {
+	switch value {
+	case zipkincore.CLIENT_SEND, zipkincore.CLIENT_RECV:
+		return KindClient
+	case zipkincore.SERVER_RECV, zipkincore.SERVER_SEND:
+		return KindServer
+	case zipkincore.MESSAGE_SEND:
+		return KindProducer
+	case zipkincore.MESSAGE_RECV:
+		return KindConsumer
+	}
+	return ""
+}
+
+// sharedFromAnnotations reports whether a v1 span is the server half
+// of a span shared with its client. Thrift has no shared flag, so
+// like Zipkin's v1 conversion it is inferred from the span containing
+// client annotations as well, or from the server not having recorded
+// the span's timestamp
+func sharedFromAnnotations(annotations []*Annotation, hasTimestamp bool) bool {
+	var client, server bool
+	for _, annotation := range annotations {
+		switch annotation.Value {
+		case zipkincore.CLIENT_SEND, zipkincore.CLIENT_RECV:
+			client = true
+		case zipkincore.SERVER_RECV, zipkincore.SERVER_SEND:
+			server = true
 		}
 	}
+	return server && (client || !hasTimestamp)
+}
+
+func convertJSONAnnotations(annotations []v1BinaryAnnotation) []BinaryAnnotation {
+	result := make([]BinaryAnnotation, len(annotations))
+	for index, ba := range annotations {
+		result[index] = ba.binaryAnnotation()
+	}
 	return result
 }
 
@@ -147,9 +215,14 @@ func (v1spans v1Spans) Spans() []*Span {
 	return result
 }
 
-// NewJSONSpan converts a Span into JSONSpan suitable for Marshalling
+// NewJSONSpan converts a Span into JSONSpan suitable for Marshalling.
+// Spans with a positive sampling priority are marked debug, which is
+// how Zipkin is told to keep them
 func newV1Span(span Span) v1Span {
-	timestamp := span.Timestamp.UnixNano() / 1e3
+	var timestamp int64
+	if !span.Timestamp.IsZero() {
+		timestamp = span.Timestamp.UnixNano() / 1e3
+	}
 	duration := span.Duration.Microseconds()
 	v1span := v1Span{
 		TraceID:           span.TraceID,
@@ -157,26 +230,87 @@ func newV1Span(span Span) v1Span {
 		ID:                span.ID,
 		ParentID:          span.ParentID,
 		Annotations:       span.Annotations,
-		Debug:             span.Debug,
+		Debug:             span.ForceSampled(),
 		TraceIDHigh:       span.TraceIDHigh,
-		BinaryAnnotations: span.BinaryAnnotations,
+		BinaryAnnotations: make([]v1BinaryAnnotation, len(span.BinaryAnnotations)),
 		Timestamp:         timestamp,
 		Duration:          duration,
+		Kind:              span.Kind,
+		Shared:            span.Shared,
+	}
+	for index, ba := range span.BinaryAnnotations {
+		v1span.BinaryAnnotations[index] = newV1BinaryAnnotation(ba)
 	}
 	return v1span
 }
 
+// v1Fields are the lower cased JSON keys modelled by v1Span
+var v1Fields = jsonFields(reflect.TypeOf(v1Span{}))
+
+func jsonFields(t reflect.Type) map[string]bool {
+	fields := make(map[string]bool)
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		fields[strings.ToLower(name)] = true
+	}
+	return fields
+}
+
 func (s Span) MarshalJSON() ([]byte, error) {
-	return json.Marshal(newV1Span(s))
+	data, err := json.Marshal(newV1Span(s))
+	if err != nil || len(s.Extra) == 0 {
+		return data, err
+	}
+	return appendExtra(data, s.Extra)
+}
+
+// appendExtra adds extra fields to the end of the encoded JSON object
+// data, in key order
+func appendExtra(data []byte, extra map[string]json.RawMessage) ([]byte, error) {
+	keys := make([]string, 0, len(extra))
+	for key := range extra {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	buf := bytes.NewBuffer(data[:len(data)-1])
+	for _, key := range keys {
+		if buf.Len() > 1 {
+			buf.WriteByte(',')
+		}
+		name, err := json.Marshal(key)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(name)
+		buf.WriteByte(':')
+		buf.Write(extra[key])
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
 }
 
 func (s *Span) UnmarshalJSON(data []byte) error {
 	var v1span v1Span
 	logrus.WithField("json", string(data)).Trace("Unmarshalling span from json")
-	if err := json.Unmarshal(data, &v1span); err != nil {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&v1span); err != nil {
 		return err
 	}
 	*s = *v1span.Span()
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	for key, value := range fields {
+		if v1Fields[strings.ToLower(key)] {
+			continue
+		}
+		if s.Extra == nil {
+			s.Extra = make(map[string]json.RawMessage)
+		}
+		s.Extra[key] = value
+	}
 	logrus.WithField("span", s).Trace("Unmarshalled span from json")
 	return nil
 }
@@ -197,6 +331,8 @@ func convertThriftSpan(ts *zipkincore.Span) *Span {
 	for i, annotation := range ts.Annotations {
 		s.Annotations[i] = &Annotation{Host: convertEndpoint(annotation.Host), Value: annotation.Value, Timestamp: annotation.Timestamp}
 	}
+	s.Kind = kindFromAnnotations(s.Annotations)
+	s.Shared = sharedFromAnnotations(s.Annotations, ts.Timestamp != nil)
 
 	if ts.Duration != nil {
 		s.Duration = convertDuration(*ts.Duration)
@@ -208,20 +344,15 @@ func convertThriftSpan(ts *zipkincore.Span) *Span {
 		s.Timestamp = time.Now().UTC()
 	}
 
+	// each binary annotation keeps its own endpoint. For "ca" (client
+	// addr) and "sa" (server addr) that is the address of the *remote*
+	// source or destination of an RPC rather than the local host, see
+	// https://github.com/openzipkin/zipkin/blob/c7b341b9b421e7a57c/zipkin/src/main/java/zipkin/Endpoint.java#L35
+	// so ServiceName ignores them
 	s.BinaryAnnotations = make([]BinaryAnnotation, len(ts.BinaryAnnotations))
-
 	for index, ba := range ts.BinaryAnnotations {
-		if ba.Key == "ca" || ba.Key == "sa" {
-			// BinaryAnnotations with key "ca" (client addr) or "sa" (server addr)
-			// are special: the endpoint value for those is the address of the
-			// *remote* source or destination of an RPC, rather than the local
-			// hostname. See
-			// https://github.com/openzipkin/zipkin/blob/c7b341b9b421e7a57c/zipkin/src/main/java/zipkin/Endpoint.java#L35
-			// So for those, we don't want to lift the endpoint into the span's
-			// own hostIPv4/ServiceName/etc. fields. Simply skip those for now.
-			continue
-		}
-		s.BinaryAnnotations[index] = BinaryAnnotation{Host: convertEndpoint(ba.Host), Key: ba.Key, Value: convertBinaryAnnotationValue(ba), AnnotationType: AnnotationType(ba.AnnotationType)}
+		value, annotationType := convertBinaryAnnotationValue(ba)
+		s.BinaryAnnotations[index] = BinaryAnnotation{Host: convertEndpoint(ba.Host), Key: ba.Key, Value: value, AnnotationType: annotationType}
 	}
 	return s
 }
@@ -234,56 +365,240 @@ func convertIPv4(ip int32) string {
 	return net.IPv4(byte(ip>>24), byte(ip>>16), byte(ip>>8), byte(ip)).String()
 }
 
-func convertBinaryAnnotationValue(ba *zipkincore.BinaryAnnotation) interface{} {
-	switch ba.AnnotationType {
-	case zipkincore.AnnotationType_BOOL:
-		return bytes.Compare(ba.Value, []byte{0}) == 1
-	case zipkincore.AnnotationType_BYTES:
-		return ba.Value
-	case zipkincore.AnnotationType_DOUBLE, zipkincore.AnnotationType_I16, zipkincore.AnnotationType_I32, zipkincore.AnnotationType_I64:
-		var number interface{}
-		binary.Read(bytes.NewReader(ba.Value), binary.BigEndian, number)
-		return number
-	case zipkincore.AnnotationType_STRING:
-		return string(ba.Value)
+// DecodeJSON decodes JSON arrays of spans. Several arrays may follow
+// one another (e.g. from concatenated gzip members), in which case
+// the spans from all of them are returned. A single span object that
+// isn't in an array is also accepted
+func DecodeJSON(data []byte) ([]*Span, error) {
+	if trimmed := bytes.TrimLeft(data, " \t\r\n"); len(trimmed) > 0 && trimmed[0] == '{' {
+		s := new(Span)
+		if err := json.Unmarshal(data, s); err != nil {
+			return nil, err
+		}
+		return []*Span{s}, nil
 	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	var spans []*Span
+	for decoded := 0; ; decoded++ {
+		var batch []*Span
+		err := decoder.Decode(&batch)
+		if err == io.EOF && decoded > 0 {
+			break
+		}
+		if err == io.EOF {
+			return nil, io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return nil, err
+		}
+		spans = append(spans, batch...)
+	}
+	return spans, nil
+}
 
-	return ba.Value
+// DecodeNDJSON decodes newline delimited JSON, with one span per line
+func DecodeNDJSON(data []byte) ([]*Span, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	var spans []*Span
+	for {
+		s := new(Span)
+		err := decoder.Decode(s)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		spans = append(spans, s)
+	}
+	return spans, nil
 }
 
-// DecodeThrift reads a list of encoded thrift spans from an io.Reader, and
-// converts that list to a slice of Spans.
+// DecodeJSONStrict is like DecodeJSON, but returns an error naming
+// the offending field if the data contains any fields that Span
+// doesn't model, at any level, or repeats a field within an object
+func DecodeJSONStrict(data []byte) ([]*Span, error) {
+	if err := checkDuplicateFields(json.NewDecoder(bytes.NewReader(data))); err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	decoder.UseNumber()
+	if trimmed := bytes.TrimLeft(data, " \t\r\n"); len(trimmed) > 0 && trimmed[0] == '{' {
+		var v1span v1Span
+		if err := decoder.Decode(&v1span); err != nil {
+			return nil, err
+		}
+		if _, err := decoder.Token(); err != io.EOF {
+			return nil, fmt.Errorf("invalid character after top-level value")
+		}
+		return []*Span{v1span.Span()}, nil
+	}
+	var spans []*Span
+	for decoded := 0; ; decoded++ {
+		var batch []v1Span
+		err := decoder.Decode(&batch)
+		if err == io.EOF && decoded > 0 {
+			break
+		}
+		if err == io.EOF {
+			return nil, io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, v1span := range batch {
+			spans = append(spans, v1span.Span())
+		}
+	}
+	return spans, nil
+}
+
+// checkDuplicateFields reads every JSON value from decoder, returning
+// an error if any object has the same field more than once. Fields
+// are compared case insensitively, as encoding/json matches them
+func checkDuplicateFields(decoder *json.Decoder) error {
+	for {
+		err := checkValue(decoder)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func checkValue(decoder *json.Decoder) error {
+	token, err := decoder.Token()
+	if err != nil {
+		return err
+	}
+	switch token {
+	case json.Delim('{'):
+		fields := make(map[string]bool)
+		for decoder.More() {
+			token, err := decoder.Token()
+			if err != nil {
+				return err
+			}
+			field := strings.ToLower(token.(string))
+			if fields[field] {
+				return fmt.Errorf("json: duplicate field %q", token)
+			}
+			fields[field] = true
+			if err := checkValue(decoder); err != nil {
+				return err
+			}
+		}
+	case json.Delim('['):
+		for decoder.More() {
+			if err := checkValue(decoder); err != nil {
+				return err
+			}
+		}
+	default:
+		return nil
+	}
+	// consume the closing delimiter
+	_, err = decoder.Token()
+	return err
+}
+
+// DecodeThrift reads lists of encoded thrift spans from data, and
+// converts them to a slice of Spans.
 // The implementation is based on jaeger internals, but not exported there.
 func DecodeThrift(data []byte) ([]*Span, error) {
 	buffer := thrift.NewTMemoryBuffer()
 	buffer.Write(data)
 
 	transport := thrift.NewTBinaryProtocolTransport(buffer)
-	_, size, err := transport.ReadListBegin() // Ignore the returned element type
-	if err != nil {
-		return nil, err
-	}
-
-	// We don't depend on the size returned by ReadListBegin to preallocate the array because it
-	// sometimes returns a nil error on bad input and provides an unreasonably large int for size
 	var spans []*Span
-	for i := 0; i < size; i++ {
-		zs := &zipkincore.Span{}
-		if err = zs.Read(transport); err != nil {
+	// keep reading while there is data, as several lists may have been
+	// concatenated together
+	for buffer.Len() > 0 {
+		_, size, err := transport.ReadListBegin() // Ignore the returned element type
+		if err != nil {
+			return nil, err
+		}
+
+		// We don't depend on the size returned by ReadListBegin to preallocate the array because it
+		// sometimes returns a nil error on bad input and provides an unreasonably large int for size
+		for i := 0; i < size; i++ {
+			zs := &zipkincore.Span{}
+			if err = zs.Read(transport); err != nil {
+				return nil, err
+			}
+			logrus.WithField("span", zs).Trace("Unmarshalled span from thrift")
+			span := convertThriftSpan(zs)
+			logrus.WithField("span", span).Trace("Converted span from zipkin form")
+			spans = append(spans, span)
+		}
+		if err := transport.ReadListEnd(); err != nil {
 			return nil, err
 		}
-		logrus.WithField("span", zs).Trace("Unmarshalled span from thrift")
-		span := convertThriftSpan(zs)
-		logrus.WithField("span", span).Trace("Converted span from zipkin form")
-		spans = append(spans, span)
 	}
 
 	return spans, nil
 }
 
 // AddTag adds a binary annotation with a key/value pair
-// to the span
+// to the span, typed according to value
 func (s *Span) AddTag(key string, value interface{}) {
-	tag := BinaryAnnotation{Key: key, Value: value}
+	tag := BinaryAnnotation{Key: key}
+	tag.Value, tag.AnnotationType = typedValue(value)
 	s.BinaryAnnotations = append(s.BinaryAnnotations, tag)
 }
+
+// AddCoreAnnotations adds the v1 core annotations for the span's kind
+// (e.g. sr and ss for a server span), hosted on host and timed from
+// the span's timestamp and duration, unless they are already present.
+// Spans without a timestamp are left alone
+func (s *Span) AddCoreAnnotations(host *Endpoint) {
+	if s.Timestamp.IsZero() {
+		return
+	}
+	recorded := make(map[string]bool)
+	for _, a := range s.Annotations {
+		recorded[a.Value] = true
+	}
+	start := s.Timestamp.UnixNano() / 1e3
+	if value, ok := startAnnotations[s.Kind]; ok && !recorded[value] {
+		s.Annotations = append(s.Annotations, &Annotation{Timestamp: start, Value: value, Host: host})
+	}
+	if value, ok := endAnnotations[s.Kind]; ok && s.Duration > 0 && !recorded[value] {
+		s.Annotations = append(s.Annotations, &Annotation{Timestamp: start + s.DurationMicros(), Value: value, Host: host})
+	}
+}
+
+// ServiceName returns the name of the service that reported the span,
+// taken from the first binary annotation endpoint that has one, or
+// failing that the first annotation endpoint (e.g. that of sr). The
+// ca and sa address annotations describe the remote service, so are
+// skipped
+func (s *Span) ServiceName() string {
+	for _, ba := range s.BinaryAnnotations {
+		if ba.Key == "ca" || ba.Key == "sa" {
+			continue
+		}
+		if ba.Host != nil && ba.Host.ServiceName != "" {
+			return ba.Host.ServiceName
+		}
+	}
+	for _, a := range s.Annotations {
+		if a.Host != nil && a.Host.ServiceName != "" {
+			return a.Host.ServiceName
+		}
+	}
+	return ""
+}
+
+// DurationMicros returns the span's duration in whole microseconds
+func (s *Span) DurationMicros() int64 {
+	return s.Duration.Microseconds()
+}
+
+// DurationMillis returns the span's duration in milliseconds
+func (s *Span) DurationMillis() float64 {
+	return float64(s.Duration) / float64(time.Millisecond)
+}
@@ -1,10 +1,33 @@
 package span
 
 import (
+	"encoding/json"
+	"net"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/apache/thrift/lib/go/thrift"
+	"github.com/uber/jaeger/thrift-gen/zipkincore"
 )
 
+func encodeThrift(t *testing.T, spans ...*zipkincore.Span) []byte {
+	buffer := thrift.NewTMemoryBuffer()
+	transport := thrift.NewTBinaryProtocolTransport(buffer)
+	if err := transport.WriteListBegin(thrift.STRUCT, len(spans)); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range spans {
+		if err := s.Write(transport); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := transport.WriteListEnd(); err != nil {
+		t.Fatal(err)
+	}
+	return buffer.Bytes()
+}
+
 func TestJSONUnmarshal(t *testing.T) {
 	b := []byte(`{"id":"hello","name":"bowser","timestamp":1480979203000000,"binaryAnnotations":[{"key":"hello","value":"world"}],"duration":1000}`)
 	span := new(Span)
@@ -20,3 +43,246 @@ func TestJSONUnmarshal(t *testing.T) {
 		t.Errorf("binary annotations incorrectly parsed")
 	}
 }
+
+func TestServiceNameFromAnnotations(t *testing.T) {
+	b := []byte(`[{"traceId":"0000000000000001","id":"0000000000000002","name":"get","annotations":[{"timestamp":1480979203000000,"value":"sr","endpoint":{"serviceName":"koopa","ipv4":"10.0.0.1"}},{"timestamp":1480979203001000,"value":"ss","endpoint":{"serviceName":"koopa","ipv4":"10.0.0.1"}}],"binaryAnnotations":[{"key":"http.path","value":"/castle"}]}]`)
+	spans, err := DecodeJSON(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if service := spans[0].ServiceName(); service != "koopa" {
+		t.Errorf("expected the service name from the sr annotation endpoint, got %q", service)
+	}
+}
+
+func TestDecodeJSONSingleSpan(t *testing.T) {
+	spans, err := DecodeJSON([]byte(` {"traceId":"0000000000000001","id":"0000000000000002","name":"lone"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(spans) != 1 || spans[0].Name != "lone" {
+		t.Errorf("expected a single span object to decode as one span, got %v", spans)
+	}
+	if _, err := DecodeJSON([]byte(`{"id":"1"}{"id":"2"}`)); err == nil {
+		t.Errorf("expected several bare span objects to be rejected")
+	}
+}
+
+func TestDurationAccessors(t *testing.T) {
+	s := &Span{Duration: 1500 * time.Microsecond}
+	if s.DurationMicros() != 1500 {
+		t.Errorf("expected 1500 microseconds, got %d", s.DurationMicros())
+	}
+	if s.DurationMillis() != 1.5 {
+		t.Errorf("expected 1.5 milliseconds, got %v", s.DurationMillis())
+	}
+}
+
+func TestJSONUnknownFieldsRoundTrip(t *testing.T) {
+	b := []byte(`{"traceId":"0000000000000001","id":"0000000000000002","name":"bowser","remoteEndpoint":{"serviceName":"koopa"},"tags":{"a":"b"},"localEndpoint":{"serviceName":"castle"}}`)
+	span := new(Span)
+	if err := span.UnmarshalJSON(b); err != nil {
+		t.Fatalf("Failed to unmarshal span from json data %s: %v", string(b), err)
+	}
+	if len(span.Extra) != 3 {
+		t.Errorf("expected 3 unknown fields to be preserved, got %v", span.Extra)
+	}
+	out, err := span.MarshalJSON()
+	if err != nil {
+		t.Fatalf("Failed to marshal span: %v", err)
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(out, &fields); err != nil {
+		t.Fatalf("Marshalled span is not valid json %s: %v", string(out), err)
+	}
+	if fields["remoteEndpoint"] == nil || fields["tags"] == nil || fields["localEndpoint"] == nil || fields["traceId"] != "0000000000000001" {
+		t.Errorf("fields lost in round trip: %s", string(out))
+	}
+}
+
+func TestKind(t *testing.T) {
+	explicit := new(Span)
+	if err := explicit.UnmarshalJSON([]byte(`{"traceId":"1","id":"1","name":"a","kind":"PRODUCER"}`)); err != nil {
+		t.Fatal(err)
+	}
+	if explicit.Kind != KindProducer {
+		t.Errorf("expected explicit kind to be kept, got %q", explicit.Kind)
+	}
+	if _, ok := explicit.Extra["kind"]; ok {
+		t.Errorf("kind should not be treated as an unknown field")
+	}
+
+	derived := new(Span)
+	if err := derived.UnmarshalJSON([]byte(`{"traceId":"1","id":"1","name":"a","annotations":[{"timestamp":1,"value":"sr"},{"timestamp":2,"value":"ss"}]}`)); err != nil {
+		t.Fatal(err)
+	}
+	if derived.Kind != KindServer {
+		t.Errorf("expected kind derived from annotations, got %q", derived.Kind)
+	}
+	out, _ := derived.MarshalJSON()
+	var fields map[string]interface{}
+	json.Unmarshal(out, &fields)
+	if fields["kind"] != KindServer {
+		t.Errorf("kind not emitted on encode: %s", string(out))
+	}
+
+	spans, err := DecodeThrift(encodeThrift(t, &zipkincore.Span{
+		TraceID:     1,
+		ID:          2,
+		Name:        "thrift",
+		Annotations: []*zipkincore.Annotation{{Timestamp: 1, Value: zipkincore.CLIENT_SEND}},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if spans[0].Kind != KindClient {
+		t.Errorf("expected client kind from thrift annotations, got %q", spans[0].Kind)
+	}
+}
+
+func TestSpanFlags(t *testing.T) {
+	spans, err := DecodeJSON([]byte(`[{"traceId":"1","id":"1","name":"a","debug":true,"shared":true}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !spans[0].Debug || !spans[0].Shared {
+		t.Errorf("expected debug and shared flags from json, got %v", spans[0])
+	}
+	out, _ := spans[0].MarshalJSON()
+	var fields map[string]interface{}
+	json.Unmarshal(out, &fields)
+	if fields["debug"] != true || fields["shared"] != true {
+		t.Errorf("flags not emitted on encode: %s", string(out))
+	}
+	if _, ok := spans[0].Extra["shared"]; ok {
+		t.Errorf("shared should not be treated as an unknown field")
+	}
+
+	timestamp := int64(1)
+	server := []*zipkincore.Annotation{{Timestamp: 2, Value: zipkincore.SERVER_RECV}, {Timestamp: 3, Value: zipkincore.SERVER_SEND}}
+	spans, err = DecodeThrift(encodeThrift(t,
+		&zipkincore.Span{TraceID: 1, ID: 1, Debug: true, Timestamp: &timestamp, Annotations: server},
+		&zipkincore.Span{TraceID: 1, ID: 2, Annotations: server},
+		&zipkincore.Span{TraceID: 1, ID: 3, Timestamp: &timestamp, Annotations: append([]*zipkincore.Annotation{{Timestamp: 1, Value: zipkincore.CLIENT_SEND}}, server...)},
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !spans[0].Debug || spans[0].Shared {
+		t.Errorf("expected debug, unshared server span with its own timestamp, got %v", spans[0])
+	}
+	if !spans[1].Shared {
+		t.Errorf("expected server span without a timestamp to be shared")
+	}
+	if !spans[2].Shared {
+		t.Errorf("expected span with client and server annotations to be shared")
+	}
+}
+
+func TestDecodeConcatenated(t *testing.T) {
+	spans, err := DecodeJSON([]byte(`[{"traceId":"1","id":"1","name":"a"}] [{"traceId":"1","id":"2","name":"b"},{"traceId":"1","id":"3","name":"c"}]`))
+	if err != nil || len(spans) != 3 {
+		t.Errorf("expected 3 spans from concatenated json arrays, got %d (%v)", len(spans), err)
+	}
+	data := append(encodeThrift(t, &zipkincore.Span{TraceID: 1, ID: 1}), encodeThrift(t, &zipkincore.Span{TraceID: 1, ID: 2})...)
+	spans, err = DecodeThrift(data)
+	if err != nil || len(spans) != 2 {
+		t.Errorf("expected 2 spans from concatenated thrift lists, got %d (%v)", len(spans), err)
+	}
+}
+
+func TestDecodeJSONStrict(t *testing.T) {
+	if _, err := DecodeJSONStrict([]byte(`[{"traceId":"1","id":"1","name":"a","annotations":[{"timestamp":1,"value":"sr"}]}]`)); err != nil {
+		t.Errorf("valid span rejected in strict mode: %v", err)
+	}
+	_, err := DecodeJSONStrict([]byte(`[{"traceId":"1","id":"1","name":"a","colour":"red"}]`))
+	if err == nil || !strings.Contains(err.Error(), "colour") {
+		t.Errorf("expected unknown field error naming colour, got %v", err)
+	}
+	_, err = DecodeJSONStrict([]byte(`[{"traceId":"1","id":"1","annotations":[{"timestamp":1,"valu":"sr"}]}]`))
+	if err == nil || !strings.Contains(err.Error(), "valu") {
+		t.Errorf("expected nested unknown field error naming valu, got %v", err)
+	}
+	spans, err := DecodeJSONStrict([]byte(`{"traceId":"1","id":"1","name":"a"}`))
+	if err != nil || len(spans) != 1 || spans[0].Name != "a" {
+		t.Errorf("expected a single span object to be decoded in strict mode, got %v, %v", spans, err)
+	}
+	_, err = DecodeJSONStrict([]byte(`{"traceId":"1","id":"1","name":"a","colour":"red"}`))
+	if err == nil || !strings.Contains(err.Error(), "colour") {
+		t.Errorf("expected unknown field error naming colour in a single span, got %v", err)
+	}
+	if _, err = DecodeJSONStrict([]byte(`{"traceId":"1","id":"1"} {}`)); err == nil {
+		t.Error("expected data after a single span to be rejected")
+	}
+	_, err = DecodeJSONStrict([]byte(`[{"traceId":"1","id":"1","name":"a","name":"b"}]`))
+	if err == nil || !strings.Contains(err.Error(), "name") {
+		t.Errorf("expected duplicate field error naming name, got %v", err)
+	}
+}
+
+func TestEndpointIPv6(t *testing.T) {
+	spans, err := DecodeThrift(encodeThrift(t, &zipkincore.Span{
+		TraceID: 1,
+		ID:      1,
+		Annotations: []*zipkincore.Annotation{{Timestamp: 1, Value: zipkincore.SERVER_RECV, Host: &zipkincore.Endpoint{
+			Ipv4:        0x7f000001,
+			Port:        8080,
+			ServiceName: "users",
+			Ipv6:        net.ParseIP("2001:db8::1"),
+		}}},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	host := spans[0].Annotations[0].Host
+	if host.Ipv6 != "2001:db8::1" || host.Ipv4 != "127.0.0.1" || host.Port != 8080 {
+		t.Errorf("endpoint incorrectly decoded from thrift: %#v", host)
+	}
+
+	out, err := json.Marshal(spans)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := DecodeJSON(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := decoded[0].Annotations[0].Host; *got != *host {
+		t.Errorf("endpoint lost in json round trip through %s: %#v", out, got)
+	}
+}
+
+func TestBinaryAnnotationEndpoints(t *testing.T) {
+	client := &zipkincore.Endpoint{Ipv4: 0x0a000001, ServiceName: "mario"}
+	server := &zipkincore.Endpoint{Ipv4: 0x0a000002, Port: 80, ServiceName: "koopa"}
+	spans, err := DecodeThrift(encodeThrift(t, &zipkincore.Span{
+		TraceID: 1,
+		ID:      1,
+		BinaryAnnotations: []*zipkincore.BinaryAnnotation{
+			{Key: "sa", Value: []byte{1}, AnnotationType: zipkincore.AnnotationType_BOOL, Host: server},
+			{Key: "http.path", Value: []byte("/castle"), AnnotationType: zipkincore.AnnotationType_STRING, Host: client},
+		},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bas := spans[0].BinaryAnnotations
+	if len(bas) != 2 || bas[0].Key != "sa" || bas[0].Host.ServiceName != "koopa" || bas[1].Host.ServiceName != "mario" {
+		t.Fatalf("expected each binary annotation to keep its endpoint, got %v", bas)
+	}
+	if service := spans[0].ServiceName(); service != "mario" {
+		t.Errorf("expected the service name not to come from the server address, got %q", service)
+	}
+
+	out, err := json.Marshal(spans)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := DecodeJSON(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := decoded[0].BinaryAnnotations[0].Host; got == nil || got.ServiceName != "koopa" || got.Port != 80 {
+		t.Errorf("binary annotation endpoint lost in json round trip through %s", out)
+	}
+}
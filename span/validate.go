@@ -0,0 +1,28 @@
+package span
+
+import "fmt"
+
+// ValidateIDs returns an error naming the first of the span's IDs
+// that isn't well formed. Trace IDs must be 16 or 32 hex characters,
+// and span and parent IDs 16. A missing parent ID is allowed
+func (s *Span) ValidateIDs() error {
+	if !isHex(s.TraceID) || (len(s.TraceID) != 16 && len(s.TraceID) != 32) {
+		return fmt.Errorf("invalid trace ID %q: must be 16 or 32 hex characters", s.TraceID)
+	}
+	if !isHex(s.ID) || len(s.ID) != 16 {
+		return fmt.Errorf("invalid span ID %q: must be 16 hex characters", s.ID)
+	}
+	if s.ParentID != "" && (!isHex(s.ParentID) || len(s.ParentID) != 16) {
+		return fmt.Errorf("invalid parent ID %q: must be 16 hex characters", s.ParentID)
+	}
+	return nil
+}
+
+func isHex(id string) bool {
+	for _, c := range id {
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,28 @@
+package span
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateIDs(t *testing.T) {
+	valid := []*Span{
+		{TraceID: "0123456789abcdef", ID: "0123456789abcdef"},
+		{TraceID: "0123456789abcdef0123456789ABCDEF", ID: "0123456789abcdef", ParentID: "fedcba9876543210"},
+	}
+	for _, s := range valid {
+		if err := s.ValidateIDs(); err != nil {
+			t.Errorf("expected %s/%s to be valid: %v", s.TraceID, s.ID, err)
+		}
+	}
+	invalid := map[string]*Span{
+		"trace":  {TraceID: "0123456789ab", ID: "0123456789abcdef"},
+		"span":   {TraceID: "0123456789abcdef", ID: "0123456789abcdeg"},
+		"parent": {TraceID: "0123456789abcdef", ID: "0123456789abcdef", ParentID: "1"},
+	}
+	for field, s := range invalid {
+		if err := s.ValidateIDs(); err == nil || !strings.Contains(err.Error(), field) {
+			t.Errorf("expected an error naming the %s ID, got %v", field, err)
+		}
+	}
+}